@@ -4,12 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/instill-ai/mgmt-backend/config"
 	"github.com/instill-ai/mgmt-backend/pkg/constant"
 	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
 	"github.com/instill-ai/mgmt-backend/pkg/repository"
 	"github.com/instill-ai/mgmt-backend/pkg/service"
 
@@ -57,8 +60,13 @@ func main() {
 	defer redisClient.Close()
 	r := repository.NewRepository(db, redisClient)
 
+	passwordHasher, err := password.NewHasher(config.Config.Server.Password)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
 	// Create a default user
-	if err := createDefaultUser(ctx, r); err != nil {
+	if err := createDefaultUser(ctx, r, passwordHasher); err != nil {
 		logger.Fatal(err.Error())
 	}
 
@@ -72,7 +80,7 @@ func main() {
 // CreateDefaultUser creates a default user in the database
 // Return error types
 //   - codes.Internal
-func createDefaultUser(ctx context.Context, r repository.Repository) error {
+func createDefaultUser(ctx context.Context, r repository.Repository, h password.Hasher) error {
 
 	// Generate a random uid to the user
 	var defaultUserUID uuid.UUID
@@ -86,7 +94,11 @@ func createDefaultUser(ctx context.Context, r repository.Repository) error {
 		return status.Errorf(codes.Internal, "uuid generation error %v", err)
 	}
 
-	passwordBytes, err := bcrypt.GenerateFromPassword([]byte(constant.DefaultUserPassword), 10)
+	initialPassword, passwordChangeRequired, err := defaultUserPassword()
+	if err != nil {
+		return err
+	}
+	passwordHash, err := h.Hash(initialPassword)
 	if err != nil {
 		return err
 	}
@@ -108,16 +120,26 @@ func createDefaultUser(ctx context.Context, r repository.Repository) error {
 	user, err := r.GetUser(ctx, constant.DefaultUserID, false)
 	// Default user already exists
 	if err == nil {
-		passwordHash, _, err := r.GetUserPasswordHash(ctx, user.UID)
+		existingHash, _, err := r.GetUserPasswordHash(ctx, user.UID)
 		if err != nil {
 			return err
 		}
 
-		if passwordHash == "" {
-			err = r.UpdateUserPasswordHash(ctx, user.UID, string(passwordBytes), time.Now())
+		if existingHash == "" {
+			err = r.UpdateUserPasswordHash(ctx, user.UID, passwordHash, time.Now())
 			if err != nil {
 				return err
 			}
+			if passwordChangeRequired {
+				return r.UpdateUserPasswordChangeRequired(ctx, user.UID, true)
+			}
+			return nil
+		}
+
+		// The default user may still have the built-in password, set before
+		// it had to be changed.
+		if match, _, err := h.Verify(constant.DefaultUserPassword, existingHash); err == nil && match {
+			return r.UpdateUserPasswordChangeRequired(ctx, user.UID, true)
 		}
 		return nil
 	}
@@ -131,9 +153,33 @@ func createDefaultUser(ctx context.Context, r repository.Repository) error {
 	if err != nil {
 		return err
 	}
-	err = r.UpdateUserPasswordHash(ctx, defaultUser.UID, string(passwordBytes), time.Now())
+	err = r.UpdateUserPasswordHash(ctx, defaultUser.UID, passwordHash, time.Now())
 	if err != nil {
 		return err
 	}
+	if passwordChangeRequired {
+		return r.UpdateUserPasswordChangeRequired(ctx, defaultUser.UID, true)
+	}
 	return nil
 }
+
+// defaultUserPassword returns the initial password of the default user and
+// whether it must be changed on the first login, which is the case of the
+// built-in one.
+func defaultUserPassword() (string, bool, error) {
+	switch {
+	case config.Config.Server.DefaultUserPasswordFile != "":
+		b, err := os.ReadFile(config.Config.Server.DefaultUserPasswordFile)
+		if err != nil {
+			return "", false, fmt.Errorf("reading default user password: %w", err)
+		}
+		p := strings.TrimRight(string(b), "\r\n")
+		if p == "" {
+			return "", false, fmt.Errorf("default user password file %s is empty", config.Config.Server.DefaultUserPasswordFile)
+		}
+		return p, false, nil
+	case config.Config.Server.DefaultUserPassword != "":
+		return config.Config.Server.DefaultUserPassword, false, nil
+	}
+	return constant.DefaultUserPassword, true, nil
+}
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/redis/go-redis/v9"
@@ -26,10 +27,17 @@ import (
 
 	"github.com/instill-ai/mgmt-backend/config"
 	"github.com/instill-ai/mgmt-backend/pkg/acl"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
 	"github.com/instill-ai/mgmt-backend/pkg/handler"
+	"github.com/instill-ai/mgmt-backend/pkg/ldap"
+	"github.com/instill-ai/mgmt-backend/pkg/mail"
 	"github.com/instill-ai/mgmt-backend/pkg/middleware"
+	"github.com/instill-ai/mgmt-backend/pkg/oidc"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
 	"github.com/instill-ai/mgmt-backend/pkg/repository"
 	"github.com/instill-ai/mgmt-backend/pkg/service"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+	"github.com/instill-ai/mgmt-backend/pkg/tokenpolicy"
 
 	database "github.com/instill-ai/mgmt-backend/pkg/db"
 	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
@@ -97,9 +105,6 @@ func main() {
 	privateGrpcS := grpc.NewServer(grpcServerOpts...)
 	reflection.Register(privateGrpcS)
 
-	publicGrpcS := grpc.NewServer(grpcServerOpts...)
-	reflection.Register(publicGrpcS)
-
 	pipelinePublicServiceClient, redisClient, db, influxDB, closeClients := newClients(ctx, logger)
 	defer closeClients()
 
@@ -160,6 +165,60 @@ func main() {
 	aclClient = acl.NewACLClient(fgaClient, fgaReplicaClient, redisClient)
 
 	repository := repository.NewRepository(db, redisClient)
+
+	secretCipher, err := encryption.NewCipher(config.Config.Server.EncryptionKey)
+	if err != nil {
+		logger.Fatal("failed to create secret cipher", zap.Error(err))
+	}
+
+	signingKeyManager, err := signingkey.NewManager(
+		repository,
+		secretCipher,
+		config.Config.Server.JWT.Algorithm,
+		time.Duration(config.Config.Server.JWT.Expiration)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("failed to create signing key manager", zap.Error(err))
+	}
+
+	passwordHasher, err := password.NewHasher(config.Config.Server.Password)
+	if err != nil {
+		logger.Fatal("failed to create password hasher", zap.Error(err))
+	}
+
+	passwordPolicy, err := password.NewPolicy(config.Config.Server.Password)
+	if err != nil {
+		logger.Fatal("failed to create password policy", zap.Error(err))
+	}
+
+	tokenPolicy, err := tokenpolicy.NewPolicy(config.Config.Server.APIToken.Policy)
+	if err != nil {
+		logger.Fatal("failed to create API token policy", zap.Error(err))
+	}
+
+	mailSender, err := mail.NewSender(config.Config.Mail)
+	if err != nil {
+		logger.Fatal("failed to create mail sender", zap.Error(err))
+	}
+
+	// The users are only authenticated against the directory when it's
+	// enabled, the local passwords are used otherwise.
+	var ldapAuthenticator ldap.Authenticator
+	if config.Config.LDAP.Enabled {
+		ldapAuthenticator, err = ldap.NewAuthenticator(config.Config.LDAP)
+		if err != nil {
+			logger.Fatal("failed to create LDAP authenticator", zap.Error(err))
+		}
+	}
+
+	var oidcProvider oidc.Provider
+	if config.Config.OIDC.Enabled {
+		oidcProvider, err = oidc.NewProvider(config.Config.OIDC)
+		if err != nil {
+			logger.Fatal("failed to create OIDC provider", zap.Error(err))
+		}
+	}
+
 	service := service.NewService(
 		pipelinePublicServiceClient,
 		repository,
@@ -167,18 +226,37 @@ func main() {
 		influxDB,
 		&aclClient,
 		config.Config.Server.InstillCoreHost,
+		signingKeyManager,
+		passwordHasher,
+		passwordPolicy,
+		tokenPolicy,
+		mailSender,
+		ldapAuthenticator,
+		oidcProvider,
+		secretCipher,
 	)
 
 	mgmtpb.RegisterMgmtPrivateServiceServer(
 		privateGrpcS,
 		handler.NewPrivateHandler(service),
 	)
+	// The users who must change their password can't use the other public
+	// APIs until they do, and the scoped API tokens only grant the APIs of
+	// their scopes.
+	publicGrpcS := grpc.NewServer(append(grpcServerOpts,
+		grpc.ChainUnaryInterceptor(
+			middleware.TokenScopeInterceptor(service),
+			middleware.PasswordChangeRequiredInterceptor(service),
+		),
+	)...)
+	reflection.Register(publicGrpcS)
+
 	mgmtpb.RegisterMgmtPublicServiceServer(
 		publicGrpcS,
 		handler.NewPublicHandler(service),
 	)
 
-	publicServeMux := runtime.NewServeMux(
+	serveMuxOpts := []runtime.ServeMuxOption{
 		runtime.WithIncomingHeaderMatcher(gatewayx.CustomHeaderMatcher),
 		runtime.WithForwardResponseOption(gatewayx.HTTPResponseModifier),
 		runtime.WithErrorHandler(gatewayx.ErrorHandler),
@@ -191,13 +269,31 @@ func main() {
 				DiscardUnknown: true,
 			},
 		}),
-	)
+	}
+
+	publicServeMux := runtime.NewServeMux(serveMuxOpts...)
 	if err := publicServeMux.HandlePath("GET", "/v1beta/{name=users/*}/avatar", middleware.AppendCustomHeaderMiddleware(publicServeMux, repository, middleware.HandleAvatar)); err != nil {
 		logger.Fatal(err.Error())
 	}
 	if err := publicServeMux.HandlePath("GET", "/v1beta/{name=organizations/*}/avatar", middleware.AppendCustomHeaderMiddleware(publicServeMux, repository, middleware.HandleAvatar)); err != nil {
 		logger.Fatal(err.Error())
 	}
+	if err := handler.RegisterPublicRESTHandlers(publicServeMux, service); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if config.Config.SCIM.Enabled {
+		if err := handler.RegisterSCIMHandlers(publicServeMux, service, config.Config.SCIM.Token); err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+
+	// The private endpoints that are only available over REST are served on
+	// their own port, the private port only serves gRPC. Like the private
+	// port, it's only meant to be reached from within the cluster.
+	privateServeMux := runtime.NewServeMux(serveMuxOpts...)
+	if err := handler.RegisterPrivateRESTHandlers(privateServeMux, service); err != nil {
+		logger.Fatal(err.Error())
+	}
 
 	dialOpts, err := clientgrpcx.NewClientOptionsAndCreds(
 		clientgrpcx.WithServiceConfig(clientx.ServiceConfig{
@@ -216,6 +312,11 @@ func main() {
 		logger.Fatal(err.Error())
 	}
 
+	privateRESTServer := &http.Server{
+		Addr:    fmt.Sprintf(":%v", config.Config.Server.PrivateRESTPort),
+		Handler: privateServeMux,
+	}
+
 	publicHTTPServer := &http.Server{
 		Addr:    fmt.Sprintf(":%v", config.Config.Server.PublicPort),
 		Handler: grpcHandlerFunc(publicGrpcS, publicServeMux),
@@ -235,6 +336,21 @@ func main() {
 		}
 	}()
 
+	if config.Config.Server.PrivateRESTPort != 0 {
+		go func() {
+			var err error
+			switch {
+			case config.Config.Server.HTTPS.Cert != "" && config.Config.Server.HTTPS.Key != "":
+				err = privateRESTServer.ListenAndServeTLS(config.Config.Server.HTTPS.Cert, config.Config.Server.HTTPS.Key)
+			default:
+				err = privateRESTServer.ListenAndServe()
+			}
+			if err != nil {
+				errSig <- fmt.Errorf("failed to serve: %w", err)
+			}
+		}()
+	}
+
 	go func() {
 		var err error
 		switch {
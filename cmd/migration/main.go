@@ -65,12 +65,13 @@ func main() {
 	codeMigrator, cleanup := initCodeMigrator(ctx, logger)
 	defer cleanup()
 
-	runMigration(dsn, uint(migration.TargetSchemaVersion), codeMigrator.Migrate, logger)
+	runMigration(dsn, uint(migration.TargetSchemaVersion), codeMigrator.Check, codeMigrator.Migrate, logger)
 
 }
 
 func runMigration(dsn string,
 	expectedVersion uint,
+	checkCode func(version uint) error,
 	execCode func(version uint) error,
 	logger *zap.Logger,
 ) {
@@ -105,6 +106,10 @@ func runMigration(dsn string,
 			break
 		}
 
+		if err := checkCode(step + 1); err != nil {
+			panic(err)
+		}
+
 		fmt.Printf("Step up to version %d\n", step+1)
 		if err := m.Steps(1); err != nil {
 			panic(err)
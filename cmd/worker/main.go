@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/contrib/opentelemetry"
@@ -15,8 +17,13 @@ import (
 	grpczap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 
 	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+	"github.com/instill-ai/mgmt-backend/pkg/tokenpolicy"
 	"github.com/instill-ai/x/temporal"
 
+	database "github.com/instill-ai/mgmt-backend/pkg/db"
 	mgmtworker "github.com/instill-ai/mgmt-backend/pkg/worker"
 	logx "github.com/instill-ai/x/log"
 	otelx "github.com/instill-ai/x/otel"
@@ -86,6 +93,36 @@ func main() {
 	}
 	defer temporalClient.Close()
 
+	db := database.GetConnection(&config.Config.Database)
+	defer database.Close(db)
+
+	redisClient := redis.NewClient(&config.Config.Cache.Redis.RedisOptions)
+	defer redisClient.Close()
+
+	repo := repository.NewRepository(db, redisClient)
+
+	secretCipher, err := encryption.NewCipher(config.Config.Server.EncryptionKey)
+	if err != nil {
+		logger.Fatal("Unable to create secret cipher", zap.Error(err))
+	}
+
+	signingKeyManager, err := signingkey.NewManager(
+		repo,
+		secretCipher,
+		config.Config.Server.JWT.Algorithm,
+		time.Duration(config.Config.Server.JWT.Expiration)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("Unable to create signing key manager", zap.Error(err))
+	}
+
+	tokenPolicy, err := tokenpolicy.NewPolicy(config.Config.Server.APIToken.Policy)
+	if err != nil {
+		logger.Fatal("Unable to create API token policy", zap.Error(err))
+	}
+
+	cw := mgmtworker.NewWorker(signingKeyManager, repo, tokenPolicy)
+
 	w := worker.New(temporalClient, mgmtworker.TaskQueue, worker.Options{
 		MaxConcurrentActivityExecutionSize: 2,
 		Interceptors: func() []interceptor.WorkerInterceptor {
@@ -103,6 +140,37 @@ func main() {
 		}(),
 	})
 
+	w.RegisterWorkflow(cw.RotateSigningKeysWorkflow)
+	w.RegisterActivity(cw.RotateSigningKeysActivity)
+	w.RegisterWorkflow(cw.SweepAPITokensWorkflow)
+	w.RegisterActivity(cw.SweepAPITokensActivity)
+	w.RegisterWorkflow(cw.FlushTokenLastUsesWorkflow)
+	w.RegisterActivity(cw.FlushTokenLastUsesActivity)
+
+	// The workflow ID is fixed, so starting the schedule again while it runs
+	// is a no-op.
+	if _, err := temporalClient.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:           mgmtworker.RotateSigningKeysWorkflowID,
+		TaskQueue:    mgmtworker.TaskQueue,
+		CronSchedule: mgmtworker.RotateSigningKeysCronSchedule,
+	}, cw.RotateSigningKeysWorkflow); err != nil {
+		logger.Fatal("Unable to start signing key rotation workflow", zap.Error(err))
+	}
+	if _, err := temporalClient.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:           mgmtworker.SweepAPITokensWorkflowID,
+		TaskQueue:    mgmtworker.TaskQueue,
+		CronSchedule: mgmtworker.SweepAPITokensCronSchedule,
+	}, cw.SweepAPITokensWorkflow); err != nil {
+		logger.Fatal("Unable to start API token sweep workflow", zap.Error(err))
+	}
+	if _, err := temporalClient.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:           mgmtworker.FlushTokenLastUsesWorkflowID,
+		TaskQueue:    mgmtworker.TaskQueue,
+		CronSchedule: mgmtworker.FlushTokenLastUsesCronSchedule,
+	}, cw.FlushTokenLastUsesWorkflow); err != nil {
+		logger.Fatal("Unable to start API token last use flush workflow", zap.Error(err))
+	}
+
 	err = w.Run(worker.InterruptCh())
 	if err != nil {
 		logger.Fatal(fmt.Sprintf("Unable to start worker: %s", err))
@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
 	"github.com/instill-ai/x/client"
 	"github.com/instill-ai/x/temporal"
 )
@@ -31,13 +33,22 @@ type AppConfig struct {
 	PipelineBackend client.ServiceConfig  `koanf:"pipelinebackend"`
 	OpenFGA         OpenFGAConfig         `koanf:"openfga"`
 	Temporal        temporal.ClientConfig `koanf:"temporal"`
+	Mail            MailConfig            `koanf:"mail"`
+	LDAP            LDAPConfig            `koanf:"ldap"`
+	OIDC            OIDCConfig            `koanf:"oidc"`
+	SCIM            SCIMConfig            `koanf:"scim"`
 }
 
 // ServerConfig defines HTTP server configurations
 type ServerConfig struct {
 	PrivatePort int `koanf:"privateport"`
 	PublicPort  int `koanf:"publicport"`
-	HTTPS       struct {
+	// Port of the private endpoints only available over REST, e.g. the
+	// session administration. Like the private port, it isn't authenticated
+	// and mustn't be exposed outside of the cluster. The endpoints aren't
+	// served if it is 0.
+	PrivateRESTPort int `koanf:"privaterestport"`
+	HTTPS           struct {
 		Cert string `koanf:"cert"`
 		Key  string `koanf:"key"`
 	}
@@ -51,6 +62,142 @@ type ServerConfig struct {
 	Debug           bool   `koanf:"debug"`
 	DefaultUserUID  string `koanf:"defaultuseruid"`
 	InstillCoreHost string `koanf:"instillcorehost"`
+	// Key the secrets stored in the database are encrypted with, e.g. the
+	// private keys signing the access tokens. Changing it makes them
+	// unreadable.
+	EncryptionKey string `koanf:"encryptionkey"`
+	JWT           struct {
+		Issuer            string        `koanf:"issuer"`
+		Audience          string        `koanf:"audience"`
+		Expiration        int           `koanf:"expiration"`        // in seconds
+		RefreshExpiration int           `koanf:"refreshexpiration"` // in seconds
+		Algorithm         string        `koanf:"algorithm"`         // RS256 or EdDSA
+		RotationPeriod    time.Duration `koanf:"rotationperiod"`
+	} `koanf:"jwt"`
+	Password PasswordConfig `koanf:"password"`
+	Lockout  struct {
+		MaxAttempts   int           `koanf:"maxattempts"`   // failures before an account is locked for a client IP
+		MaxIPAttempts int           `koanf:"maxipattempts"` // failures before a client IP is locked
+		Window        time.Duration `koanf:"window"`        // failures are forgotten after this long
+		Duration      time.Duration `koanf:"duration"`
+		BackoffBase   time.Duration `koanf:"backoffbase"` // delay after the first failure, doubled on each one
+		BackoffMax    time.Duration `koanf:"backoffmax"`
+	} `koanf:"lockout"`
+	MFA struct {
+		Issuer        string `koanf:"issuer"`        // shown by the authenticator apps
+		RecoveryCodes int    `koanf:"recoverycodes"` // issued when a factor is enabled
+	} `koanf:"mfa"`
+	PasswordReset struct {
+		URL      string        `koanf:"url"` // page of the console the reset links point to
+		TokenTTL time.Duration `koanf:"tokenttl"`
+	} `koanf:"passwordreset"`
+	EmailVerification struct {
+		URL      string        `koanf:"url"` // page of the console the verification links point to
+		TokenTTL time.Duration `koanf:"tokenttl"`
+	} `koanf:"emailverification"`
+	APIToken struct {
+		Retention           time.Duration        `koanf:"retention"`           // expired tokens are purged after this long
+		RotationGracePeriod time.Duration        `koanf:"rotationgraceperiod"` // the previous secret of a rotated token stays valid this long
+		Policy              APITokenPolicyConfig `koanf:"policy"`
+	} `koanf:"apitoken"`
+	// The initial password of the default user, read from a file (e.g. a
+	// mounted secret) or set directly. The built-in password is used
+	// otherwise, and must be changed on the first login.
+	DefaultUserPassword     string `koanf:"defaultuserpassword"`
+	DefaultUserPasswordFile string `koanf:"defaultuserpasswordfile"`
+}
+
+// PasswordConfig related to password hashing and policy
+type PasswordConfig struct {
+	Algorithm   string `koanf:"algorithm"`   // argon2id or bcrypt
+	HistorySize int    `koanf:"historysize"` // recent passwords that can't be reused, including the current one
+	Bcrypt      struct {
+		Cost int `koanf:"cost"`
+	} `koanf:"bcrypt"`
+	Argon2id struct {
+		Memory      uint32 `koanf:"memory"` // in KiB
+		Iterations  uint32 `koanf:"iterations"`
+		Parallelism uint8  `koanf:"parallelism"`
+		SaltLength  uint32 `koanf:"saltlength"` // in bytes
+		KeyLength   uint32 `koanf:"keylength"`  // in bytes
+	} `koanf:"argon2id"`
+	Policy struct {
+		MinLength        int    `koanf:"minlength"` // in characters
+		RequireUppercase bool   `koanf:"requireuppercase"`
+		RequireLowercase bool   `koanf:"requirelowercase"`
+		RequireDigit     bool   `koanf:"requiredigit"`
+		RequireSymbol    bool   `koanf:"requiresymbol"`
+		BreachedList     string `koanf:"breachedlist"` // file with a breached password per line
+	} `koanf:"policy"`
+}
+
+// APITokenPolicyConfig restricts the API tokens the users create. The zero
+// values don't restrict them. The worker flags the existing tokens that don't
+// satisfy the policy.
+type APITokenPolicyConfig struct {
+	MaxTTL            time.Duration `koanf:"maxttl"` // from the creation to the expiration
+	ForbidNonExpiring bool          `koanf:"forbidnonexpiring"`
+	MaxActivePerOwner int           `koanf:"maxactiveperowner"`
+	NamePattern       string        `koanf:"namepattern"` // regular expression the token IDs must match, e.g. ^ci-
+}
+
+// MailConfig related to the emails sent to the users
+type MailConfig struct {
+	Sender string `koanf:"sender"` // smtp or file
+	From   string `koanf:"from"`
+	SMTP   struct {
+		Host     string `koanf:"host"`
+		Port     int    `koanf:"port"`
+		Username string `koanf:"username"`
+		Password string `koanf:"password"`
+	} `koanf:"smtp"`
+	File string `koanf:"file"` // only the recipients and subjects are logged if empty
+}
+
+// LDAPConfig related to the LDAP or Active Directory server the users are
+// authenticated against
+type LDAPConfig struct {
+	Enabled            bool   `koanf:"enabled"`
+	URL                string `koanf:"url"` // ldap:// or ldaps://
+	StartTLS           bool   `koanf:"starttls"`
+	InsecureSkipVerify bool   `koanf:"insecureskipverify"`
+	// The users are looked up with this account, or anonymously if empty.
+	BindDN       string `koanf:"binddn"`
+	BindPassword string `koanf:"bindpassword"`
+	BaseDN       string `koanf:"basedn"`
+	UserFilter   string `koanf:"userfilter"` // %s is replaced with the username, e.g. (sAMAccountName=%s)
+	Attributes   struct {
+		Username    string `koanf:"username"`
+		Email       string `koanf:"email"`
+		DisplayName string `koanf:"displayname"`
+		// Stable identifier of the entries, e.g. entryUUID or objectGUID. The
+		// DN is used if empty.
+		ID string `koanf:"id"`
+	} `koanf:"attributes"`
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// OIDCConfig related to the OpenID Connect provider the users can sign in
+// with
+type OIDCConfig struct {
+	Enabled      bool     `koanf:"enabled"`
+	Issuer       string   `koanf:"issuer"`
+	ClientID     string   `koanf:"clientid"`
+	ClientSecret string   `koanf:"clientsecret"`
+	RedirectURL  string   `koanf:"redirecturl"` // page of the console the provider sends the authorization code to
+	Scopes       []string `koanf:"scopes"`
+	// On their first login, the users are linked to the local user with the
+	// same email when both the provider and the local user verified it.
+	LinkVerifiedEmail bool `koanf:"linkverifiedemail"`
+}
+
+// SCIMConfig related to the SCIM 2.0 endpoints the identity providers
+// provision the users and the organizations through
+type SCIMConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	Token   string `koanf:"token"` // bearer token of the identity provider
+	// ID of the user who owns the organizations provisioned through SCIM.
+	OrganizationOwner string `koanf:"organizationowner"`
 }
 
 // OpenFGAConfig related to OpenFGA
@@ -121,6 +268,45 @@ func Init(filePath string) error {
 	if err := k.Load(confmap.Provider(map[string]interface{}{
 		"database.replica.replicationtimeframe": 60,
 		"openfga.replica.replicationtimeframe":  60,
+		"server.jwt.issuer":                     constant.DefaultJwtIssuer,
+		"server.jwt.audience":                   constant.DefaultJwtAudience,
+		"server.jwt.expiration":                 constant.DefaultJwtExpiration,
+		"server.jwt.refreshexpiration":          constant.DefaultJwtRefreshExpiration,
+		"server.jwt.algorithm":                  constant.DefaultJwtAlgorithm,
+		"server.jwt.rotationperiod":             constant.DefaultJwtRotationPeriod,
+		"server.password.algorithm":             "argon2id",
+		"server.password.bcrypt.cost":           12,
+		"server.password.argon2id.memory":       19456,
+		"server.password.argon2id.iterations":   2,
+		"server.password.argon2id.parallelism":  1,
+		"server.password.argon2id.saltlength":   16,
+		"server.password.argon2id.keylength":    32,
+		"server.password.policy.minlength":      8,
+		"server.password.historysize":           5,
+		"server.lockout.maxattempts":            5,
+		"server.lockout.maxipattempts":          50,
+		"server.lockout.window":                 15 * time.Minute,
+		"server.lockout.duration":               15 * time.Minute,
+		"server.lockout.backoffbase":            time.Second,
+		"server.lockout.backoffmax":             30 * time.Second,
+		"server.mfa.issuer":                     "Instill AI",
+		"server.mfa.recoverycodes":              10,
+		"server.passwordreset.url":              "http://localhost:3000/reset-password",
+		"server.passwordreset.tokenttl":         time.Hour,
+		"server.emailverification.url":          "http://localhost:3000/verify-email",
+		"server.emailverification.tokenttl":     24 * time.Hour,
+		"server.apitoken.retention":             30 * 24 * time.Hour,
+		"server.apitoken.rotationgraceperiod":   24 * time.Hour,
+		"mail.sender":                           "file",
+		"mail.from":                             "Instill AI <no-reply@instill-ai.com>",
+		"mail.smtp.port":                        587,
+		"ldap.userfilter":                       "(uid=%s)",
+		"ldap.attributes.username":              "uid",
+		"ldap.attributes.email":                 "mail",
+		"ldap.attributes.displayname":           "cn",
+		"ldap.timeout":                          10 * time.Second,
+		"oidc.redirecturl":                      "http://localhost:3000/oidc/callback",
+		"oidc.scopes":                           []string{"openid", "email", "profile"},
 	}, "."), nil); err != nil {
 		log.Fatal(err.Error())
 	}
@@ -146,8 +332,22 @@ func Init(filePath string) error {
 	return ValidateConfig(&Config)
 }
 
+// devEncryptionKey is the key of the default configuration, which can only be
+// used by the development and test editions, e.g. docker-ce:dev.
+const devEncryptionKey = "instill-dev-encryption-key"
+
 // ValidateConfig is for custom validation rules for the configuration
-func ValidateConfig(_ *AppConfig) error {
+func ValidateConfig(cfg *AppConfig) error {
+	dev := strings.HasSuffix(cfg.Server.Edition, ":dev") || strings.HasSuffix(cfg.Server.Edition, ":test")
+	if cfg.Server.EncryptionKey == "" {
+		return fmt.Errorf("server.encryptionkey is required")
+	}
+	if cfg.Server.EncryptionKey == devEncryptionKey && !dev {
+		return fmt.Errorf("server.encryptionkey must be overridden outside the development and test editions")
+	}
+	if cfg.SCIM.Enabled && cfg.SCIM.OrganizationOwner == "" {
+		return fmt.Errorf("scim.organizationowner is required")
+	}
 	return nil
 }
 
@@ -26,6 +26,8 @@ export const mgmtPublicGRPCHost = apiGatewayUrl;
 // Private hosts (direct backend, for internal service calls)
 export const mgmtPrivateHost = `http://mgmt-backend:3084/${mgmtVersion}`;
 export const mgmtPrivateGRPCHost = `mgmt-backend:3084`;
+// The private endpoints only served over REST, e.g. the session administration
+export const mgmtPrivateRESTHost = `http://mgmt-backend:3085/${mgmtVersion}`;
 
 export const defaultUsername = "admin"
 export const defaultPassword = "password"
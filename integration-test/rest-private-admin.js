@@ -0,0 +1,48 @@
+import http from "k6/http";
+import { check, group } from "k6";
+import * as constant from "./const.js";
+
+export function CheckPrivateListSessionsAdmin() {
+  group(`Management Private API: List the sessions of a user`, () => {
+    check(
+      http.request(
+        "GET",
+        `${constant.mgmtPrivateRESTHost}/admin/users/${constant.defaultUser.id}/sessions`
+      ),
+      {
+        [`GET /${constant.mgmtVersion}/admin/users/{id}/sessions response status is 200`]:
+          (r) => r.status === 200,
+        [`GET /${constant.mgmtVersion}/admin/users/{id}/sessions response sessions`]:
+          (r) => Array.isArray(r.json().sessions),
+      }
+    );
+
+    check(
+      http.request(
+        "GET",
+        `${constant.mgmtPrivateRESTHost}/admin/users/non-existent-user/sessions`
+      ),
+      {
+        [`GET /${constant.mgmtVersion}/admin/users/non-existent-user/sessions response status is 404`]:
+          (r) => r.status === 404,
+      }
+    );
+  });
+}
+
+export function CheckPrivateUnlockUserAdmin() {
+  group(`Management Private API: Unlock a user`, () => {
+    check(
+      http.request(
+        "POST",
+        `${constant.mgmtPrivateRESTHost}/admin/users/${constant.defaultUser.id}:unlock`,
+        JSON.stringify({}),
+        constant.restParams
+      ),
+      {
+        [`POST /${constant.mgmtVersion}/admin/users/{id}:unlock response status is 200`]:
+          (r) => r.status === 200,
+      }
+    );
+  });
+}
@@ -5,6 +5,7 @@ import * as constant from "./const.js"
 import * as mgmtPublic from "./rest-public-user.js"
 import * as mgmtPublicWithJwt from "./rest-public-user-with-jwt.js"
 import * as restInvariants from "./rest-invariants.js"
+import * as mgmtPrivateAdmin from "./rest-private-admin.js"
 
 export let options = {
   setupTimeout: "300s",
@@ -49,6 +50,12 @@ export default function (header) {
 
   // AIP Resource Refactoring Invariants
   restInvariants.checkInvariants(header);
+
+  // ======== Private API (direct backend, only reachable from the containers)
+  if (!constant.isHostMode) {
+    mgmtPrivateAdmin.CheckPrivateListSessionsAdmin();
+    mgmtPrivateAdmin.CheckPrivateUnlockUserAdmin();
+  }
 }
 
 export function teardown(data) {
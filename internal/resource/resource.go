@@ -3,9 +3,12 @@ package resource
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"strings"
 
 	"google.golang.org/grpc/metadata"
+
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
 )
 
 // GetRequestSingleHeader get a request header, the header has to be single-value HTTP header
@@ -17,6 +20,33 @@ func GetRequestSingleHeader(ctx context.Context, header string) string {
 	return metaHeader[0]
 }
 
+// GetRequestUserAgent returns the user agent of the client, the gateway
+// forwards it in its own header.
+func GetRequestUserAgent(ctx context.Context) string {
+	if userAgent := GetRequestSingleHeader(ctx, constant.HeaderGatewayUserAgent); userAgent != "" {
+		return userAgent
+	}
+	return GetRequestSingleHeader(ctx, constant.HeaderUserAgent)
+}
+
+// GetRequestClientIP returns the IP address of the client, as appended to the
+// X-Forwarded-For header by the gateway. Only the last entry is trusted, the
+// previous ones are sent by the client. It returns an empty string if the
+// address is missing or invalid.
+func GetRequestClientIP(ctx context.Context) string {
+	forwardedFor := metadata.ValueFromIncomingContext(ctx, strings.ToLower(constant.HeaderForwardedFor))
+	if len(forwardedFor) == 0 {
+		return ""
+	}
+
+	hops := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+	addr, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1]))
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
 // GetRscNameID returns the resource ID given a resource name
 func GetRscNameID(path string) (string, error) {
 	id := path[strings.LastIndex(path, "/")+1:]
@@ -0,0 +1,35 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGetRequestClientIP(t *testing.T) {
+	testCases := []struct {
+		name         string
+		forwardedFor []string
+		want         string
+	}{
+		{name: "missing"},
+		{name: "gateway only", forwardedFor: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed by the client", forwardedFor: []string{"10.0.0.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "several headers", forwardedFor: []string{"10.0.0.1", "198.51.100.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "IPv6", forwardedFor: []string{"2001:db8::1"}, want: "2001:db8::1"},
+		{name: "invalid", forwardedFor: []string{"203.0.113.7, unknown"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			md := metadata.MD{}
+			for _, v := range tc.forwardedFor {
+				md.Append("x-forwarded-for", v)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+			assert.Equal(t, tc.want, GetRequestClientIP(ctx))
+		})
+	}
+}
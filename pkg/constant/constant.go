@@ -1,5 +1,7 @@
 package constant
 
+import "time"
+
 // default user
 const DefaultUserID = "admin"
 const DefaultUserPassword = "password"
@@ -9,9 +11,12 @@ const DefaultUserCompanyName = "Instill AI"
 const DefaultUserDisplayName = "Instill"
 const DefaultUserRole = "hobbyist"
 const DefaultUserNewsletterSubscription = true
-const DefaultJwtExpiration = 86400 * 7
+const DefaultJwtExpiration = 3600
+const DefaultJwtRefreshExpiration = 86400 * 30
 const DefaultJwtIssuer = "http://localhost:8080"
 const DefaultJwtAudience = "http://localhost:8080"
+const DefaultJwtAlgorithm = "RS256"
+const DefaultJwtRotationPeriod = 30 * 24 * time.Hour
 
 // Preset user namespace for storing preset resources (e.g., preset pipelines)
 const PresetUserID = "preset"
@@ -27,10 +32,25 @@ const HeaderVisitorUIDKey = "Instill-Visitor-Uid"
 
 const HeaderAuthType = "Instill-Auth-Type"
 
+// HeaderPasswordChangeRequired is set in the response of the authentication
+// methods when the user must change their password before using the other
+// APIs.
+const HeaderPasswordChangeRequired = "Instill-Password-Change-Required"
+
+// HeaderTokenScopes carries the comma-separated scopes of an API token. It's
+// set in the response of ValidateToken and forwarded by the gateway with the
+// requests the token authenticates. It's absent for the unscoped tokens.
+const HeaderTokenScopes = "Instill-Token-Scopes"
+
 const DefaultTokenType = "Bearer"
 const AccessTokenKeyFormat = "access_token:%s:owner_permalink"
 const HeaderAuthorization = "Authorization"
 
+// Client headers forwarded by the gateway
+const HeaderUserAgent = "User-Agent"
+const HeaderGatewayUserAgent = "Grpcgateway-User-Agent"
+const HeaderForwardedFor = "X-Forwarded-For"
+
 const MaxPayloadSize = 1024 * 1024 * 32
 
 // Filter enum
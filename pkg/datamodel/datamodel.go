@@ -3,6 +3,7 @@ package datamodel
 import (
 	"database/sql"
 	"database/sql/driver"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -21,12 +22,9 @@ const (
 	StateInactive TokenState = 1
 	// State: ACTIVE
 	StateActive TokenState = 2
-
-	// In db, we should use current_time < expire_tiem to determine expire or not
-	// We'll convert current_time > expire_tiem to pb's STATE_EXPIRED
-	// This can be improved when the sync between db, redis are more robust
-	// State: EXPIRED
-	// STATE_EXPIRED TokenState = 3
+	// State: EXPIRED. The worker marks the tokens periodically, so an active
+	// token may still be past its expire_time.
+	StateExpired TokenState = 3
 )
 
 type OnboardingStatus mgmtpb.OnboardingStatus
@@ -51,6 +49,7 @@ type Owner struct {
 	ID                     string `gorm:"unique;not null;"`
 	OwnerType              sql.NullString
 	Email                  string `gorm:"unique;not null;"`
+	EmailVerified          bool   `gorm:"default:false"`
 	CustomerID             string
 	DisplayName            sql.NullString
 	CompanyName            sql.NullString
@@ -64,10 +63,19 @@ type Owner struct {
 	OnboardingStatus       OnboardingStatus
 }
 
+// NormalizeEmail returns the form the user emails are stored and compared in.
+// They're unique case-insensitively.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 type Password struct {
 	Base
 	PasswordHash       sql.NullString
 	PasswordUpdateTime time.Time
+	// PasswordChangeRequired is set on the users that must change their
+	// password before using the other APIs, e.g. the seeded admin.
+	PasswordChangeRequired bool
 }
 
 func (Password) TableName() string {
@@ -77,13 +85,48 @@ func (Password) TableName() string {
 // Token defines a api token instance in the database
 type Token struct {
 	Base
-	ID          string
-	Owner       string
-	AccessToken string
-	State       TokenState
-	TokenType   string
-	LastUseTime time.Time
-	ExpireTime  time.Time
+	ID    string
+	Owner string
+	// The token itself isn't stored, it's looked up by its keyed hash and
+	// displayed with its prefix.
+	AccessTokenHash   string
+	AccessTokenPrefix string
+	// The scopes the token is restricted to, it grants the full power of its
+	// owner when there are none.
+	Scopes datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	// The source CIDRs the token is allowed from, it's allowed from any
+	// address when there are none.
+	AllowedCIDRs datatypes.JSONSlice[string] `gorm:"column:allowed_cidrs;type:jsonb"`
+	// The secret a rotated token had before, valid until the end of the
+	// grace period of the rotation.
+	PreviousAccessTokenHash sql.NullString
+	PreviousExpireTime      sql.NullTime
+	State                   TokenState
+	TokenType               string
+	LastUseTime             time.Time
+	LastUseIP               sql.NullString
+	LastUseUserAgent        sql.NullString
+	ExpireTime              time.Time
+	// The rules of the token policy the token doesn't satisfy, flagged by
+	// the worker.
+	PolicyViolations datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+}
+
+// NonExpiringTokenExpireTime is the expiration time of the tokens created
+// without one.
+var NonExpiringTokenExpireTime = time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// NeverExpires tells whether a token was created without an expiration time.
+func (token *Token) NeverExpires() bool {
+	return !token.ExpireTime.Before(NonExpiringTokenExpireTime)
+}
+
+// TokenLastUse is a use of an API token, buffered until it's written to the
+// token.
+type TokenLastUse struct {
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
 }
 
 func (token *Token) BeforeCreate(db *gorm.DB) error {
@@ -126,3 +169,97 @@ type FGAMigration struct {
 func (FGAMigration) TableName() string {
 	return "fga_migrations"
 }
+
+// SigningKey defines a key signing the JWT access tokens in the database
+type SigningKey struct {
+	Base
+	KID        string
+	Algorithm  string
+	PrivateKey string
+	PublicKey  string
+	ExpireTime sql.NullTime
+}
+
+// RefreshTokenFamily defines the chain of refresh tokens issued from a login
+// in the database. Presenting a refresh token that was already used revokes
+// the whole family. A family is the login session of a user, and its UID is
+// the session ID carried by the access tokens.
+type RefreshTokenFamily struct {
+	Base
+	OwnerUID         uuid.UUID
+	UserAgent        string
+	IPAddress        string
+	LastActivityTime time.Time
+	RevokeTime       sql.NullTime
+}
+
+// RefreshToken defines a single-use refresh token in the database. Only the
+// hash of the token is stored.
+type RefreshToken struct {
+	Base
+	FamilyUID  uuid.UUID
+	TokenHash  string
+	UseTime    sql.NullTime
+	ExpireTime time.Time
+}
+
+// PasswordHistory defines a password hash that a user had in the past. The
+// recent ones can't be reused.
+type PasswordHistory struct {
+	Base
+	OwnerUID     uuid.UUID
+	PasswordHash string
+}
+
+// TOTPFactor defines the TOTP second factor of a user. It's pending until a
+// first code is verified, and only required on login once enabled.
+type TOTPFactor struct {
+	Base
+	OwnerUID   uuid.UUID
+	Secret     string
+	EnableTime sql.NullTime
+}
+
+// RecoveryCode defines a single-use code that replaces the TOTP second factor,
+// e.g. when the device is lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	Base
+	OwnerUID uuid.UUID
+	CodeHash string
+	UseTime  sql.NullTime
+}
+
+// PasswordResetToken defines a single-use token sent to a user to reset a
+// forgotten password. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	Base
+	OwnerUID   uuid.UUID
+	TokenHash  string
+	ExpireTime time.Time
+	UseTime    sql.NullTime
+}
+
+// EmailVerificationToken defines a single-use token sent to an email address
+// to prove that a user owns it. The address is either the current email of the
+// user or the one they're changing it to. Only the hash of the token is
+// stored.
+type EmailVerificationToken struct {
+	Base
+	OwnerUID   uuid.UUID
+	Email      string
+	TokenHash  string
+	ExpireTime time.Time
+	UseTime    sql.NullTime
+}
+
+// OwnerIdentity links a user to their identity at an external identity
+// provider, e.g. an OpenID Connect provider they sign in with. The identity is
+// the subject the provider issued for the user. The users and the
+// organizations provisioned through SCIM are recorded the same way.
+type OwnerIdentity struct {
+	Base
+	OwnerUID uuid.UUID
+	Issuer   string
+	Subject  string
+	Email    sql.NullString
+}
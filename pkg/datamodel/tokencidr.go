@@ -0,0 +1,44 @@
+package datamodel
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// NormalizeTokenCIDRs checks the source CIDRs an API token is allowed from
+// and returns them in their canonical form, sorted, without duplicates. An
+// address is allowed alone.
+func NormalizeTokenCIDRs(cidrs []string) ([]string, error) {
+	normalized := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid token CIDR %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		normalized = append(normalized, prefix.Masked().String())
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// TokenCIDRsContain tells whether an address is in the source CIDRs of an API
+// token. The addresses that can't be parsed aren't.
+func TokenCIDRsContain(cidrs []string, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	// The IPv4 clients may be seen as IPv4-mapped IPv6 addresses.
+	addr = addr.Unmap()
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,27 +1,114 @@
 package datamodel
 
 import (
-	"fmt"
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"errors"
+	"hash/crc32"
+	"strings"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seededRand *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
+// The API tokens are formatted as instill_sk_<version>_<random>_<checksum>,
+// so the secret scanners can recognise them. The checksum is the CRC32 of the
+// rest of the token, the mistyped or made up tokens are rejected without
+// being looked up.
+const (
+	tokenPrefix         = "instill_sk_"
+	tokenVersion        = "1"
+	tokenRandomLength   = 32
+	tokenChecksumLength = 6
+	// tokenDisplayLength is the number of random characters a token is
+	// displayed with.
+	tokenDisplayLength = 4
+)
+
+// ErrInvalidToken is returned for the strings that can't be API tokens.
+var ErrInvalidToken = errors.New("invalid API token")
 
-func randomStrWithCharset(length int, charset string) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+// randomStr returns a string of random characters of the charset. A byte is
+// drawn again when it would bias the result towards the first characters.
+func randomStr(length int) string {
+	maxByte := byte(256 - 256%len(charset))
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(b) < length {
+		// It never returns an error.
+		_, _ = rand.Read(buf)
+		for _, c := range buf {
+			if c < maxByte && len(b) < length {
+				b = append(b, charset[int(c)%len(charset)])
+			}
+		}
 	}
 	return string(b)
 }
 
-func randomStr(length int) string {
-	return randomStrWithCharset(length, charset)
-}
+// GenerateToken returns a new API token.
 func GenerateToken() string {
-	return fmt.Sprintf("instill_sk_%s", randomStr(32))
+	body := tokenPrefix + tokenVersion + "_" + randomStr(tokenRandomLength)
+	return body + "_" + tokenChecksum(body)
+}
+
+// tokenChecksum returns the base62 CRC32 of the beginning of a token.
+func tokenChecksum(body string) string {
+	sum := crc32.ChecksumIEEE([]byte(body))
+	b := make([]byte, tokenChecksumLength)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = charset[sum%uint32(len(charset))]
+		sum /= uint32(len(charset))
+	}
+	return string(b)
+}
+
+// CheckToken checks the format and the checksum of an API token. The tokens
+// issued before the versioned format, instill_sk_<random>, have no checksum
+// and are only checked for their format.
+func CheckToken(token string) error {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	parts := strings.Split(rest, "_")
+	switch {
+	case len(parts) == 1:
+		if isRandomStr(parts[0], tokenRandomLength) {
+			return nil
+		}
+	case len(parts) == 3 && parts[0] == tokenVersion && isRandomStr(parts[1], tokenRandomLength):
+		if parts[2] == tokenChecksum(strings.TrimSuffix(token, "_"+parts[2])) {
+			return nil
+		}
+	}
+	return ErrInvalidToken
+}
+
+func isRandomStr(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if strings.IndexByte(charset, c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAPIToken tells whether a credential is meant to be an API token, rather
+// than e.g. the access token of a login session. It isn't checked.
+func IsAPIToken(credential string) bool {
+	return strings.HasPrefix(credential, tokenPrefix)
+}
+
+// TokenPrefix returns the beginning of an API token, which isn't secret and
+// tells the tokens apart when they're listed: the prefix, the version and the
+// first random characters.
+func TokenPrefix(token string) string {
+	n := min(len(tokenPrefix), len(token))
+	if i := strings.IndexByte(token[n:], '_'); i >= 0 {
+		n += i + 1
+	}
+	return token[:min(len(token), n+tokenDisplayLength)]
 }
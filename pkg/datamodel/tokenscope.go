@@ -0,0 +1,58 @@
+package datamodel
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The scopes an API token can be restricted to. A token without scopes grants
+// the full power of its owner. The mgmt scopes are enforced by this service,
+// the others by the backends the gateway forwards the scopes to.
+const (
+	ScopePipelinesRead    = "pipelines:read"
+	ScopePipelinesWrite   = "pipelines:write"
+	ScopePipelinesTrigger = "pipelines:trigger"
+	ScopeModelsRead       = "models:read"
+	ScopeModelsWrite      = "models:write"
+	ScopeModelsTrigger    = "models:trigger"
+	ScopeMgmtRead         = "mgmt:read"
+	ScopeMgmtWrite        = "mgmt:write"
+)
+
+// TokenScopes lists the scopes an API token can be restricted to.
+var TokenScopes = []string{
+	ScopePipelinesRead,
+	ScopePipelinesWrite,
+	ScopePipelinesTrigger,
+	ScopeModelsRead,
+	ScopeModelsWrite,
+	ScopeModelsTrigger,
+	ScopeMgmtRead,
+	ScopeMgmtWrite,
+}
+
+// NormalizeTokenScopes checks the scopes of an API token and returns them
+// sorted, without duplicates.
+func NormalizeTokenScopes(scopes []string) ([]string, error) {
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(TokenScopes, scope) {
+			return nil, fmt.Errorf("unknown token scope %q", scope)
+		}
+		normalized = append(normalized, scope)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// ParseTokenScopes parses the scopes carried by the HeaderTokenScopes header.
+func ParseTokenScopes(header string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(header, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
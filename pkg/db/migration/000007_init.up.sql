@@ -0,0 +1,14 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.signing_key(
+  uid UUID NOT NULL,
+  kid VARCHAR(255) UNIQUE NOT NULL,
+  algorithm VARCHAR(255) NOT NULL,
+  private_key TEXT NOT NULL,
+  public_key TEXT NOT NULL,
+  expire_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT signing_key_pkey PRIMARY KEY (uid)
+);
+CREATE INDEX signing_key_create_time ON public.signing_key (create_time);
+COMMIT;
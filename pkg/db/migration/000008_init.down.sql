@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS public.refresh_token;
+DROP TABLE IF EXISTS public.refresh_token_family;
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.refresh_token_family(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  revoke_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT refresh_token_family_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_refresh_token_family_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE INDEX refresh_token_family_owner_uid ON public.refresh_token_family (owner_uid);
+CREATE TABLE IF NOT EXISTS public.refresh_token(
+  uid UUID NOT NULL,
+  family_uid UUID NOT NULL,
+  token_hash VARCHAR(255) UNIQUE NOT NULL,
+  use_time TIMESTAMPTZ NULL,
+  expire_time TIMESTAMPTZ NOT NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT refresh_token_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_refresh_token_family FOREIGN KEY (family_uid) REFERENCES public.refresh_token_family(uid) ON DELETE CASCADE
+);
+CREATE INDEX refresh_token_family_uid ON public.refresh_token (family_uid);
+COMMIT;
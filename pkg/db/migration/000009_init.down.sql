@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE public.refresh_token_family DROP COLUMN IF EXISTS "user_agent";
+ALTER TABLE public.refresh_token_family DROP COLUMN IF EXISTS "ip_address";
+ALTER TABLE public.refresh_token_family DROP COLUMN IF EXISTS "last_activity_time";
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE public.refresh_token_family ADD COLUMN "user_agent" VARCHAR(1024) DEFAULT '' NOT NULL;
+ALTER TABLE public.refresh_token_family ADD COLUMN "ip_address" VARCHAR(255) DEFAULT '' NOT NULL;
+ALTER TABLE public.refresh_token_family ADD COLUMN "last_activity_time" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL;
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.password_history(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  password_hash VARCHAR(255) NOT NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT password_history_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_password_history_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE INDEX password_history_owner_uid_create_time ON public.password_history (owner_uid, create_time DESC);
+COMMIT;
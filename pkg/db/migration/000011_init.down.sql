@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE public.owner DROP COLUMN IF EXISTS "password_change_required";
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE public.owner ADD COLUMN "password_change_required" BOOLEAN DEFAULT FALSE NOT NULL;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS public.recovery_code;
+DROP TABLE IF EXISTS public.totp_factor;
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.totp_factor(
+  uid UUID NOT NULL,
+  owner_uid UUID UNIQUE NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  enable_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT totp_factor_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_totp_factor_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS public.recovery_code(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  code_hash VARCHAR(255) NOT NULL,
+  use_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT recovery_code_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_recovery_code_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX recovery_code_owner_uid_code_hash ON public.recovery_code (owner_uid, code_hash);
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS public.password_reset_token;
+COMMIT;
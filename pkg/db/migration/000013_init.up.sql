@@ -0,0 +1,14 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.password_reset_token(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  token_hash VARCHAR(255) UNIQUE NOT NULL,
+  expire_time TIMESTAMPTZ NOT NULL,
+  use_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT password_reset_token_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_password_reset_token_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE INDEX password_reset_token_owner_uid ON public.password_reset_token (owner_uid);
+COMMIT;
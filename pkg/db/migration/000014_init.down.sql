@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS public.email_verification_token;
+ALTER TABLE public.owner DROP COLUMN IF EXISTS "email_verified";
+COMMIT;
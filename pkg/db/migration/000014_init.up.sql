@@ -0,0 +1,19 @@
+BEGIN;
+ALTER TABLE public.owner ADD COLUMN "email_verified" BOOLEAN DEFAULT FALSE NOT NULL;
+-- The addresses of the existing users were trusted before verification was
+-- introduced, so they keep working for password resets.
+UPDATE public.owner SET email_verified = TRUE WHERE owner_type = 'user' AND email IS NOT NULL AND email <> '';
+CREATE TABLE IF NOT EXISTS public.email_verification_token(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  token_hash VARCHAR(255) UNIQUE NOT NULL,
+  expire_time TIMESTAMPTZ NOT NULL,
+  use_time TIMESTAMPTZ NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT email_verification_token_pkey PRIMARY KEY (uid),
+  CONSTRAINT fk_email_verification_token_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE INDEX email_verification_token_owner_uid ON public.email_verification_token (owner_uid);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP INDEX IF EXISTS public.email_unique;
+CREATE UNIQUE INDEX email_unique ON public.owner (email) WHERE (owner_type = 'user');
+COMMIT;
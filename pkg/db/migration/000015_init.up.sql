@@ -0,0 +1,6 @@
+BEGIN;
+UPDATE public.owner SET email = lower(trim(email)) WHERE owner_type = 'user' AND email <> lower(trim(email));
+UPDATE public.email_verification_token SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+DROP INDEX IF EXISTS public.email_unique;
+CREATE UNIQUE INDEX email_unique ON public.owner (lower(email)) WHERE (owner_type = 'user');
+COMMIT;
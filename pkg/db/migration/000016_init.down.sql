@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS public.owner_identity;
+COMMIT;
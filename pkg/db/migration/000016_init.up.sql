@@ -0,0 +1,15 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS public.owner_identity(
+  uid UUID NOT NULL,
+  owner_uid UUID NOT NULL,
+  issuer VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NULL,
+  create_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT owner_identity_pkey PRIMARY KEY (uid),
+  CONSTRAINT owner_identity_issuer_subject UNIQUE (issuer, subject),
+  CONSTRAINT fk_owner_identity_owner FOREIGN KEY (owner_uid) REFERENCES public.owner(uid) ON DELETE CASCADE
+);
+CREATE INDEX owner_identity_owner_uid ON public.owner_identity (owner_uid);
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+DROP INDEX IF EXISTS token_access_token_hash;
+ALTER TABLE public.token DROP COLUMN IF EXISTS access_token_prefix;
+ALTER TABLE public.token DROP COLUMN IF EXISTS access_token_hash;
+COMMIT;
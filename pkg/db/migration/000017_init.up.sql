@@ -0,0 +1,7 @@
+BEGIN;
+-- The existing tokens are hashed by the code migration, the clear-text
+-- column is dropped in the next version.
+ALTER TABLE public.token ADD COLUMN access_token_hash VARCHAR(64) NULL;
+ALTER TABLE public.token ADD COLUMN access_token_prefix VARCHAR(32) DEFAULT '' NOT NULL;
+CREATE UNIQUE INDEX token_access_token_hash ON public.token (access_token_hash);
+COMMIT;
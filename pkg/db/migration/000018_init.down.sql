@@ -0,0 +1,5 @@
+BEGIN;
+-- The tokens can't be restored from their hashes, they must be recreated.
+ALTER TABLE public.token ALTER COLUMN access_token_hash DROP NOT NULL;
+ALTER TABLE public.token ADD COLUMN access_token VARCHAR(255) UNIQUE;
+COMMIT;
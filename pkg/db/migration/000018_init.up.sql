@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE public.token DROP COLUMN access_token;
+ALTER TABLE public.token ALTER COLUMN access_token_hash SET NOT NULL;
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+-- An enum value can't be dropped, the type is recreated without it. The
+-- expired tokens are still refused by their expiration time.
+UPDATE public.token SET state = 'STATE_ACTIVE' WHERE state = 'STATE_EXPIRED';
+ALTER TABLE public.token ALTER COLUMN state DROP DEFAULT;
+ALTER TYPE valid_api_token_state RENAME TO valid_api_token_state_old;
+CREATE TYPE valid_api_token_state AS ENUM (
+  'STATE_UNSPECIFIED',
+  'STATE_INACTIVE',
+  'STATE_ACTIVE'
+);
+ALTER TABLE public.token ALTER COLUMN state TYPE valid_api_token_state USING state::text::valid_api_token_state;
+ALTER TABLE public.token ALTER COLUMN state SET DEFAULT 'STATE_UNSPECIFIED';
+DROP TYPE valid_api_token_state_old;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+-- The tokens past their expiration are marked by the mgmt worker.
+ALTER TYPE valid_api_token_state ADD VALUE IF NOT EXISTS 'STATE_EXPIRED';
+COMMIT;
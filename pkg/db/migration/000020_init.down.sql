@@ -0,0 +1,6 @@
+BEGIN;
+-- The scoped tokens are deactivated rather than granted the full power of
+-- their owner.
+UPDATE public.token SET state = 'STATE_INACTIVE' WHERE scopes <> '[]';
+ALTER TABLE public.token DROP COLUMN IF EXISTS scopes;
+COMMIT;
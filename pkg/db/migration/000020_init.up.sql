@@ -0,0 +1,4 @@
+BEGIN;
+-- The tokens without scopes grant the full power of their owner.
+ALTER TABLE public.token ADD COLUMN scopes JSONB DEFAULT '[]' NOT NULL;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+DROP INDEX IF EXISTS token_previous_access_token_hash;
+ALTER TABLE public.token DROP COLUMN IF EXISTS previous_expire_time;
+ALTER TABLE public.token DROP COLUMN IF EXISTS previous_access_token_hash;
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+-- The previous secret of a rotated token is valid until the end of the grace
+-- period, it's cleared by the mgmt worker afterwards.
+ALTER TABLE public.token ADD COLUMN previous_access_token_hash VARCHAR(64) NULL;
+ALTER TABLE public.token ADD COLUMN previous_expire_time TIMESTAMPTZ NULL;
+CREATE INDEX token_previous_access_token_hash ON public.token (previous_access_token_hash);
+COMMIT;
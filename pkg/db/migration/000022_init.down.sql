@@ -0,0 +1,7 @@
+BEGIN;
+-- The tokens restricted to source CIDRs are deactivated rather than allowed
+-- from any address.
+UPDATE public.token SET state = 'STATE_INACTIVE' WHERE allowed_cidrs NOT IN ('[]', 'null');
+ALTER TABLE public.token DROP COLUMN IF EXISTS last_use_ip;
+ALTER TABLE public.token DROP COLUMN IF EXISTS allowed_cidrs;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+-- The tokens without source CIDRs are allowed from any address.
+ALTER TABLE public.token ADD COLUMN allowed_cidrs JSONB DEFAULT '[]' NOT NULL;
+ALTER TABLE public.token ADD COLUMN last_use_ip VARCHAR(45) NULL;
+COMMIT;
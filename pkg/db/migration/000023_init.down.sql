@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE public.token DROP COLUMN IF EXISTS last_use_user_agent;
+COMMIT;
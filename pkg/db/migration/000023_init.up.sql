@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE public.token ADD COLUMN last_use_user_agent VARCHAR(1024) NULL;
+COMMIT;
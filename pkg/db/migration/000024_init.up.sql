@@ -0,0 +1,5 @@
+BEGIN;
+-- The rules of the token policy a token doesn't satisfy, flagged by the mgmt
+-- worker.
+ALTER TABLE public.token ADD COLUMN policy_violations JSONB DEFAULT '[]' NOT NULL;
+COMMIT;
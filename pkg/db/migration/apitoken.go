@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+)
+
+// hashAPITokens replaces the API tokens stored in clear text with their
+// SHA-256 hash and their prefix. The tokens keep working, they're looked up by
+// their hash from now on.
+func hashAPITokens(db *gorm.DB, logger *zap.Logger) error {
+	var tokens []struct {
+		UID         uuid.UUID
+		AccessToken string
+	}
+	if err := db.Raw("SELECT uid, access_token FROM public.token WHERE access_token IS NOT NULL").Scan(&tokens).Error; err != nil {
+		return fmt.Errorf("listing API tokens: %w", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, token := range tokens {
+			sum := sha256.Sum256([]byte(token.AccessToken))
+			if err := tx.Exec(
+				"UPDATE public.token SET access_token_hash = ?, access_token_prefix = ?, access_token = NULL WHERE uid = ?",
+				hex.EncodeToString(sum[:]), datamodel.TokenPrefix(token.AccessToken), token.UID,
+			).Error; err != nil {
+				return fmt.Errorf("hashing API token %s: %w", token.UID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Hashed API tokens", zap.Int("count", len(tokens)))
+	return nil
+}
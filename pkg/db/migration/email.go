@@ -0,0 +1,47 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// emailConflict is a set of users whose emails only differ by case or
+// surrounding spaces.
+type emailConflict struct {
+	Email string
+	IDs   string
+}
+
+// checkEmailConflicts reports the users whose emails are the same once
+// normalized, as they can't be made unique case-insensitively. They must be
+// resolved by hand, e.g. by changing or deleting the duplicated accounts.
+func checkEmailConflicts(db *gorm.DB, logger *zap.Logger) error {
+	var conflicts []emailConflict
+	if err := db.Raw(`
+		SELECT lower(trim(email)) AS email, string_agg(id, ', ' ORDER BY create_time) AS ids
+		FROM public.owner
+		WHERE owner_type = 'user' AND email IS NOT NULL
+		GROUP BY lower(trim(email))
+		HAVING count(*) > 1
+	`).Scan(&conflicts).Error; err != nil {
+		return fmt.Errorf("checking email conflicts: %w", err)
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	emails := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		logger.Error("Users share the same email",
+			zap.String("email", c.Email),
+			zap.String("userIDs", c.IDs),
+		)
+		emails = append(emails, c.Email)
+	}
+
+	return fmt.Errorf("found %d emails shared by several users (%s), resolve them before migrating", len(conflicts), strings.Join(emails, ", "))
+}
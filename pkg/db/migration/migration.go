@@ -14,7 +14,7 @@ import (
 )
 
 // TargetSchemaVersion determines the database schema version.
-const TargetSchemaVersion = 6
+const TargetSchemaVersion = 24
 
 type migration interface {
 	Migrate() error
@@ -45,6 +45,8 @@ func (cm *CodeMigrator) Migrate(version uint) error {
 			Logger: cm.Logger,
 			Config: cm.Config,
 		}
+	case 17:
+		return hashAPITokens(cm.DB, cm.Logger)
 	default:
 		return nil
 	}
@@ -52,6 +54,19 @@ func (cm *CodeMigrator) Migrate(version uint) error {
 	return m.Migrate()
 }
 
+// Check verifies that the database can be migrated to a version before its
+// schema changes are applied. A schema migration failing halfway leaves the
+// database with a dirty flag, so the data it can't handle is reported upfront
+// instead.
+func (cm *CodeMigrator) Check(version uint) error {
+	switch version {
+	case 15:
+		return checkEmailConflicts(cm.DB, cm.Logger)
+	default:
+		return nil
+	}
+}
+
 // FGAMigration handles the migration of OpenFGA store_id and authorization_model_id
 type FGAMigration struct {
 	DB     *gorm.DB
@@ -0,0 +1,86 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// version prefixes the encrypted secrets, so the stored values can be told
+// apart from the ones stored before they were encrypted.
+const version = "v1:"
+
+// ErrDecrypt is returned when a secret can't be decrypted, e.g. because the
+// key changed.
+var ErrDecrypt = errors.New("decrypting secret")
+
+// Cipher encrypts the secrets stored in the database, e.g. the private keys
+// signing the access tokens and the TOTP secrets.
+type Cipher interface {
+	// Encrypt returns the encrypted secret, encoded as text.
+	Encrypt(plaintext []byte) (string, error)
+	// Decrypt returns a secret returned by Encrypt.
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+type aesGCM struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns an AES-256-GCM cipher, the encryption key is derived from
+// the configured one.
+func NewCipher(key string) (Cipher, error) {
+	if key == "" {
+		return nil, fmt.Errorf("encryption key is required")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesGCM{aead: aead}, nil
+}
+
+func (c *aesGCM) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	return version + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *aesGCM) Decrypt(ciphertext string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(ciphertext, version)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format", ErrDecrypt)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid encoding", ErrDecrypt)
+	}
+
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted tells the values returned by Encrypt apart from the secrets
+// stored in plaintext before they were encrypted.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, version)
+}
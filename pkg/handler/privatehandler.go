@@ -204,3 +204,85 @@ func (h *PrivateHandler) CheckNamespaceAdmin(ctx context.Context, req *mgmtpb.Ch
 		Type: mgmtpb.CheckNamespaceAdminResponse_NAMESPACE_AVAILABLE,
 	}, nil
 }
+
+// ListSessionsAdmin lists the active login sessions of a user
+func (h *PrivateHandler) ListSessionsAdmin(ctx context.Context, in *ListSessionsAdminRequest) (*ListSessionsAdminResponse, error) {
+	userID, err := parseUserIDFromName(in.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	userUID, err := h.Service.GetUserUIDByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := h.Service.ListSessions(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListSessionsAdminResponse{Sessions: sessions2PBSessions(fmt.Sprintf("%s/sessions", in.Parent), sessions)}, nil
+}
+
+// RevokeSessionAdmin ends a login session of a user
+func (h *PrivateHandler) RevokeSessionAdmin(ctx context.Context, in *RevokeSessionAdminRequest) (*RevokeSessionAdminResponse, error) {
+	parts := strings.Split(in.Name, "/")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%w: invalid session name format, expected users/{user_id}/sessions/{session}", errorsx.ErrInvalidArgument)
+	}
+
+	sessionUID, err := parseSessionUIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	userUID, err := h.Service.GetUserUIDByID(ctx, parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.RevokeSession(ctx, userUID, sessionUID); err != nil {
+		return nil, err
+	}
+
+	return &RevokeSessionAdminResponse{}, nil
+}
+
+// RevokeAllSessionsAdmin ends all the login sessions of a user
+func (h *PrivateHandler) RevokeAllSessionsAdmin(ctx context.Context, in *RevokeAllSessionsAdminRequest) (*RevokeAllSessionsAdminResponse, error) {
+	userID, err := parseUserIDFromName(in.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	userUID, err := h.Service.GetUserUIDByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.RevokeSessions(ctx, userUID); err != nil {
+		return nil, err
+	}
+
+	return &RevokeAllSessionsAdminResponse{}, nil
+}
+
+// UnlockUserAdmin lifts the login lockout of a user
+func (h *PrivateHandler) UnlockUserAdmin(ctx context.Context, in *UnlockUserAdminRequest) (*UnlockUserAdminResponse, error) {
+	userID, err := parseUserIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	userUID, err := h.Service.GetUserUIDByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.UnlockUserAdmin(ctx, userUID); err != nil {
+		return nil, err
+	}
+
+	return &UnlockUserAdminResponse{}, nil
+}
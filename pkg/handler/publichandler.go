@@ -74,6 +74,10 @@ func (h *PublicHandler) AuthenticateUser(ctx context.Context, in *mgmtpb.Authent
 		return nil, err
 	}
 
+	if err := h.setPasswordChangeRequiredHeader(ctx, userUID); err != nil {
+		return nil, err
+	}
+
 	return &mgmtpb.AuthenticateUserResponse{
 		UserUid: userUID.String(),
 	}, nil
@@ -100,6 +104,112 @@ func (h *PublicHandler) AuthChangePassword(ctx context.Context, in *mgmtpb.AuthC
 	return &mgmtpb.AuthChangePasswordResponse{}, nil
 }
 
+// AuthTokenIssuer validates the user credentials and returns the claims of an
+// access token for the caller to sign.
+func (h *PublicHandler) AuthTokenIssuer(ctx context.Context, in *AuthTokenIssuerRequest) (*AuthTokenIssuerResponse, error) {
+	claims, err := h.Service.AuthTokenIssuer(ctx, in.Username, in.Password, in.MFACode)
+	if err != nil {
+		return nil, err
+	}
+
+	var aud string
+	if len(claims.Audience) > 0 {
+		aud = claims.Audience[0]
+	}
+
+	return &AuthTokenIssuerResponse{
+		AccessToken: &UnsignedAccessToken{
+			Aud: aud,
+			Iss: claims.Issuer,
+			Sub: claims.Subject,
+			Jti: claims.ID,
+			Exp: claims.ExpiresAt.Unix(),
+		},
+	}, nil
+}
+
+// AuthLogin authenticates a user and returns an access token.
+func (h *PublicHandler) AuthLogin(ctx context.Context, in *AuthLoginRequest) (*AuthLoginResponse, error) {
+	tokens, err := h.Service.AuthLogin(ctx, in.Username, in.Password, in.MFACode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthLoginResponse{
+		AccessToken:            tokens.AccessToken,
+		RefreshToken:           tokens.RefreshToken,
+		PasswordChangeRequired: tokens.PasswordChangeRequired,
+	}, nil
+}
+
+// AuthRefresh exchanges a refresh token for a new pair of tokens.
+func (h *PublicHandler) AuthRefresh(ctx context.Context, in *AuthRefreshRequest) (*AuthRefreshResponse, error) {
+	if in.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: refresh token is required", errorsx.ErrInvalidArgument)
+	}
+
+	tokens, err := h.Service.AuthRefresh(ctx, in.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthRefreshResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// AuthLogout revokes the access token of the request and ends its session.
+func (h *PublicHandler) AuthLogout(ctx context.Context, in *AuthLogoutRequest) (*AuthLogoutResponse, error) {
+
+	authorization := resource.GetRequestSingleHeader(ctx, constant.HeaderAuthorization)
+	accessToken := strings.Replace(authorization, "Bearer ", "", 1)
+
+	if err := h.Service.AuthLogout(ctx, accessToken); err != nil {
+		return nil, err
+	}
+
+	return &AuthLogoutResponse{}, nil
+}
+
+// AuthValidateAccessToken checks the access token of the request.
+func (h *PublicHandler) AuthValidateAccessToken(ctx context.Context, in *AuthValidateAccessTokenRequest) (*AuthValidateAccessTokenResponse, error) {
+
+	authorization := resource.GetRequestSingleHeader(ctx, constant.HeaderAuthorization)
+	accessToken := strings.Replace(authorization, "Bearer ", "", 1)
+
+	userUID, err := h.Service.AuthValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.Service.GetUserByUIDAdmin(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChangeRequired, err := h.Service.IsPasswordChangeRequired(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthValidateAccessTokenResponse{
+		User:                   fmt.Sprintf("users/%s", user.Id),
+		PasswordChangeRequired: passwordChangeRequired,
+	}, nil
+}
+
+// setPasswordChangeRequiredHeader tells the gateway, through the response
+// headers, whether the authenticated user must change their password.
+func (h *PublicHandler) setPasswordChangeRequiredHeader(ctx context.Context, userUID uuid.UUID) error {
+	passwordChangeRequired, err := h.Service.IsPasswordChangeRequired(ctx, userUID)
+	if err != nil {
+		return err
+	}
+
+	return grpc.SetHeader(ctx, metadata.Pairs(constant.HeaderPasswordChangeRequired, strconv.FormatBool(passwordChangeRequired)))
+}
+
 // ListUsers lists the users.
 func (h *PublicHandler) ListUsers(ctx context.Context, req *mgmtpb.ListUsersRequest) (*mgmtpb.ListUsersResponse, error) {
 
@@ -295,46 +405,83 @@ func (h *PublicHandler) CreateToken(ctx context.Context, req *mgmtpb.CreateToken
 		return nil, err
 	}
 
-	// Set all OUTPUT_ONLY fields to zero value on the requested payload token resource
-	if err := checkfield.CheckCreateOutputOnlyFields(req.Token, outputOnlyFieldsForToken); err != nil {
-		return &mgmtpb.CreateTokenResponse{}, errorsx.ErrCheckOutputOnlyFields
+	pbCreatedToken, err := h.createToken(ctx, ctxUserUID, req.Token, nil)
+	if err != nil {
+		return &mgmtpb.CreateTokenResponse{}, err
 	}
 
-	// Return error if REQUIRED fields are not provided in the requested payload token resource
-	if err := checkfield.CheckRequiredFields(req.Token, createRequiredFieldsForToken); err != nil {
-		return &mgmtpb.CreateTokenResponse{}, errorsx.ErrCheckRequiredFields
+	resp := &mgmtpb.CreateTokenResponse{
+		Token: pbCreatedToken,
 	}
 
-	// Return error if resource ID does not follow RFC-1034
-	if err := checkfield.CheckResourceID(req.Token.GetId()); err != nil {
-		return &mgmtpb.CreateTokenResponse{}, errorsx.ErrResourceID
+	// Manually set the custom header to have a StatusCreated http response for REST endpoint
+	if err := grpc.SetHeader(ctx, metadata.Pairs("x-http-code", strconv.Itoa(http.StatusCreated))); err != nil {
+		return nil, err
 	}
 
-	// Return error if expiration is not provided
-	if req.Token.GetExpiration() == nil {
-		return &mgmtpb.CreateTokenResponse{}, errorsx.ErrCheckRequiredFields
+	return resp, nil
+}
+
+// CreateRestrictedToken creates an API token restricted to a set of scopes
+// and source CIDRs.
+func (h *PublicHandler) CreateRestrictedToken(ctx context.Context, in *CreateRestrictedTokenRequest) (*CreateRestrictedTokenResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Token == nil {
+		return nil, errorsx.ErrCheckRequiredFields
+	}
+	if in.Restrictions == nil {
+		in.Restrictions = &TokenRestrictions{}
 	}
 
-	err = h.Service.CreateToken(ctx, ctxUserUID, req.Token)
+	pbCreatedToken, err := h.createToken(ctx, ctxUserUID, in.Token.pbToken(), &service.TokenRestrictions{
+		Scopes:       in.Restrictions.Scopes,
+		AllowedCIDRs: in.Restrictions.AllowedCIDRs,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	pbCreatedToken, err := h.Service.GetToken(ctx, ctxUserUID, req.Token.Id)
+	restrictions, err := h.Service.GetTokenRestrictions(ctx, ctxUserUID, pbCreatedToken.GetId())
 	if err != nil {
 		return nil, err
 	}
 
-	resp := &mgmtpb.CreateTokenResponse{
-		Token: pbCreatedToken,
+	return &CreateRestrictedTokenResponse{
+		Token:        pbToken2APIToken(pbCreatedToken),
+		Restrictions: tokenRestrictions2PB(pbCreatedToken.GetName(), restrictions),
+	}, nil
+}
+
+// createToken checks the requested token and creates it. The token is only
+// returned once, it can't be read back.
+func (h *PublicHandler) createToken(ctx context.Context, ctxUserUID uuid.UUID, token *mgmtpb.ApiToken, restrictions *service.TokenRestrictions) (*mgmtpb.ApiToken, error) {
+
+	// Set all OUTPUT_ONLY fields to zero value on the requested payload token resource
+	if err := checkfield.CheckCreateOutputOnlyFields(token, outputOnlyFieldsForToken); err != nil {
+		return nil, errorsx.ErrCheckOutputOnlyFields
 	}
 
-	// Manually set the custom header to have a StatusCreated http response for REST endpoint
-	if err := grpc.SetHeader(ctx, metadata.Pairs("x-http-code", strconv.Itoa(http.StatusCreated))); err != nil {
-		return nil, err
+	// Return error if REQUIRED fields are not provided in the requested payload token resource
+	if err := checkfield.CheckRequiredFields(token, createRequiredFieldsForToken); err != nil {
+		return nil, errorsx.ErrCheckRequiredFields
 	}
 
-	return resp, nil
+	// Return error if resource ID does not follow RFC-1034
+	if err := checkfield.CheckResourceID(token.GetId()); err != nil {
+		return nil, errorsx.ErrResourceID
+	}
+
+	// Return error if expiration is not provided
+	if token.GetExpiration() == nil {
+		return nil, errorsx.ErrCheckRequiredFields
+	}
+
+	return h.Service.CreateToken(ctx, ctxUserUID, token, restrictions)
 }
 
 // ListTokens lists all the API tokens of the authenticated user.
@@ -345,7 +492,7 @@ func (h *PublicHandler) ListTokens(ctx context.Context, req *mgmtpb.ListTokensRe
 		return nil, err
 	}
 
-	pbTokens, totalSize, nextPageToken, err := h.Service.ListTokens(ctx, ctxUserUID, int64(req.GetPageSize()), req.GetPageToken())
+	pbTokens, totalSize, nextPageToken, err := h.Service.ListTokens(ctx, ctxUserUID, int64(req.GetPageSize()), req.GetPageToken(), mgmtpb.ApiToken_STATE_UNSPECIFIED)
 	if err != nil {
 		return &mgmtpb.ListTokensResponse{}, err
 	}
@@ -358,6 +505,37 @@ func (h *PublicHandler) ListTokens(ctx context.Context, req *mgmtpb.ListTokensRe
 	return resp, nil
 }
 
+// FilterTokens lists the API tokens of the authenticated user in a state, or
+// all of them when the state is empty.
+func (h *PublicHandler) FilterTokens(ctx context.Context, in *FilterTokensRequest) (*mgmtpb.ListTokensResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	state := mgmtpb.ApiToken_STATE_UNSPECIFIED
+	if in.State != "" {
+		v, ok := mgmtpb.ApiToken_State_value[in.State]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid token state %q", errorsx.ErrInvalidArgument, in.State)
+		}
+		state = mgmtpb.ApiToken_State(v)
+	}
+
+	pbTokens, totalSize, nextPageToken, err := h.Service.ListTokens(ctx, ctxUserUID, int64(in.PageSize), in.PageToken, state)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &mgmtpb.ListTokensResponse{
+		Tokens:        pbTokens,
+		NextPageToken: nextPageToken,
+		TotalSize:     int32(totalSize),
+	}
+	return resp, nil
+}
+
 // GetToken gets an API token of the authenticated user. This endpoint is not supported yet.
 func (h *PublicHandler) GetToken(ctx context.Context, req *mgmtpb.GetTokenRequest) (*mgmtpb.GetTokenResponse, error) {
 
@@ -384,6 +562,92 @@ func (h *PublicHandler) GetToken(ctx context.Context, req *mgmtpb.GetTokenReques
 	return resp, nil
 }
 
+// GetTokenRestrictions gets what an API token of the authenticated user is
+// restricted to.
+func (h *PublicHandler) GetTokenRestrictions(ctx context.Context, in *GetTokenRestrictionsRequest) (*GetTokenRestrictionsResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenName := strings.TrimSuffix(in.Name, "/restrictions")
+	tokenID, err := parseTokenIDFromName(tokenName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	restrictions, err := h.Service.GetTokenRestrictions(ctx, ctxUserUID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetTokenRestrictionsResponse{Restrictions: tokenRestrictions2PB(tokenName, restrictions)}, nil
+}
+
+// RotateToken issues a new secret for an API token of the authenticated user.
+func (h *PublicHandler) RotateToken(ctx context.Context, in *RotateTokenRequest) (*RotateTokenResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, err := parseTokenIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	pbToken, err := h.Service.RotateToken(ctx, ctxUserUID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RotateTokenResponse{Token: pbToken2APIToken(pbToken)}, nil
+}
+
+// DeactivateToken suspends an API token of the authenticated user.
+func (h *PublicHandler) DeactivateToken(ctx context.Context, in *DeactivateTokenRequest) (*DeactivateTokenResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, err := parseTokenIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	pbToken, err := h.Service.DeactivateToken(ctx, ctxUserUID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeactivateTokenResponse{Token: pbToken2APIToken(pbToken)}, nil
+}
+
+// ActivateToken resumes an inactive API token of the authenticated user.
+func (h *PublicHandler) ActivateToken(ctx context.Context, in *ActivateTokenRequest) (*ActivateTokenResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, err := parseTokenIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	pbToken, err := h.Service.ActivateToken(ctx, ctxUserUID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActivateTokenResponse{Token: pbToken2APIToken(pbToken)}, nil
+}
+
 // DeleteToken deletes an API token of the authenticated user. This endpoint is not supported yet.
 func (h *PublicHandler) DeleteToken(ctx context.Context, req *mgmtpb.DeleteTokenRequest) (*mgmtpb.DeleteTokenResponse, error) {
 
@@ -416,19 +680,248 @@ func (h *PublicHandler) DeleteToken(ctx context.Context, req *mgmtpb.DeleteToken
 	return &mgmtpb.DeleteTokenResponse{}, nil
 }
 
+// ListSessions lists the active login sessions of the authenticated user.
+func (h *PublicHandler) ListSessions(ctx context.Context, _ *ListSessionsRequest) (*ListSessionsResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := h.Service.ListSessions(ctx, ctxUserUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListSessionsResponse{Sessions: sessions2PBSessions("sessions", sessions)}, nil
+}
+
+// RevokeSession ends a login session of the authenticated user.
+func (h *PublicHandler) RevokeSession(ctx context.Context, in *RevokeSessionRequest) (*RevokeSessionResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionUID, err := parseSessionUIDFromName(in.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+
+	if err := h.Service.RevokeSession(ctx, ctxUserUID, sessionUID); err != nil {
+		return nil, err
+	}
+
+	return &RevokeSessionResponse{}, nil
+}
+
+// RevokeAllSessions ends all the login sessions of the authenticated user,
+// including the one of the request.
+func (h *PublicHandler) RevokeAllSessions(ctx context.Context, _ *RevokeAllSessionsRequest) (*RevokeAllSessionsResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.RevokeSessions(ctx, ctxUserUID); err != nil {
+		return nil, err
+	}
+
+	return &RevokeAllSessionsResponse{}, nil
+}
+
+// EnrollMFA starts the enrollment of a TOTP second factor
+func (h *PublicHandler) EnrollMFA(ctx context.Context, _ *EnrollMFARequest) (*EnrollMFAResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := h.Service.EnrollMFA(ctx, ctxUserUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EnrollMFAResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	}, nil
+}
+
+// VerifyMFA verifies a first code of the enrolled second factor and enables it
+func (h *PublicHandler) VerifyMFA(ctx context.Context, in *VerifyMFARequest) (*VerifyMFAResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := h.Service.VerifyMFA(ctx, ctxUserUID, in.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyMFAResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// DisableMFA removes the second factor of the user
+func (h *PublicHandler) DisableMFA(ctx context.Context, in *DisableMFARequest) (*DisableMFAResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.DisableMFA(ctx, ctxUserUID, in.Code); err != nil {
+		return nil, err
+	}
+
+	return &DisableMFAResponse{}, nil
+}
+
+// RequestPasswordReset sends a password reset link to the email of a user
+func (h *PublicHandler) RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest) (*RequestPasswordResetResponse, error) {
+	if in.Email == "" {
+		return nil, fmt.Errorf("%w: email is required", errorsx.ErrInvalidArgument)
+	}
+
+	if err := h.Service.RequestPasswordReset(ctx, in.Email); err != nil {
+		return nil, err
+	}
+
+	return &RequestPasswordResetResponse{}, nil
+}
+
+// ConfirmPasswordReset sets a new password with a password reset token
+func (h *PublicHandler) ConfirmPasswordReset(ctx context.Context, in *ConfirmPasswordResetRequest) (*ConfirmPasswordResetResponse, error) {
+	if in.Token == "" {
+		return nil, fmt.Errorf("%w: token is required", errorsx.ErrInvalidArgument)
+	}
+
+	if err := h.Service.ConfirmPasswordReset(ctx, in.Token, in.NewPassword); err != nil {
+		return nil, err
+	}
+
+	return &ConfirmPasswordResetResponse{}, nil
+}
+
+// GetEmailStatus returns the email of the user and its verification state
+func (h *PublicHandler) GetEmailStatus(ctx context.Context, _ *GetEmailStatusRequest) (*GetEmailStatusResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	emailStatus, err := h.Service.GetEmailStatus(ctx, ctxUserUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetEmailStatusResponse{
+		Email:        emailStatus.Email,
+		Verified:     emailStatus.Verified,
+		PendingEmail: emailStatus.PendingEmail,
+	}, nil
+}
+
+// SendEmailVerification sends a verification link to the email of the user
+func (h *PublicHandler) SendEmailVerification(ctx context.Context, _ *SendEmailVerificationRequest) (*SendEmailVerificationResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.SendEmailVerification(ctx, ctxUserUID); err != nil {
+		return nil, err
+	}
+
+	return &SendEmailVerificationResponse{}, nil
+}
+
+// RequestEmailChange sends a verification link to the new email of the user
+func (h *PublicHandler) RequestEmailChange(ctx context.Context, in *RequestEmailChangeRequest) (*RequestEmailChangeResponse, error) {
+
+	ctxUserUID, err := h.Service.ExtractCtxUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Service.RequestEmailChange(ctx, ctxUserUID, in.Email); err != nil {
+		return nil, err
+	}
+
+	return &RequestEmailChangeResponse{}, nil
+}
+
+// ConfirmEmail verifies an email with an email verification token
+func (h *PublicHandler) ConfirmEmail(ctx context.Context, in *ConfirmEmailRequest) (*ConfirmEmailResponse, error) {
+	if in.Token == "" {
+		return nil, fmt.Errorf("%w: token is required", errorsx.ErrInvalidArgument)
+	}
+
+	if err := h.Service.ConfirmEmail(ctx, in.Token); err != nil {
+		return nil, err
+	}
+
+	return &ConfirmEmailResponse{}, nil
+}
+
+// AuthOIDCAuthorize starts a login through the OIDC provider
+func (h *PublicHandler) AuthOIDCAuthorize(ctx context.Context, _ *AuthOIDCAuthorizeRequest) (*AuthOIDCAuthorizeResponse, error) {
+	authorizationURL, binding, err := h.Service.AuthOIDCAuthorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthOIDCAuthorizeResponse{AuthorizationURL: authorizationURL, Binding: binding}, nil
+}
+
+// AuthOIDCLogin completes a login through the OIDC provider and starts a
+// login session
+func (h *PublicHandler) AuthOIDCLogin(ctx context.Context, in *AuthOIDCLoginRequest) (*AuthLoginResponse, error) {
+	if in.Code == "" || in.State == "" || in.Binding == "" {
+		return nil, fmt.Errorf("%w: code, state and binding are required", errorsx.ErrInvalidArgument)
+	}
+
+	tokens, err := h.Service.AuthOIDCLogin(ctx, in.Code, in.State, in.Binding)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthLoginResponse{
+		AccessToken:            tokens.AccessToken,
+		RefreshToken:           tokens.RefreshToken,
+		PasswordChangeRequired: tokens.PasswordChangeRequired,
+	}, nil
+}
+
 // ValidateToken validate the token
 func (h *PublicHandler) ValidateToken(ctx context.Context, req *mgmtpb.ValidateTokenRequest) (*mgmtpb.ValidateTokenResponse, error) {
 
 	authorization := resource.GetRequestSingleHeader(ctx, constant.HeaderAuthorization)
 	apiToken := strings.Replace(authorization, "Bearer ", "", 1)
 
-	userUID, err := h.Service.ValidateToken(ctx, apiToken)
+	clientIP := resource.GetRequestClientIP(ctx)
+	userUID, scopes, err := h.Service.ValidateToken(ctx, apiToken, clientIP)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = h.Service.UpdateTokenLastUseTime(ctx, apiToken)
+	// The gateway forwards the scopes with the requests the token
+	// authenticates, for the backends to enforce them.
+	if len(scopes) > 0 {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(constant.HeaderTokenScopes, strings.Join(scopes, ","))); err != nil {
+			return nil, err
+		}
+	}
+
+	err = h.Service.UpdateTokenLastUseTime(ctx, apiToken, clientIP, resource.GetRequestUserAgent(ctx))
 
 	if err != nil {
 		return nil, err
@@ -440,6 +933,10 @@ func (h *PublicHandler) ValidateToken(ctx context.Context, req *mgmtpb.ValidateT
 		return nil, err
 	}
 
+	if err := h.setPasswordChangeRequiredHeader(ctx, uuid.FromStringOrNil(userUID)); err != nil {
+		return nil, err
+	}
+
 	// Return user as AIP-compliant resource name: users/{user_id}
 	return &mgmtpb.ValidateTokenResponse{User: fmt.Sprintf("users/%s", user.Id)}, nil
 }
@@ -0,0 +1,661 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/instill-ai/mgmt-backend/pkg/middleware"
+	"github.com/instill-ai/mgmt-backend/pkg/service"
+
+	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// Some of the MgmtPublicService and MgmtPrivateService endpoints aren't
+// generated in the protogen-go version this service builds against. Until they
+// are, they're served as REST routes on the gateway muxes. Their request and
+// response types mirror the proto messages so the handlers can move to the
+// gRPC server unchanged.
+
+const (
+	publicServiceName  = "/mgmt.v1beta.MgmtPublicService"
+	privateServiceName = "/mgmt.v1beta.MgmtPrivateService"
+)
+
+// AuthTokenIssuerRequest represents a request to issue an access token.
+type AuthTokenIssuerRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Code of the second factor, or a recovery code, for the users who
+	// enrolled MFA.
+	MFACode string `json:"mfaCode"`
+}
+
+// AuthTokenIssuerResponse contains the token issuer details.
+type AuthTokenIssuerResponse struct {
+	AccessToken *UnsignedAccessToken `json:"accessToken"`
+}
+
+// UnsignedAccessToken contains the token issuer information.
+type UnsignedAccessToken struct {
+	Aud string `json:"aud"`
+	Iss string `json:"iss"`
+	Sub string `json:"sub"`
+	Jti string `json:"jti"`
+	Exp int64  `json:"exp"`
+}
+
+// AuthLoginRequest represents a request for user login.
+type AuthLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Code of the second factor, or a recovery code, for the users who
+	// enrolled MFA.
+	MFACode string `json:"mfaCode"`
+}
+
+// AuthLoginResponse contains the access token of the authenticated user.
+type AuthLoginResponse struct {
+	AccessToken            string `json:"accessToken"`
+	RefreshToken           string `json:"refreshToken"`
+	PasswordChangeRequired bool   `json:"passwordChangeRequired"`
+}
+
+// AuthRefreshRequest represents a request to refresh an access token.
+type AuthRefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// AuthRefreshResponse contains a new access token and the refresh token that
+// replaces the one in the request.
+type AuthRefreshResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// AuthLogoutRequest represents a request for user logout.
+type AuthLogoutRequest struct{}
+
+// AuthLogoutResponse is an empty response.
+type AuthLogoutResponse struct{}
+
+// AuthValidateAccessTokenRequest represents a request for access token
+// validation.
+type AuthValidateAccessTokenRequest struct{}
+
+// AuthValidateAccessTokenResponse contains the user the access token was
+// issued to.
+type AuthValidateAccessTokenResponse struct {
+	// Format: `users/{user}`
+	User                   string `json:"user"`
+	PasswordChangeRequired bool   `json:"passwordChangeRequired"`
+}
+
+// EnrollMFARequest represents a request to enroll a TOTP second factor.
+type EnrollMFARequest struct{}
+
+// EnrollMFAResponse contains what an authenticator app needs to generate the
+// codes of the second factor.
+type EnrollMFAResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// VerifyMFARequest represents a request to verify a code of the enrolled
+// factor and enable it.
+type VerifyMFARequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyMFAResponse contains the recovery codes of the user. They're only
+// returned once.
+type VerifyMFAResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// DisableMFARequest represents a request to remove the second factor.
+type DisableMFARequest struct {
+	// Code of the second factor, or a recovery code.
+	Code string `json:"code"`
+}
+
+// DisableMFAResponse is an empty response.
+type DisableMFAResponse struct{}
+
+// RequestPasswordResetRequest represents a request to send a password reset
+// link.
+type RequestPasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestPasswordResetResponse is an empty response. It's returned whether
+// the email belongs to a user or not.
+type RequestPasswordResetResponse struct{}
+
+// ConfirmPasswordResetRequest represents a request to set a new password with
+// a password reset token.
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ConfirmPasswordResetResponse is an empty response.
+type ConfirmPasswordResetResponse struct{}
+
+// GetEmailStatusRequest represents a request for the email status of the
+// authenticated user.
+type GetEmailStatusRequest struct{}
+
+// GetEmailStatusResponse contains the email of the user, whether it's
+// verified and the address it's being changed to, if any.
+type GetEmailStatusResponse struct {
+	Email        string `json:"email"`
+	Verified     bool   `json:"verified"`
+	PendingEmail string `json:"pendingEmail,omitempty"`
+}
+
+// SendEmailVerificationRequest represents a request to send a verification
+// link to the email of the authenticated user.
+type SendEmailVerificationRequest struct{}
+
+// SendEmailVerificationResponse is an empty response.
+type SendEmailVerificationResponse struct{}
+
+// RequestEmailChangeRequest represents a request to change the email of the
+// authenticated user.
+type RequestEmailChangeRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestEmailChangeResponse is an empty response.
+type RequestEmailChangeResponse struct{}
+
+// ConfirmEmailRequest represents a request to verify an email with an email
+// verification token.
+type ConfirmEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ConfirmEmailResponse is an empty response.
+type ConfirmEmailResponse struct{}
+
+// AuthOIDCAuthorizeRequest represents a request to sign in through the OIDC
+// provider.
+type AuthOIDCAuthorizeRequest struct{}
+
+// AuthOIDCAuthorizeResponse contains the URL of the OIDC provider the user is
+// sent to.
+type AuthOIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	// Secret the console keeps in the browser, e.g. in the session storage,
+	// until the login completes. Only this browser can complete the login.
+	Binding string `json:"binding"`
+}
+
+// AuthOIDCLoginRequest represents the callback of a login through the OIDC
+// provider, with the parameters the provider redirected the user with.
+type AuthOIDCLoginRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+	// The binding returned when the login was started.
+	Binding string `json:"binding"`
+}
+
+// Session represents a login session of a user.
+type Session struct {
+	// Format: `sessions/{session}` or, on the private service,
+	// `users/{user}/sessions/{session}`.
+	Name             string    `json:"name"`
+	UID              string    `json:"uid"`
+	UserAgent        string    `json:"userAgent"`
+	IPAddress        string    `json:"ipAddress"`
+	CreateTime       time.Time `json:"createTime"`
+	LastActivityTime time.Time `json:"lastActivityTime"`
+}
+
+// ListSessionsRequest represents a request to list the login sessions of the
+// authenticated user.
+type ListSessionsRequest struct{}
+
+// ListSessionsResponse contains the active login sessions.
+type ListSessionsResponse struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// RevokeSessionRequest represents a request to end a login session.
+type RevokeSessionRequest struct {
+	// Format: `sessions/{session}`
+	Name string `json:"name"`
+}
+
+// RevokeSessionResponse is an empty response.
+type RevokeSessionResponse struct{}
+
+// RevokeAllSessionsRequest represents a request to end all the login sessions
+// of the authenticated user.
+type RevokeAllSessionsRequest struct{}
+
+// RevokeAllSessionsResponse is an empty response.
+type RevokeAllSessionsResponse struct{}
+
+// ListSessionsAdminRequest represents a request to list the login sessions of
+// a user.
+type ListSessionsAdminRequest struct {
+	// Format: `users/{user}`
+	Parent string `json:"parent"`
+}
+
+// ListSessionsAdminResponse contains the active login sessions of a user.
+type ListSessionsAdminResponse struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// RevokeSessionAdminRequest represents a request to end a login session of a
+// user.
+type RevokeSessionAdminRequest struct {
+	// Format: `users/{user}/sessions/{session}`
+	Name string `json:"name"`
+}
+
+// RevokeSessionAdminResponse is an empty response.
+type RevokeSessionAdminResponse struct{}
+
+// RevokeAllSessionsAdminRequest represents a request to end all the login
+// sessions of a user.
+type RevokeAllSessionsAdminRequest struct {
+	// Format: `users/{user}`
+	Parent string `json:"parent"`
+}
+
+// RevokeAllSessionsAdminResponse is an empty response.
+type RevokeAllSessionsAdminResponse struct{}
+
+// UnlockUserAdminRequest represents a request to lift the login lockout of a
+// user.
+type UnlockUserAdminRequest struct {
+	// Format: `users/{user}`
+	Name string `json:"name"`
+}
+
+// UnlockUserAdminResponse is an empty response.
+type UnlockUserAdminResponse struct{}
+
+// APIToken mirrors the ApiToken message.
+type APIToken struct {
+	// Format: `tokens/{token}`
+	Name        string `json:"name"`
+	ID          string `json:"id"`
+	State       string `json:"state,omitempty"`
+	AccessToken string `json:"accessToken,omitempty"`
+	TokenType   string `json:"tokenType,omitempty"`
+	// Either the number of seconds the token is valid for, -1 for a token
+	// that doesn't expire, or its expiration time.
+	TTL         *int32     `json:"ttl,omitempty"`
+	ExpireTime  *time.Time `json:"expireTime,omitempty"`
+	CreateTime  *time.Time `json:"createTime,omitempty"`
+	UpdateTime  *time.Time `json:"updateTime,omitempty"`
+	LastUseTime *time.Time `json:"lastUseTime,omitempty"`
+}
+
+// TokenRestrictions restricts what an API token grants. A token without
+// restrictions grants the full power of its owner.
+type TokenRestrictions struct {
+	// Format: `tokens/{token}/restrictions`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// The source CIDRs the token is allowed from, e.g. `10.0.0.0/8`. The
+	// addresses are allowed alone.
+	AllowedCIDRs []string `json:"allowedCidrs"`
+	// The rules of the token policy the token doesn't satisfy anymore, e.g.
+	// `MAX_TTL`, as flagged by the worker. Output only.
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+}
+
+// CreateRestrictedTokenRequest represents a request to create an API token
+// with restrictions.
+type CreateRestrictedTokenRequest struct {
+	Token        *APIToken          `json:"token"`
+	Restrictions *TokenRestrictions `json:"restrictions"`
+}
+
+// CreateRestrictedTokenResponse contains the created token. The access token
+// is only returned once.
+type CreateRestrictedTokenResponse struct {
+	Token        *APIToken          `json:"token"`
+	Restrictions *TokenRestrictions `json:"restrictions"`
+}
+
+// GetTokenRestrictionsRequest represents a request for the restrictions of
+// an API token.
+type GetTokenRestrictionsRequest struct {
+	// Format: `tokens/{token}/restrictions`
+	Name string `json:"name"`
+}
+
+// GetTokenRestrictionsResponse contains the restrictions of an API token.
+type GetTokenRestrictionsResponse struct {
+	Restrictions *TokenRestrictions `json:"restrictions"`
+}
+
+// RotateTokenRequest represents a request to issue a new secret for an API
+// token.
+type RotateTokenRequest struct {
+	// Format: `tokens/{token}`
+	Name string `json:"name"`
+}
+
+// RotateTokenResponse contains the rotated token. The new access token is
+// only returned once, the previous one stays valid for a grace period.
+type RotateTokenResponse struct {
+	Token *APIToken `json:"token"`
+}
+
+// FilterTokensRequest represents a request to list the API tokens of the
+// authenticated user in a state, the ListTokensRequest doesn't have a filter
+// yet.
+type FilterTokensRequest struct {
+	PageSize  int32  `json:"pageSize,string"`
+	PageToken string `json:"pageToken"`
+	// Lists the tokens in this state only, e.g. `STATE_INACTIVE`.
+	State string `json:"state"`
+}
+
+// DeactivateTokenRequest represents a request to suspend an API token.
+type DeactivateTokenRequest struct {
+	// Format: `tokens/{token}`
+	Name string `json:"name"`
+}
+
+// DeactivateTokenResponse contains the inactive token.
+type DeactivateTokenResponse struct {
+	Token *APIToken `json:"token"`
+}
+
+// ActivateTokenRequest represents a request to resume an inactive API token.
+type ActivateTokenRequest struct {
+	// Format: `tokens/{token}`
+	Name string `json:"name"`
+}
+
+// ActivateTokenResponse contains the active token.
+type ActivateTokenResponse struct {
+	Token *APIToken `json:"token"`
+}
+
+func (t *APIToken) pbToken() *mgmtpb.ApiToken {
+	pbToken := &mgmtpb.ApiToken{Id: t.ID}
+	switch {
+	case t.TTL != nil:
+		pbToken.Expiration = &mgmtpb.ApiToken_Ttl{Ttl: *t.TTL}
+	case t.ExpireTime != nil:
+		pbToken.Expiration = &mgmtpb.ApiToken_ExpireTime{ExpireTime: timestamppb.New(*t.ExpireTime)}
+	}
+	return pbToken
+}
+
+func pbToken2APIToken(pbToken *mgmtpb.ApiToken) *APIToken {
+	asTime := func(ts *timestamppb.Timestamp) *time.Time {
+		if ts == nil {
+			return nil
+		}
+		t := ts.AsTime()
+		return &t
+	}
+	return &APIToken{
+		Name:        pbToken.GetName(),
+		ID:          pbToken.GetId(),
+		State:       pbToken.GetState().String(),
+		AccessToken: pbToken.GetAccessToken(),
+		TokenType:   pbToken.GetTokenType(),
+		ExpireTime:  asTime(pbToken.GetExpireTime()),
+		CreateTime:  asTime(pbToken.GetCreateTime()),
+		UpdateTime:  asTime(pbToken.GetUpdateTime()),
+		LastUseTime: asTime(pbToken.GetLastUseTime()),
+	}
+}
+
+func tokenRestrictions2PB(tokenName string, restrictions *service.TokenRestrictions) *TokenRestrictions {
+	return &TokenRestrictions{
+		Name:             tokenName + "/restrictions",
+		Scopes:           append([]string{}, restrictions.Scopes...),
+		AllowedCIDRs:     append([]string{}, restrictions.AllowedCIDRs...),
+		PolicyViolations: restrictions.PolicyViolations,
+	}
+}
+
+func sessions2PBSessions(parent string, sessions []*service.Session) []*Session {
+	pbSessions := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		pbSessions = append(pbSessions, &Session{
+			Name:             fmt.Sprintf("%s/%s", parent, session.UID),
+			UID:              session.UID.String(),
+			UserAgent:        session.UserAgent,
+			IPAddress:        session.IPAddress,
+			CreateTime:       session.CreateTime,
+			LastActivityTime: session.LastActivityTime,
+		})
+	}
+	return pbSessions
+}
+
+// parseSessionUIDFromName parses a session resource name of format
+// "sessions/{session}" or "users/{user_id}/sessions/{session}" and returns
+// the session UID
+func parseSessionUIDFromName(name string) (uuid.UUID, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) == 2 && parts[0] == "sessions" {
+		return uuid.FromString(parts[1])
+	}
+	if len(parts) == 4 && parts[0] == "users" && parts[2] == "sessions" {
+		return uuid.FromString(parts[3])
+	}
+	return uuid.Nil, fmt.Errorf("invalid session name format, expected sessions/{session} or users/{user_id}/sessions/{session}")
+}
+
+// passwordChangeAllowedRPCs are the REST-only public endpoints that remain
+// available to the users who must change their password.
+var passwordChangeAllowedRPCs = map[string]bool{
+	"AuthTokenIssuer":         true,
+	"AuthLogin":               true,
+	"AuthRefresh":             true,
+	"AuthLogout":              true,
+	"RequestPasswordReset":    true,
+	"ConfirmPasswordReset":    true,
+	"AuthOIDCAuthorize":       true,
+	"AuthOIDCLogin":           true,
+	"AuthValidateAccessToken": true,
+}
+
+// publicRESTCheck applies the checks of the public gRPC interceptors to the
+// REST-only endpoints.
+func publicRESTCheck(s service.Service) restCheck {
+	return func(ctx context.Context, rpcName string) error {
+		// These endpoints manage the account and its credentials, which the
+		// scoped API tokens aren't granted.
+		scopes, err := middleware.RequestTokenScopes(ctx, s)
+		if err != nil {
+			return err
+		}
+		if len(scopes) > 0 {
+			return status.Error(codes.PermissionDenied, "the API token isn't granted a scope required by this API")
+		}
+
+		if passwordChangeAllowedRPCs[rpcName] {
+			return nil
+		}
+		return middleware.CheckPasswordChange(ctx, s)
+	}
+}
+
+// RegisterPublicRESTHandlers registers the public endpoints that are only
+// served over REST on the gateway mux.
+func RegisterPublicRESTHandlers(mux *runtime.ServeMux, s service.Service) error {
+	h := &PublicHandler{Service: s}
+	check := publicRESTCheck(s)
+
+	routes := []struct {
+		method  string
+		pattern string
+		handler runtime.HandlerFunc
+	}{
+		{"POST", "/v1beta/auth/token_issuer", handleREST(mux, check, publicServiceName, "AuthTokenIssuer", h.AuthTokenIssuer)},
+		{"POST", "/v1beta/auth/login", handleREST(mux, check, publicServiceName, "AuthLogin", h.AuthLogin)},
+		{"POST", "/v1beta/auth/refresh", handleREST(mux, check, publicServiceName, "AuthRefresh", h.AuthRefresh)},
+		{"POST", "/v1beta/auth/logout", handleREST(mux, check, publicServiceName, "AuthLogout", h.AuthLogout)},
+		{"POST", "/v1beta/auth/mfa/enroll", handleREST(mux, check, publicServiceName, "EnrollMFA", h.EnrollMFA)},
+		{"POST", "/v1beta/auth/mfa/verify", handleREST(mux, check, publicServiceName, "VerifyMFA", h.VerifyMFA)},
+		{"POST", "/v1beta/auth/mfa/disable", handleREST(mux, check, publicServiceName, "DisableMFA", h.DisableMFA)},
+		{"POST", "/v1beta/auth/password_reset/request", handleREST(mux, check, publicServiceName, "RequestPasswordReset", h.RequestPasswordReset)},
+		{"POST", "/v1beta/auth/password_reset/confirm", handleREST(mux, check, publicServiceName, "ConfirmPasswordReset", h.ConfirmPasswordReset)},
+		{"GET", "/v1beta/auth/email", handleREST(mux, check, publicServiceName, "GetEmailStatus", h.GetEmailStatus)},
+		{"POST", "/v1beta/auth/email/verify", handleREST(mux, check, publicServiceName, "SendEmailVerification", h.SendEmailVerification)},
+		{"POST", "/v1beta/auth/email/change", handleREST(mux, check, publicServiceName, "RequestEmailChange", h.RequestEmailChange)},
+		{"POST", "/v1beta/auth/email/confirm", handleREST(mux, check, publicServiceName, "ConfirmEmail", h.ConfirmEmail)},
+		{"POST", "/v1beta/auth/oidc/authorize", handleREST(mux, check, publicServiceName, "AuthOIDCAuthorize", h.AuthOIDCAuthorize)},
+		{"POST", "/v1beta/auth/oidc/login", handleREST(mux, check, publicServiceName, "AuthOIDCLogin", h.AuthOIDCLogin)},
+		{"POST", "/v1beta/auth/validate_access_token", handleREST(mux, check, publicServiceName, "AuthValidateAccessToken", h.AuthValidateAccessToken)},
+		{"GET", "/v1beta/sessions", handleREST(mux, check, publicServiceName, "ListSessions", h.ListSessions)},
+		{"DELETE", "/v1beta/{name=sessions/*}", handleREST(mux, check, publicServiceName, "RevokeSession", h.RevokeSession)},
+		{"POST", "/v1beta/sessions:revokeAll", handleREST(mux, check, publicServiceName, "RevokeAllSessions", h.RevokeAllSessions)},
+		{"POST", "/v1beta/tokens:createRestricted", handleREST(mux, check, publicServiceName, "CreateRestrictedToken", h.CreateRestrictedToken)},
+		{"GET", "/v1beta/{name=tokens/*/restrictions}", handleREST(mux, check, publicServiceName, "GetTokenRestrictions", h.GetTokenRestrictions)},
+		{"POST", "/v1beta/{name=tokens/*}:rotate", handleREST(mux, check, publicServiceName, "RotateToken", h.RotateToken)},
+		{"POST", "/v1beta/{name=tokens/*}:deactivate", handleREST(mux, check, publicServiceName, "DeactivateToken", h.DeactivateToken)},
+		{"POST", "/v1beta/{name=tokens/*}:activate", handleREST(mux, check, publicServiceName, "ActivateToken", h.ActivateToken)},
+		{"GET", "/v1beta/tokens:filter", handleREST(mux, check, publicServiceName, "FilterTokens", h.FilterTokens)},
+		{"GET", "/.well-known/jwks.json", handleJWKS(mux, s)},
+	}
+
+	for _, r := range routes {
+		if err := mux.HandlePath(r.method, r.pattern, r.handler); err != nil {
+			return fmt.Errorf("registering %s %s: %w", r.method, r.pattern, err)
+		}
+	}
+	return nil
+}
+
+// RegisterPrivateRESTHandlers registers the private endpoints that are only
+// served over REST, on the private REST port.
+func RegisterPrivateRESTHandlers(mux *runtime.ServeMux, s service.Service) error {
+	h := &PrivateHandler{Service: s}
+
+	routes := []struct {
+		method  string
+		pattern string
+		handler runtime.HandlerFunc
+	}{
+		{"GET", "/v1beta/admin/{parent=users/*}/sessions", handleREST(mux, nil, privateServiceName, "ListSessionsAdmin", h.ListSessionsAdmin)},
+		{"DELETE", "/v1beta/admin/{name=users/*/sessions/*}", handleREST(mux, nil, privateServiceName, "RevokeSessionAdmin", h.RevokeSessionAdmin)},
+		{"POST", "/v1beta/admin/{parent=users/*}/sessions:revokeAll", handleREST(mux, nil, privateServiceName, "RevokeAllSessionsAdmin", h.RevokeAllSessionsAdmin)},
+		{"POST", "/v1beta/admin/{name=users/*}:unlock", handleREST(mux, nil, privateServiceName, "UnlockUserAdmin", h.UnlockUserAdmin)},
+	}
+
+	for _, r := range routes {
+		if err := mux.HandlePath(r.method, r.pattern, r.handler); err != nil {
+			return fmt.Errorf("registering %s %s: %w", r.method, r.pattern, err)
+		}
+	}
+	return nil
+}
+
+// handleJWKS serves the public keys verifying the access tokens as a JSON Web
+// Key Set. Clients may cache it for a few minutes and refetch it when they find
+// an unknown `kid`.
+func handleJWKS(mux *runtime.ServeMux, s service.Service) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		jwks, err := s.GetJWKS(r.Context())
+		if err != nil {
+			_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+			runtime.HTTPError(r.Context(), mux, outboundMarshaler, w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(jwks)
+	}
+}
+
+// restCheck refuses a request to a REST-only endpoint before it is handled,
+// like the interceptors of the gRPC server do.
+type restCheck func(ctx context.Context, rpcName string) error
+
+// handleREST adapts a handler method to the gateway mux. The request headers
+// are converted into incoming gRPC metadata, the JSON body and the path
+// parameters, plus the query parameters of the GET requests, are decoded into
+// the request, and the response and the errors go through the mux marshaler
+// and error handler, so the endpoint behaves like the generated ones. The
+// request is refused if check, when set, fails. The parameters are strings,
+// the numeric fields they set are tagged `,string`.
+func handleREST[Req, Resp any](mux *runtime.ServeMux, check restCheck, serviceName, rpcName string, method func(context.Context, *Req) (*Resp, error)) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+
+		ctx, err := runtime.AnnotateIncomingContext(r.Context(), mux, r, fmt.Sprintf("%s/%s", serviceName, rpcName))
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outboundMarshaler, w, r, err)
+			return
+		}
+
+		if check != nil {
+			if err := check(ctx, rpcName); err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+				return
+			}
+		}
+
+		req := new(Req)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, fmt.Errorf("%w: decoding request body: %w", errorsx.ErrInvalidArgument, err))
+			return
+		}
+		// The parameters override the fields of the body. The query is only
+		// read on the GET requests, which don't have a body.
+		params := map[string]string{}
+		if r.Method == http.MethodGet {
+			for key, values := range r.URL.Query() {
+				params[key] = values[0]
+			}
+		}
+		maps.Copy(params, pathParams)
+		if len(params) > 0 {
+			b, err := json.Marshal(params)
+			if err == nil {
+				err = json.Unmarshal(b, req)
+			}
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, fmt.Errorf("%w: decoding path parameters: %w", errorsx.ErrInvalidArgument, err))
+				return
+			}
+		}
+
+		resp, err := method(ctx, req)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+			return
+		}
+
+		b, err := outboundMarshaler.Marshal(resp)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", outboundMarshaler.ContentType(resp))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/pkg/scim"
+	"github.com/instill-ai/mgmt-backend/pkg/service"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+const (
+	scimContentType  = "application/scim+json"
+	scimDefaultCount = 100
+	scimMaxCount     = 1000
+)
+
+// scimErrors are the errors reported with their SCIM error type, all of them
+// are client errors.
+var scimErrors = []error{
+	scim.ErrInvalidFilter,
+	scim.ErrInvalidPath,
+	scim.ErrInvalidSyntax,
+	scim.ErrInvalidValue,
+	scim.ErrMutability,
+	scim.ErrNoTarget,
+	scim.ErrUniqueness,
+}
+
+// RegisterSCIMHandlers registers the SCIM 2.0 endpoints on the public mux.
+// They aren't part of the MgmtPublicService, the identity provider
+// authenticates with its own bearer token.
+func RegisterSCIMHandlers(mux *runtime.ServeMux, s service.Service, token string) error {
+	if token == "" {
+		return fmt.Errorf("SCIM token is required")
+	}
+	h := &scimHandler{service: s, token: token}
+
+	for _, route := range []struct {
+		method  string
+		path    string
+		handler runtime.HandlerFunc
+	}{
+		{http.MethodGet, "/scim/v2/Users", h.listUsers},
+		{http.MethodPost, "/scim/v2/Users", h.createUser},
+		{http.MethodGet, "/scim/v2/Users/{id}", h.getUser},
+		{http.MethodPut, "/scim/v2/Users/{id}", h.replaceUser},
+		{http.MethodPatch, "/scim/v2/Users/{id}", h.patchUser},
+		{http.MethodDelete, "/scim/v2/Users/{id}", h.deleteUser},
+		{http.MethodGet, "/scim/v2/Groups", h.listGroups},
+		{http.MethodPost, "/scim/v2/Groups", h.createGroup},
+		{http.MethodGet, "/scim/v2/Groups/{id}", h.getGroup},
+		{http.MethodPut, "/scim/v2/Groups/{id}", h.replaceGroup},
+		{http.MethodPatch, "/scim/v2/Groups/{id}", h.patchGroup},
+		{http.MethodDelete, "/scim/v2/Groups/{id}", h.deleteGroup},
+	} {
+		if err := mux.HandlePath(route.method, route.path, h.authenticate(route.handler)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type scimHandler struct {
+	service service.Service
+	token   string
+}
+
+func (h *scimHandler) authenticate(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			writeSCIMError(w, r, errorsx.ErrUnauthenticated)
+			return
+		}
+		next(w, r, pathParams)
+	}
+}
+
+func (h *scimHandler) listUsers(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	startIndex, count, err := scimPagination(r)
+	if err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.ListSCIMUsers(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) createUser(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	user := &scim.User{}
+	if err := decodeSCIMRequest(r, user); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.CreateSCIMUser(r.Context(), user)
+	writeSCIMResponse(w, r, http.StatusCreated, resp, err)
+}
+
+func (h *scimHandler) getUser(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	resp, err := h.service.GetSCIMUser(r.Context(), pathParams["id"])
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) replaceUser(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	user := &scim.User{}
+	if err := decodeSCIMRequest(r, user); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.ReplaceSCIMUser(r.Context(), pathParams["id"], user)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) patchUser(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	req := &scim.PatchRequest{}
+	if err := decodeSCIMRequest(r, req); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.PatchSCIMUser(r.Context(), pathParams["id"], req.Operations)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) deleteUser(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	err := h.service.DeleteSCIMUser(r.Context(), pathParams["id"])
+	writeSCIMResponse(w, r, http.StatusNoContent, nil, err)
+}
+
+func (h *scimHandler) listGroups(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	startIndex, count, err := scimPagination(r)
+	if err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.ListSCIMGroups(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) createGroup(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	group := &scim.Group{}
+	if err := decodeSCIMRequest(r, group); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.CreateSCIMGroup(r.Context(), group)
+	writeSCIMResponse(w, r, http.StatusCreated, resp, err)
+}
+
+func (h *scimHandler) getGroup(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	resp, err := h.service.GetSCIMGroup(r.Context(), pathParams["id"])
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) replaceGroup(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	group := &scim.Group{}
+	if err := decodeSCIMRequest(r, group); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.ReplaceSCIMGroup(r.Context(), pathParams["id"], group)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) patchGroup(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	req := &scim.PatchRequest{}
+	if err := decodeSCIMRequest(r, req); err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	resp, err := h.service.PatchSCIMGroup(r.Context(), pathParams["id"], req.Operations)
+	writeSCIMResponse(w, r, http.StatusOK, resp, err)
+}
+
+func (h *scimHandler) deleteGroup(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	err := h.service.DeleteSCIMGroup(r.Context(), pathParams["id"])
+	writeSCIMResponse(w, r, http.StatusNoContent, nil, err)
+}
+
+// scimPagination returns the 1-based start index and the count of a query.
+func scimPagination(r *http.Request) (startIndex, count int, err error) {
+	startIndex, count = 1, scimDefaultCount
+	query := r.URL.Query()
+	if v := query.Get("startIndex"); v != "" {
+		if startIndex, err = strconv.Atoi(v); err != nil {
+			return 0, 0, fmt.Errorf("%w: startIndex must be an integer", scim.ErrInvalidValue)
+		}
+	}
+	if v := query.Get("count"); v != "" {
+		if count, err = strconv.Atoi(v); err != nil {
+			return 0, 0, fmt.Errorf("%w: count must be an integer", scim.ErrInvalidValue)
+		}
+	}
+	return startIndex, min(max(count, 0), scimMaxCount), nil
+}
+
+func decodeSCIMRequest(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: decoding request body: %w", scim.ErrInvalidSyntax, err)
+	}
+	return nil
+}
+
+func writeSCIMResponse(w http.ResponseWriter, r *http.Request, status int, resp any, err error) {
+	if err != nil {
+		writeSCIMError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	if status != http.StatusNoContent {
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func writeSCIMError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := &scim.Error{Schemas: []string{scim.ErrorSchema}, Detail: err.Error()}
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, errorsx.ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, errorsx.ErrNotFound), errors.Is(err, errorsx.ErrNoDataDeleted):
+		status = http.StatusNotFound
+	case errors.Is(err, errorsx.ErrAlreadyExists):
+		status, resp.ScimType = http.StatusConflict, scim.ErrUniqueness.Error()
+	case errors.Is(err, errorsx.ErrInvalidArgument):
+		status = http.StatusBadRequest
+	default:
+		for _, scimErr := range scimErrors {
+			if errors.Is(err, scimErr) {
+				status, resp.ScimType = http.StatusBadRequest, scimErr.Error()
+				break
+			}
+		}
+		if errors.Is(err, scim.ErrUniqueness) {
+			status = http.StatusConflict
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		logger, _ := logx.GetZapLogger(r.Context())
+		logger.Error("SCIM request failed", zap.String("path", r.URL.Path), zap.Error(err))
+		resp.Detail = http.StatusText(status)
+	}
+	resp.Status = strconv.Itoa(status)
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,184 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	ldapv3 "github.com/go-ldap/ldap/v3"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+// ErrInvalidCredentials is returned when the username doesn't match exactly
+// one user of the directory or the password is wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Issuer is the issuer of the owner identities linking the local users to the
+// entries of the directory.
+const Issuer = "ldap"
+
+// Identity is a user of the directory, with the attributes the local user is
+// provisioned with. ID identifies the entry, it doesn't change when the user
+// is renamed if the directory has a stable identifier attribute.
+type Identity struct {
+	ID          string
+	Username    string
+	Email       string
+	DisplayName string
+}
+
+// Authenticator checks the credentials of the users against an LDAP or Active
+// Directory server.
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// NewAuthenticator returns the authenticator for the given configuration.
+func NewAuthenticator(cfg config.LDAPConfig) (Authenticator, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL %q: %w", cfg.URL, err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return nil, fmt.Errorf("StartTLS can't be used with an ldaps URL")
+	}
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP base DN is required")
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP user filter must contain %%s exactly once")
+	}
+	if cfg.Attributes.Username == "" || cfg.Attributes.Email == "" {
+		return nil, fmt.Errorf("LDAP username and email attributes are required")
+	}
+
+	return &authenticator{
+		cfg: cfg,
+		tlsConfig: &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+	}, nil
+}
+
+type authenticator struct {
+	cfg       config.LDAPConfig
+	tlsConfig *tls.Config
+}
+
+// Authenticate looks the user up with the service account, then binds as the
+// user to check the password.
+func (a *authenticator) Authenticate(_ context.Context, username, password string) (*Identity, error) {
+	// A bind with an empty password is an unauthenticated bind, which most
+	// servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("binding LDAP service account: %w", err)
+		}
+	}
+
+	attributes := []string{a.cfg.Attributes.Username, a.cfg.Attributes.Email}
+	if a.cfg.Attributes.DisplayName != "" {
+		attributes = append(attributes, a.cfg.Attributes.DisplayName)
+	}
+	if a.cfg.Attributes.ID != "" {
+		attributes = append(attributes, a.cfg.Attributes.ID)
+	}
+
+	// Two entries are enough to tell an ambiguous username.
+	res, err := conn.Search(ldapv3.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldapv3.ScopeWholeSubtree,
+		ldapv3.NeverDerefAliases,
+		2,
+		int(a.cfg.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.cfg.UserFilter, ldapv3.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("searching LDAP user: %w", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("binding LDAP user: %w", err)
+	}
+
+	identity := &Identity{
+		ID:       entry.DN,
+		Username: entry.GetAttributeValue(a.cfg.Attributes.Username),
+		Email:    entry.GetAttributeValue(a.cfg.Attributes.Email),
+	}
+	if a.cfg.Attributes.ID != "" {
+		// Some identifiers are binary, e.g. the objectGUID of Active
+		// Directory.
+		id := entry.GetRawAttributeValue(a.cfg.Attributes.ID)
+		if len(id) == 0 {
+			return nil, fmt.Errorf("LDAP user %q has no %s attribute", entry.DN, a.cfg.Attributes.ID)
+		}
+		if utf8.Valid(id) {
+			identity.ID = string(id)
+		} else {
+			identity.ID = hex.EncodeToString(id)
+		}
+	}
+	if a.cfg.Attributes.DisplayName != "" {
+		identity.DisplayName = entry.GetAttributeValue(a.cfg.Attributes.DisplayName)
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+
+	return identity, nil
+}
+
+func (a *authenticator) dial() (*ldapv3.Conn, error) {
+	conn, err := ldapv3.DialURL(
+		a.cfg.URL,
+		ldapv3.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}),
+		ldapv3.DialWithTLSConfig(a.tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to LDAP server: %w", err)
+	}
+	if a.cfg.Timeout > 0 {
+		conn.SetTimeout(a.cfg.Timeout)
+	}
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starting TLS with LDAP server: %w", err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+func testConfig() config.LDAPConfig {
+	cfg := config.LDAPConfig{
+		URL:        "ldap://localhost:389",
+		BaseDN:     "dc=instill,dc=test",
+		UserFilter: "(uid=%s)",
+	}
+	cfg.Attributes.Username = "uid"
+	cfg.Attributes.Email = "mail"
+	cfg.Attributes.DisplayName = "cn"
+	return cfg
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	_, err := NewAuthenticator(testConfig())
+	require.NoError(t, err)
+
+	for name, edit := range map[string]func(*config.LDAPConfig){
+		"scheme":        func(cfg *config.LDAPConfig) { cfg.URL = "http://localhost:389" },
+		"StartTLS":      func(cfg *config.LDAPConfig) { cfg.URL, cfg.StartTLS = "ldaps://localhost:636", true },
+		"base DN":       func(cfg *config.LDAPConfig) { cfg.BaseDN = "" },
+		"no username":   func(cfg *config.LDAPConfig) { cfg.UserFilter = "(uid=jane)" },
+		"two usernames": func(cfg *config.LDAPConfig) { cfg.UserFilter = "(|(uid=%s)(mail=%s))" },
+		"email":         func(cfg *config.LDAPConfig) { cfg.Attributes.Email = "" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig()
+			edit(&cfg)
+			_, err := NewAuthenticator(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticate_EmptyPassword(t *testing.T) {
+	// The directory isn't reached, an empty password would be an
+	// unauthenticated bind.
+	a, err := NewAuthenticator(testConfig())
+	require.NoError(t, err)
+
+	_, err = a.Authenticate(context.Background(), "jane", "")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+}
@@ -0,0 +1,100 @@
+//go:build ldaptest
+// +build ldaptest
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ldapv3 "github.com/go-ldap/ldap/v3"
+)
+
+// TestAuthenticate_OpenLDAP runs against the OpenLDAP container started by
+// `make ldaptest`. The admin is also used as the service account.
+func TestAuthenticate_OpenLDAP(t *testing.T) {
+	cfg := testConfig()
+	cfg.URL = "ldap://localhost:1389"
+	if url := os.Getenv("LDAP_URL"); url != "" {
+		cfg.URL = url
+	}
+	cfg.BindDN = "cn=admin,dc=instill,dc=test"
+	cfg.BindPassword = "password"
+
+	conn, err := ldapv3.DialURL(cfg.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.Bind(cfg.BindDN, cfg.BindPassword))
+
+	addEntry := func(dn string, attributes map[string][]string) {
+		_ = conn.Del(ldapv3.NewDelRequest(dn, nil))
+		req := ldapv3.NewAddRequest(dn, nil)
+		for name, values := range attributes {
+			req.Attribute(name, values)
+		}
+		require.NoError(t, conn.Add(req))
+	}
+	for _, uid := range []string{"jane", "john"} {
+		_ = conn.Del(ldapv3.NewDelRequest("uid="+uid+",ou=people,dc=instill,dc=test", nil))
+	}
+	addEntry("ou=people,dc=instill,dc=test", map[string][]string{
+		"objectClass": {"organizationalUnit"},
+		"ou":          {"people"},
+	})
+	addEntry("uid=jane,ou=people,dc=instill,dc=test", map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"uid":          {"jane"},
+		"cn":           {"Jane Doe"},
+		"sn":           {"Doe"},
+		"mail":         {"jane@instill.test"},
+		"userPassword": {"secret"},
+	})
+	addEntry("uid=john,ou=people,dc=instill,dc=test", map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"uid":          {"john"},
+		"cn":           {"John Doe"},
+		"sn":           {"Doe"},
+		"userPassword": {"secret"},
+	})
+
+	a, err := NewAuthenticator(cfg)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	identity, err := a.Authenticate(ctx, "jane", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		ID:          "uid=jane,ou=people,dc=instill,dc=test",
+		Username:    "jane",
+		Email:       "jane@instill.test",
+		DisplayName: "Jane Doe",
+	}, identity)
+
+	_, err = a.Authenticate(ctx, "jane", "wrong")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+
+	_, err = a.Authenticate(ctx, "nobody", "secret")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+
+	// The username is escaped, a wildcard isn't expanded.
+	_, err = a.Authenticate(ctx, "ja*", "secret")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+
+	// The attributes missing from the directory are left empty.
+	identity, err = a.Authenticate(ctx, "john", "secret")
+	require.NoError(t, err)
+	assert.Empty(t, identity.Email)
+
+	// The entries are identified by a stable attribute if configured.
+	cfg.Attributes.ID = "entryUUID"
+	a, err = NewAuthenticator(cfg)
+	require.NoError(t, err)
+	identity, err = a.Authenticate(ctx, "jane", "secret")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f-]{36}$`, identity.ID)
+}
@@ -0,0 +1,147 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+
+	logx "github.com/instill-ai/x/log"
+)
+
+// Supported senders.
+const (
+	SenderSMTP = "smtp"
+	SenderFile = "file"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends the emails to the users.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewSender returns the mail sender for the given configuration.
+func NewSender(cfg config.MailConfig) (Sender, error) {
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", cfg.From, err)
+	}
+
+	switch cfg.Sender {
+	case SenderSMTP:
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("SMTP host is required")
+		}
+		s := &smtpSender{
+			addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+			from: from,
+		}
+		// net/smtp only sends the credentials over TLS, the connection is
+		// upgraded with STARTTLS when the server supports it.
+		if cfg.SMTP.Username != "" {
+			s.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+		}
+		return s, nil
+	case SenderFile:
+		return &fileSender{path: cfg.File, from: from}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail sender %q", cfg.Sender)
+	}
+}
+
+type smtpSender struct {
+	addr string
+	auth smtp.Auth
+	from *netmail.Address
+}
+
+func (s *smtpSender) Send(_ context.Context, msg *Message) error {
+	to, b, err := format(s.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, b); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+	return nil
+}
+
+// fileSender appends the messages to a file. It's meant for development and
+// tests, as the messages hold secrets such as the password reset links.
+// Without a file, only the recipients and the subjects are logged.
+type fileSender struct {
+	mu   sync.Mutex
+	path string
+	from *netmail.Address
+}
+
+func (s *fileSender) Send(ctx context.Context, msg *Message) error {
+	to, b, err := format(s.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if s.path == "" {
+		logger, _ := logx.GetZapLogger(ctx)
+		logger.Info("Email not sent, no mail file is configured",
+			zap.String("to", to.String()),
+			zap.String("subject", msg.Subject),
+		)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening mail file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing mail file: %w", err)
+	}
+	return nil
+}
+
+// format builds an RFC 5322 message. The headers are checked so that a
+// user-provided value can't inject new ones.
+func format(from *netmail.Address, msg *Message) (*netmail.Address, []byte, error) {
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid recipient address %q: %w", msg.To, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, nil, fmt.Errorf("invalid subject %q", msg.Subject)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return to, []byte(b.String()), nil
+}
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+func TestFileSender(t *testing.T) {
+	cfg := config.MailConfig{
+		Sender: SenderFile,
+		From:   "Instill AI <no-reply@instill-ai.com>",
+		File:   filepath.Join(t.TempDir(), "mail.txt"),
+	}
+
+	s, err := NewSender(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Send(context.Background(), &Message{
+		To:      "jane@example.com",
+		Subject: "Reset your password",
+		Body:    "Follow the link.\n",
+	}))
+
+	b, err := os.ReadFile(cfg.File)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "From: \"Instill AI\" <no-reply@instill-ai.com>\r\n")
+	assert.Contains(t, string(b), "To: <jane@example.com>\r\n")
+	assert.Contains(t, string(b), "Subject: Reset your password\r\n")
+	assert.Contains(t, string(b), "\r\n\r\nFollow the link.\r\n")
+}
+
+func TestSend_HeaderInjection(t *testing.T) {
+	s, err := NewSender(config.MailConfig{Sender: SenderFile, From: "no-reply@instill-ai.com"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assert.Error(t, s.Send(ctx, &Message{To: "jane@example.com\r\nBcc: eve@example.com", Subject: "Hello"}))
+	assert.Error(t, s.Send(ctx, &Message{To: "jane@example.com", Subject: "Hello\r\nBcc: eve@example.com"}))
+}
+
+func TestNewSender_InvalidConfig(t *testing.T) {
+	_, err := NewSender(config.MailConfig{Sender: "pigeon", From: "no-reply@instill-ai.com"})
+	assert.Error(t, err)
+
+	_, err = NewSender(config.MailConfig{Sender: SenderSMTP, From: "no-reply@instill-ai.com"})
+	assert.Error(t, err)
+
+	_, err = NewSender(config.MailConfig{Sender: SenderFile, From: "not an address"})
+	assert.Error(t, err)
+}
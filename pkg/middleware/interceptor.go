@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/instill-ai/mgmt-backend/internal/resource"
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/service"
+
+	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
+)
+
+// passwordChangeAllowedMethods are the public methods that remain available to
+// the users who must change their password.
+var passwordChangeAllowedMethods = map[string]bool{
+	mgmtpb.MgmtPublicService_Liveness_FullMethodName:             true,
+	mgmtpb.MgmtPublicService_Readiness_FullMethodName:            true,
+	mgmtpb.MgmtPublicService_AuthenticateUser_FullMethodName:     true,
+	mgmtpb.MgmtPublicService_ValidateToken_FullMethodName:        true,
+	mgmtpb.MgmtPublicService_GetAuthenticatedUser_FullMethodName: true,
+	mgmtpb.MgmtPublicService_AuthChangePassword_FullMethodName:   true,
+}
+
+// PasswordChangeRequiredInterceptor refuses the requests of the users who must
+// change their password, except for the ones needed to do so.
+func PasswordChangeRequiredInterceptor(s service.Service) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if passwordChangeAllowedMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		if err := CheckPasswordChange(ctx, s); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// CheckPasswordChange refuses the request if the authenticated user must
+// change their password. The anonymous requests are let through.
+func CheckPasswordChange(ctx context.Context, s service.Service) error {
+	userUID := uuid.FromStringOrNil(resource.GetRequestSingleHeader(ctx, constant.HeaderUserUIDKey))
+	if userUID == uuid.Nil {
+		return nil
+	}
+
+	required, err := s.IsPasswordChangeRequired(ctx, userUID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return status.Error(codes.FailedPrecondition, "the password must be changed before using this API")
+	}
+	return nil
+}
+
+// tokenScopeMethods are the scopes accepted by the public methods from the
+// scoped API tokens, any of them grants the access. The methods that aren't
+// listed, like the ones managing the tokens or the credentials, are refused to
+// the scoped tokens.
+var tokenScopeMethods = map[string][]string{
+	mgmtpb.MgmtPublicService_Liveness_FullMethodName:      nil,
+	mgmtpb.MgmtPublicService_Readiness_FullMethodName:     nil,
+	mgmtpb.MgmtPublicService_ValidateToken_FullMethodName: nil,
+
+	mgmtpb.MgmtPublicService_GetAuthenticatedUser_FullMethodName:          {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_ListUsers_FullMethodName:                     {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_GetUser_FullMethodName:                       {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_CheckNamespace_FullMethodName:                {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_ListNamespaceConnections_FullMethodName:      {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_GetNamespaceConnection_FullMethodName:        {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_ListPipelineIDsByConnectionID_FullMethodName: {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_ListIntegrations_FullMethodName:              {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_GetIntegration_FullMethodName:                {datamodel.ScopeMgmtRead, datamodel.ScopeMgmtWrite},
+
+	mgmtpb.MgmtPublicService_GetPipelineTriggerCount_FullMethodName:         {datamodel.ScopeMgmtRead, datamodel.ScopePipelinesRead},
+	mgmtpb.MgmtPublicService_ListPipelineTriggerChartRecords_FullMethodName: {datamodel.ScopeMgmtRead, datamodel.ScopePipelinesRead},
+	mgmtpb.MgmtPublicService_GetModelTriggerCount_FullMethodName:            {datamodel.ScopeMgmtRead, datamodel.ScopeModelsRead},
+	mgmtpb.MgmtPublicService_ListModelTriggerChartRecords_FullMethodName:    {datamodel.ScopeMgmtRead, datamodel.ScopeModelsRead},
+
+	mgmtpb.MgmtPublicService_PatchAuthenticatedUser_FullMethodName:    {datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_CreateNamespaceConnection_FullMethodName: {datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_UpdateNamespaceConnection_FullMethodName: {datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_DeleteNamespaceConnection_FullMethodName: {datamodel.ScopeMgmtWrite},
+	mgmtpb.MgmtPublicService_TestNamespaceConnection_FullMethodName:   {datamodel.ScopeMgmtWrite},
+}
+
+// TokenScopeInterceptor refuses the requests authenticated by a scoped API
+// token to the methods its scopes don't grant.
+func TokenScopeInterceptor(s service.Service) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		// The methods open to any token, like the probes, don't look the
+		// token up, so they don't fail on an unknown or expired one.
+		accepted, ok := tokenScopeMethods[info.FullMethod]
+		if ok && accepted == nil {
+			return handler(ctx, req)
+		}
+
+		scopes, err := RequestTokenScopes(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if len(scopes) == 0 {
+			return handler(ctx, req)
+		}
+
+		if ok && slices.ContainsFunc(scopes, func(scope string) bool {
+			return slices.Contains(accepted, scope)
+		}) {
+			return handler(ctx, req)
+		}
+
+		return nil, status.Error(codes.PermissionDenied, "the API token isn't granted a scope required by this API")
+	}
+}
+
+// RequestTokenScopes returns the scopes a request is restricted to. The
+// gateway forwards the Authorization header of the requests it authenticates,
+// along with the scopes ValidateToken returned in HeaderTokenScopes. The
+// scopes of an API token in the Authorization header are looked up here, so a
+// scoped token is restricted even if its scopes aren't forwarded. The scopes
+// in HeaderTokenScopes restrict the other requests.
+func RequestTokenScopes(ctx context.Context, s service.Service) ([]string, error) {
+	authorization := resource.GetRequestSingleHeader(ctx, constant.HeaderAuthorization)
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok && datamodel.IsAPIToken(token) {
+		return s.GetAPITokenScopes(ctx, token)
+	}
+	return datamodel.ParseTokenScopes(resource.GetRequestSingleHeader(ctx, constant.HeaderTokenScopes)), nil
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/service"
+
+	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// apiTokens holds the scopes of the API tokens, by token.
+type apiTokens struct {
+	service.Service
+	scopes map[string][]string
+}
+
+func (s *apiTokens) GetAPITokenScopes(_ context.Context, apiToken string) ([]string, error) {
+	scopes, ok := s.scopes[apiToken]
+	if !ok {
+		return nil, errorsx.ErrUnauthenticated
+	}
+	return scopes, nil
+}
+
+func TestTokenScopeInterceptor(t *testing.T) {
+	s := &apiTokens{scopes: map[string][]string{
+		"instill_sk_scoped":   {datamodel.ScopeMgmtRead},
+		"instill_sk_unscoped": nil,
+	}}
+	interceptor := TokenScopeInterceptor(s)
+
+	call := func(method string, headers ...string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(headers...))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, any) (any, error) {
+			return nil, nil
+		})
+		return err
+	}
+	bearer := func(token string) []string {
+		return []string{constant.HeaderAuthorization, "Bearer " + token}
+	}
+
+	getUser := mgmtpb.MgmtPublicService_GetUser_FullMethodName
+	patchUser := mgmtpb.MgmtPublicService_PatchAuthenticatedUser_FullMethodName
+	changePassword := mgmtpb.MgmtPublicService_AuthChangePassword_FullMethodName
+	liveness := mgmtpb.MgmtPublicService_Liveness_FullMethodName
+
+	// The requests without a scoped token aren't restricted.
+	assert.NoError(t, call(patchUser))
+	assert.NoError(t, call(patchUser, bearer("instill_sk_unscoped")...))
+
+	// The scopes of the token in the Authorization header are looked up,
+	// whether or not the gateway forwards them.
+	assert.NoError(t, call(getUser, bearer("instill_sk_scoped")...))
+	assert.NoError(t, call(liveness, bearer("instill_sk_scoped")...))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(patchUser, bearer("instill_sk_scoped")...)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(changePassword, bearer("instill_sk_scoped")...)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(patchUser,
+		append(bearer("instill_sk_scoped"), constant.HeaderTokenScopes, datamodel.ScopeMgmtWrite)...)))
+
+	err := call(getUser, bearer("instill_sk_unknown")...)
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+	assert.NoError(t, call(liveness, bearer("instill_sk_unknown")...))
+
+	// The forwarded scopes restrict the other requests.
+	session := append(bearer("header.payload.signature"), constant.HeaderTokenScopes, datamodel.ScopeMgmtRead)
+	require.NoError(t, call(getUser, session...))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(patchUser, session...)))
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+// requestTimeout is the timeout of the requests sent to the provider.
+const requestTimeout = 10 * time.Second
+
+// ErrInvalidToken is returned when the provider doesn't issue a valid ID token
+// for an authorization code.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Claims are the claims of an ID token the users are identified and
+// provisioned with.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Provider is the relying party of an OpenID Connect identity provider. The
+// users sign in with the authorization code flow and PKCE.
+type Provider interface {
+	// Issuer identifies the provider in the external identities of the users.
+	Issuer() string
+	// AuthCodeURL returns the URL the users are sent to in order to sign in.
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange exchanges an authorization code for the claims of the ID
+	// token issued with it.
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Claims, error)
+}
+
+// NewProvider returns the provider for the given configuration. Its discovery
+// document is fetched on first use, so the provider doesn't need to be up
+// when the service starts.
+func NewProvider(cfg config.OIDCConfig) (Provider, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("OIDC issuer is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("OIDC client ID is required")
+	}
+	if cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("OIDC redirect URL is required")
+	}
+	if !slices.Contains(cfg.Scopes, gooidc.ScopeOpenID) {
+		return nil, fmt.Errorf("OIDC scopes must include %q", gooidc.ScopeOpenID)
+	}
+
+	return &provider{cfg: cfg, client: &http.Client{Timeout: requestTimeout}}, nil
+}
+
+type provider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu           sync.Mutex
+	oauth2Config *oauth2.Config
+	verifier     *gooidc.IDTokenVerifier
+}
+
+func (p *provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+func (p *provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	oauth2Config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code, nonce, verifier string) (*Claims, error) {
+	oauth2Config, idTokenVerifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = gooidc.ClientContext(ctx, p.client)
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: exchanging authorization code: %w", ErrInvalidToken, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no ID token in the token response", ErrInvalidToken)
+	}
+
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: parsing claims: %w", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+// discover fetches the discovery document of the provider once it succeeds.
+func (p *provider) discover(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2Config != nil {
+		return p.oauth2Config, p.verifier, nil
+	}
+
+	// The keys of the provider are fetched later on with the context of the
+	// discovery, which mustn't be canceled with the request.
+	discovered, err := gooidc.NewProvider(gooidc.ClientContext(context.WithoutCancel(ctx), p.client), p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovering OIDC provider: %w", err)
+	}
+
+	p.oauth2Config = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     discovered.Endpoint(),
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+	}
+	p.verifier = discovered.Verifier(&gooidc.Config{ClientID: p.cfg.ClientID})
+
+	return p.oauth2Config, p.verifier, nil
+}
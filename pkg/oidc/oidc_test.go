@@ -0,0 +1,40 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+func TestNewProvider(t *testing.T) {
+	newConfig := func() config.OIDCConfig {
+		return config.OIDCConfig{
+			Issuer:      "https://idp.example.com",
+			ClientID:    "instill",
+			RedirectURL: "http://localhost:3000/oidc/callback",
+			Scopes:      []string{"openid", "email", "profile"},
+		}
+	}
+
+	// The provider isn't reached until the first login.
+	p, err := NewProvider(newConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com", p.Issuer())
+
+	for name, edit := range map[string]func(*config.OIDCConfig){
+		"issuer":       func(cfg *config.OIDCConfig) { cfg.Issuer = "" },
+		"client ID":    func(cfg *config.OIDCConfig) { cfg.ClientID = "" },
+		"redirect URL": func(cfg *config.OIDCConfig) { cfg.RedirectURL = "" },
+		"openid scope": func(cfg *config.OIDCConfig) { cfg.Scopes = []string{"email"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig()
+			edit(&cfg)
+			_, err := NewProvider(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
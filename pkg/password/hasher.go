@@ -0,0 +1,178 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+// Supported hashing algorithms.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// ErrUnknownHashFormat is returned when a stored hash wasn't produced by any
+// of the supported algorithms.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Hasher hashes and verifies the user passwords.
+type Hasher interface {
+	// Hash hashes a password with the configured algorithm and parameters.
+	Hash(password string) (string, error)
+	// Verify checks a password against a hash produced by any of the
+	// supported algorithms. When the password matches, needsRehash reports
+	// whether the hash should be upgraded to the configured algorithm and
+	// parameters.
+	Verify(password, hash string) (match bool, needsRehash bool, err error)
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+type hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2id   argon2idParams
+}
+
+// NewHasher returns a password hasher for the given configuration.
+func NewHasher(cfg config.PasswordConfig) (Hasher, error) {
+	h := &hasher{
+		algorithm:  cfg.Algorithm,
+		bcryptCost: cfg.Bcrypt.Cost,
+		argon2id: argon2idParams{
+			memory:      cfg.Argon2id.Memory,
+			iterations:  cfg.Argon2id.Iterations,
+			parallelism: cfg.Argon2id.Parallelism,
+			saltLength:  cfg.Argon2id.SaltLength,
+			keyLength:   cfg.Argon2id.KeyLength,
+		},
+	}
+
+	switch h.algorithm {
+	case AlgorithmArgon2id:
+		p := h.argon2id
+		if p.memory == 0 || p.iterations == 0 || p.parallelism == 0 || p.saltLength == 0 || p.keyLength == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters %+v", cfg.Argon2id)
+		}
+	case AlgorithmBcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d", h.bcryptCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hashing algorithm %q", h.algorithm)
+	}
+
+	return h, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	salt := make([]byte, h.argon2id.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	return encodeArgon2id(h.argon2id, salt, password), nil
+}
+
+func (h *hasher) Verify(password, hash string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		needsRehash := h.algorithm != AlgorithmArgon2id ||
+			p.memory != h.argon2id.memory ||
+			p.iterations != h.argon2id.iterations ||
+			p.parallelism != h.argon2id.parallelism ||
+			uint32(len(salt)) != h.argon2id.saltLength ||
+			p.keyLength != h.argon2id.keyLength
+		return true, needsRehash, nil
+
+	case strings.HasPrefix(hash, "$2"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.algorithm != AlgorithmBcrypt || cost != h.bcryptCost, nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
+
+// encodeArgon2id encodes an argon2id hash in the PHC string format, e.g.
+// `$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>`.
+func encodeArgon2id(p argon2idParams, salt []byte, password string) string {
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(hash string) (p argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %w", ErrUnknownHashFormat, err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %w", ErrUnknownHashFormat, err)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %w", ErrUnknownHashFormat, err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %w", ErrUnknownHashFormat, err)
+	}
+	p.saltLength = uint32(len(salt))
+	p.keyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/instill-ai/mgmt-backend/config"
+)
+
+func testConfig(algorithm string) config.PasswordConfig {
+	cfg := config.PasswordConfig{Algorithm: algorithm}
+	cfg.Bcrypt.Cost = bcrypt.MinCost
+	cfg.Argon2id.Memory = 1024
+	cfg.Argon2id.Iterations = 1
+	cfg.Argon2id.Parallelism = 1
+	cfg.Argon2id.SaltLength = 16
+	cfg.Argon2id.KeyLength = 32
+	return cfg
+}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h, err := NewHasher(testConfig(algorithm))
+			require.NoError(t, err)
+
+			hash, err := h.Hash("correct horse")
+			require.NoError(t, err)
+
+			match, needsRehash, err := h.Verify("correct horse", hash)
+			require.NoError(t, err)
+			assert.True(t, match)
+			assert.False(t, needsRehash)
+
+			match, _, err = h.Verify("battery staple", hash)
+			require.NoError(t, err)
+			assert.False(t, match)
+		})
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	argon2idHasher, err := NewHasher(testConfig(AlgorithmArgon2id))
+	require.NoError(t, err)
+
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	t.Run("outdated algorithm", func(t *testing.T) {
+		match, needsRehash, err := argon2idHasher.Verify("password", string(legacyHash))
+		require.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("outdated bcrypt cost", func(t *testing.T) {
+		cfg := testConfig(AlgorithmBcrypt)
+		cfg.Bcrypt.Cost = bcrypt.MinCost + 1
+		h, err := NewHasher(cfg)
+		require.NoError(t, err)
+
+		match, needsRehash, err := h.Verify("password", string(legacyHash))
+		require.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("outdated argon2id parameters", func(t *testing.T) {
+		hash, err := argon2idHasher.Hash("password")
+		require.NoError(t, err)
+
+		cfg := testConfig(AlgorithmArgon2id)
+		cfg.Argon2id.Iterations = 2
+		h, err := NewHasher(cfg)
+		require.NoError(t, err)
+
+		match, needsRehash, err := h.Verify("password", hash)
+		require.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("mismatch doesn't need rehash", func(t *testing.T) {
+		match, needsRehash, err := argon2idHasher.Verify("wrong", string(legacyHash))
+		require.NoError(t, err)
+		assert.False(t, match)
+		assert.False(t, needsRehash)
+	})
+}
+
+func TestHasher_Verify_UnknownFormat(t *testing.T) {
+	h, err := NewHasher(testConfig(AlgorithmArgon2id))
+	require.NoError(t, err)
+
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1024$salt$key", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		_, _, err := h.Verify("password", hash)
+		assert.Error(t, err, hash)
+	}
+}
+
+func TestNewHasher_InvalidConfig(t *testing.T) {
+	_, err := NewHasher(testConfig("md5"))
+	assert.Error(t, err)
+
+	cfg := testConfig(AlgorithmBcrypt)
+	cfg.Bcrypt.Cost = 100
+	_, err = NewHasher(cfg)
+	assert.Error(t, err)
+
+	cfg = testConfig(AlgorithmArgon2id)
+	cfg.Argon2id.Memory = 0
+	_, err = NewHasher(cfg)
+	assert.Error(t, err)
+}
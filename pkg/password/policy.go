@@ -0,0 +1,164 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+)
+
+// Password policy rules, reported as the reason of the violations.
+const (
+	RuleMinLength     = "MIN_LENGTH"
+	RuleUppercase     = "UPPERCASE"
+	RuleLowercase     = "LOWERCASE"
+	RuleDigit         = "DIGIT"
+	RuleSymbol        = "SYMBOL"
+	RuleBreached      = "BREACHED"
+	RuleContainsID    = "CONTAINS_USER_ID"
+	RuleContainsEmail = "CONTAINS_EMAIL"
+	RuleReused        = "REUSED"
+)
+
+// policyField is the request field reported in the violations.
+const policyField = "new_password"
+
+// Identifiers shorter than this aren't looked for in the passwords, as they'd
+// reject too many of them.
+const minIdentifierLength = 3
+
+// NewPolicyError returns the error reporting the rules that a password
+// doesn't satisfy.
+func NewPolicyError(violations ...violation.Violation) error {
+	for i := range violations {
+		violations[i].Field = policyField
+	}
+	return &violation.Error{Subject: "password", Violations: violations}
+}
+
+// Policy validates the new passwords.
+type Policy interface {
+	// Validate checks a password against the policy. The user ID and email
+	// mustn't be part of it. A *violation.Error is returned when some rules
+	// aren't satisfied.
+	Validate(password, userID, email string) error
+}
+
+type policy struct {
+	minLength        int
+	requireUppercase bool
+	requireLowercase bool
+	requireDigit     bool
+	requireSymbol    bool
+	breached         map[string]struct{}
+}
+
+// NewPolicy returns a password policy for the given configuration. The
+// breached password list, if any, is loaded in memory.
+func NewPolicy(cfg config.PasswordConfig) (Policy, error) {
+	p := &policy{
+		minLength:        cfg.Policy.MinLength,
+		requireUppercase: cfg.Policy.RequireUppercase,
+		requireLowercase: cfg.Policy.RequireLowercase,
+		requireDigit:     cfg.Policy.RequireDigit,
+		requireSymbol:    cfg.Policy.RequireSymbol,
+		breached:         map[string]struct{}{},
+	}
+
+	if cfg.Policy.BreachedList != "" {
+		if err := p.loadBreachedList(cfg.Policy.BreachedList); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *policy) loadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading breached password list: %w", err)
+	}
+	return nil
+}
+
+func (p *policy) Validate(password, userID, email string) error {
+	var violations []violation.Violation
+
+	if utf8.RuneCountInString(password) < p.minLength {
+		violations = append(violations, violation.Violation{
+			Rule:        RuleMinLength,
+			Description: fmt.Sprintf("must be at least %d characters long", p.minLength),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.requireUppercase && !hasUpper {
+		violations = append(violations, violation.Violation{Rule: RuleUppercase, Description: "must contain an uppercase letter"})
+	}
+	if p.requireLowercase && !hasLower {
+		violations = append(violations, violation.Violation{Rule: RuleLowercase, Description: "must contain a lowercase letter"})
+	}
+	if p.requireDigit && !hasDigit {
+		violations = append(violations, violation.Violation{Rule: RuleDigit, Description: "must contain a digit"})
+	}
+	if p.requireSymbol && !hasSymbol {
+		violations = append(violations, violation.Violation{Rule: RuleSymbol, Description: "must contain a symbol"})
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.breached[lower]; ok {
+		violations = append(violations, violation.Violation{Rule: RuleBreached, Description: "is a commonly used password"})
+	}
+
+	if containsIdentifier(lower, userID) {
+		violations = append(violations, violation.Violation{Rule: RuleContainsID, Description: "must not contain the user ID"})
+	}
+	// The local part of the address is enough to guess the whole of it.
+	localPart, _, _ := strings.Cut(email, "@")
+	if containsIdentifier(lower, localPart) {
+		violations = append(violations, violation.Violation{Rule: RuleContainsEmail, Description: "must not contain the email address"})
+	}
+
+	if len(violations) > 0 {
+		return NewPolicyError(violations...)
+	}
+	return nil
+}
+
+func containsIdentifier(lowerPassword, identifier string) bool {
+	if utf8.RuneCountInString(identifier) < minIdentifierLength {
+		return false
+	}
+	return strings.Contains(lowerPassword, strings.ToLower(identifier))
+}
@@ -0,0 +1,114 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+func testPolicy(t *testing.T) Policy {
+	t.Helper()
+
+	breachedList := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(breachedList, []byte("# comment\nPassword1\n\nletmein\n"), 0o600))
+
+	cfg := config.PasswordConfig{}
+	cfg.Policy.MinLength = 8
+	cfg.Policy.RequireUppercase = true
+	cfg.Policy.RequireLowercase = true
+	cfg.Policy.RequireDigit = true
+	cfg.Policy.BreachedList = breachedList
+
+	p, err := NewPolicy(cfg)
+	require.NoError(t, err)
+	return p
+}
+
+func violatedRules(err error) []string {
+	var policyErr *violation.Error
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+
+	rules := []string{}
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	p := testPolicy(t)
+
+	testCases := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "ok", password: "Tr0ub4dor&3"},
+		{name: "too short", password: "Ab1", want: []string{RuleMinLength}},
+		{name: "character classes", password: "lowercaseonly", want: []string{RuleUppercase, RuleDigit}},
+		{name: "breached", password: "pASSWORD1", want: []string{RuleBreached}},
+		{name: "user ID", password: "MyJaneDoe2024", want: []string{RuleContainsID}},
+		{name: "email", password: "Jdoe.Mail2024", want: []string{RuleContainsEmail}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Validate(tc.password, "janedoe", "jdoe.mail@example.com")
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.want, violatedRules(err))
+		})
+	}
+}
+
+func TestPolicyError(t *testing.T) {
+	p := testPolicy(t)
+
+	err := p.Validate("short", "janedoe", "jane@example.com")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 3)
+	assert.Equal(t, "new_password", badRequest.FieldViolations[0].Field)
+	assert.Equal(t, RuleMinLength, badRequest.FieldViolations[0].Reason)
+}
+
+func TestNewPolicy_MissingBreachedList(t *testing.T) {
+	cfg := config.PasswordConfig{}
+	cfg.Policy.BreachedList = filepath.Join(t.TempDir(), "missing.txt")
+
+	_, err := NewPolicy(cfg)
+	assert.Error(t, err)
+}
+
+func TestNewPolicy_ShippedBreachedList(t *testing.T) {
+	cfg := config.PasswordConfig{}
+	cfg.Policy.BreachedList = "../../config/breached-passwords.txt"
+
+	p, err := NewPolicy(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RuleBreached}, violatedRules(p.Validate("P@ssw0rd", "", "")))
+}
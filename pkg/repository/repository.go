@@ -3,13 +3,18 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.einride.tech/aip/filtering"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
@@ -53,6 +58,7 @@ type Repository interface {
 	CreateUser(ctx context.Context, user *datamodel.Owner) error
 	GetUser(ctx context.Context, id string, includeAvatar bool) (*datamodel.Owner, error)
 	GetUserByUID(ctx context.Context, uid uuid.UUID) (*datamodel.Owner, error)
+	GetUserByEmail(ctx context.Context, email string) (*datamodel.Owner, error)
 	UpdateUser(ctx context.Context, id string, user *datamodel.Owner) error
 	DeleteUser(ctx context.Context, id string) error
 
@@ -72,18 +78,64 @@ type Repository interface {
 	CreateOwner(ctx context.Context, ownerType string, user *datamodel.Owner) error
 	UpdateOwner(ctx context.Context, ownerType string, id string, user *datamodel.Owner) error
 	DeleteOwner(ctx context.Context, ownerType string, id string) error
+	ListOwnersByOffset(ctx context.Context, ownerType, issuer string, offset, limit int, where clause.Expr) ([]*datamodel.Owner, int64, error)
 
 	GetUserPasswordHash(ctx context.Context, uid uuid.UUID) (string, time.Time, error)
 	UpdateUserPasswordHash(ctx context.Context, uid uuid.UUID, newPassword string, updateTime time.Time) error
+	ChangeUserPasswordHash(ctx context.Context, uid uuid.UUID, newPassword string, updateTime time.Time, historySize int) error
+	ListPasswordHistory(ctx context.Context, ownerUID uuid.UUID, limit int) ([]string, error)
+	GetUserPasswordChangeRequired(ctx context.Context, uid uuid.UUID) (bool, error)
+	UpdateUserPasswordChangeRequired(ctx context.Context, uid uuid.UUID, required bool) error
 
 	CreateToken(ctx context.Context, token *datamodel.Token) error
-	ListTokens(ctx context.Context, owner string, pageSize int64, pageToken string) ([]*datamodel.Token, int64, string, error)
+	ListTokens(ctx context.Context, owner string, pageSize int64, pageToken string, state datamodel.TokenState) ([]*datamodel.Token, int64, string, error)
 	GetToken(ctx context.Context, owner string, id string) (*datamodel.Token, error)
 	DeleteToken(ctx context.Context, owner string, id string) error
-	LookupToken(ctx context.Context, token string) (*datamodel.Token, error)
-	UpdateTokenLastUseTime(ctx context.Context, accessToken string) error
+	LookupToken(ctx context.Context, tokenHash string) (*datamodel.Token, error)
+	UpdateTokenState(ctx context.Context, owner, id string, from, to datamodel.TokenState) error
+	RotateToken(ctx context.Context, owner, id, tokenHash string, next *datamodel.Token) error
+	BufferTokenLastUse(ctx context.Context, tokenHash string, use *datamodel.TokenLastUse) error
+	GetBufferedTokenLastUses(ctx context.Context, tokenHashes ...string) (map[string]*datamodel.TokenLastUse, error)
+	FlushTokenLastUses(ctx context.Context) (int64, error)
 
 	ListAllValidTokens(ctx context.Context) ([]datamodel.Token, error)
+	CountActiveTokens(ctx context.Context, owner string) (int64, error)
+	UpdateTokenPolicyViolations(ctx context.Context, uid uuid.UUID, rules []string) error
+	ExpireTokens(ctx context.Context) (int64, error)
+	DeleteExpiredTokens(ctx context.Context, expireTime time.Time) (int64, error)
+	RevokePreviousTokens(ctx context.Context) (int64, error)
+
+	CreateSigningKey(ctx context.Context, key *datamodel.SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]*datamodel.SigningKey, error)
+	ExpireSigningKeys(ctx context.Context, exceptKID string, expireTime time.Time) error
+	DeleteExpiredSigningKeys(ctx context.Context) error
+
+	CreateRefreshTokenFamily(ctx context.Context, family *datamodel.RefreshTokenFamily, token *datamodel.RefreshToken) error
+	GetRefreshTokenFamily(ctx context.Context, uid uuid.UUID) (*datamodel.RefreshTokenFamily, error)
+	ListActiveRefreshTokenFamilies(ctx context.Context, ownerUID uuid.UUID) ([]*datamodel.RefreshTokenFamily, error)
+	UpdateRefreshTokenFamilyActivity(ctx context.Context, uid uuid.UUID, userAgent, ipAddress string, lastActivityTime time.Time) error
+	RevokeRefreshTokenFamily(ctx context.Context, uid uuid.UUID) error
+	RevokeRefreshTokenFamilies(ctx context.Context, ownerUID uuid.UUID) ([]uuid.UUID, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*datamodel.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, usedUID uuid.UUID, next *datamodel.RefreshToken) error
+
+	GetTOTPFactor(ctx context.Context, ownerUID uuid.UUID) (*datamodel.TOTPFactor, error)
+	CreateTOTPFactor(ctx context.Context, factor *datamodel.TOTPFactor) error
+	EnableTOTPFactor(ctx context.Context, ownerUID uuid.UUID, recoveryCodes []*datamodel.RecoveryCode) error
+	DeleteTOTPFactor(ctx context.Context, ownerUID uuid.UUID) error
+	UseRecoveryCode(ctx context.Context, ownerUID uuid.UUID, codeHash string) error
+
+	CreatePasswordResetToken(ctx context.Context, token *datamodel.PasswordResetToken) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*datamodel.PasswordResetToken, error)
+	ResetUserPasswordHash(ctx context.Context, tokenHash string, ownerUID uuid.UUID, newPassword string, updateTime time.Time, historySize int) error
+
+	CreateEmailVerificationToken(ctx context.Context, token *datamodel.EmailVerificationToken) error
+	GetEmailVerificationToken(ctx context.Context, tokenHash string) (*datamodel.EmailVerificationToken, error)
+	GetPendingEmailVerificationToken(ctx context.Context, ownerUID uuid.UUID) (*datamodel.EmailVerificationToken, error)
+	VerifyUserEmail(ctx context.Context, token *datamodel.EmailVerificationToken) error
+
+	CreateOwnerIdentity(ctx context.Context, identity *datamodel.OwnerIdentity) error
+	GetOwnerIdentity(ctx context.Context, issuer, subject string) (*datamodel.OwnerIdentity, error)
 }
 
 type repository struct {
@@ -152,6 +204,21 @@ func (r *repository) GetUserByUID(ctx context.Context, uid uuid.UUID) (*datamode
 	return ownerWithType(owner, "user")
 }
 
+func (r *repository) GetUserByEmail(ctx context.Context, email string) (*datamodel.Owner, error) {
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	var owner datamodel.Owner
+	if err := db.Model(&datamodel.Owner{}).
+		Omit("profile_avatar").
+		Where("lower(email) = ? AND owner_type = ?", datamodel.NormalizeEmail(email), "user").
+		First(&owner).
+		Error; err != nil {
+
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting user by email: %w", err))
+	}
+	return &owner, nil
+}
+
 func (r *repository) UpdateUser(ctx context.Context, id string, user *datamodel.Owner) error {
 	return r.UpdateOwner(ctx, "user", id, user)
 }
@@ -285,6 +352,42 @@ func (r *repository) ListOwners(ctx context.Context, ownerType string, pageSize
 	return owners, totalSize, "", nil
 }
 
+// ListOwnersByOffset returns the owners of a type linked to an identity at the
+// issuer and matching a condition, from the oldest, and their total number.
+// The SCIM queries page through them by offset.
+func (r *repository) ListOwnersByOffset(ctx context.Context, ownerType, issuer string, offset, limit int, where clause.Expr) ([]*datamodel.Owner, int64, error) {
+
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	queryBuilder := db.Model(&datamodel.Owner{}).
+		Omit("profile_avatar").
+		Where("owner_type = ?", ownerType).
+		Where("uid IN (?)", db.Model(&datamodel.OwnerIdentity{}).Select("owner_uid").Where("issuer = ?", issuer))
+	if where.SQL != "" {
+		queryBuilder = queryBuilder.Where(where)
+	}
+	// The conditions are shared by the count and the page queries.
+	queryBuilder = queryBuilder.Session(&gorm.Session{})
+
+	totalSize := int64(0)
+	if err := queryBuilder.Count(&totalSize).Error; err != nil {
+		return nil, 0, errorsx.RepositoryErr(fmt.Errorf("counting owners: %w", err))
+	}
+
+	owners := []*datamodel.Owner{}
+	if limit == 0 || int64(offset) >= totalSize {
+		return owners, totalSize, nil
+	}
+	if err := queryBuilder.
+		Order("create_time ASC, uid ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&owners).Error; err != nil {
+		return nil, 0, errorsx.RepositoryErr(fmt.Errorf("listing owners: %w", err))
+	}
+	return owners, totalSize, nil
+}
+
 func (r *repository) CreateOwner(ctx context.Context, ownerType string, owner *datamodel.Owner) error {
 	r.PinUser(ctx)
 	db := r.CheckPinnedUser(ctx, r.db)
@@ -339,17 +442,31 @@ func (r *repository) UpdateOwner(ctx context.Context, ownerType string, id strin
 	r.PinUser(ctx)
 	db := r.CheckPinnedUser(ctx, r.db)
 
-	// Use Select("*") to force GORM to update ALL fields including zero-values
-	// (e.g., newsletter_subscription = false, empty strings).
-	// Without Select("*"), GORM skips zero-value fields by default.
-	if err := db.Select("*").
-		Omit("UID").
-		Omit("password_hash").
-		Model(&datamodel.Owner{}).
-		Where("owner_type = ?", ownerType).
-		Where("id = ?", id).
-		Updates(owner).
-		Error; err != nil {
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		// The email is verified through the verification tokens only, a new
+		// address isn't verified.
+		if err := tx.Model(&datamodel.Owner{}).
+			Where("owner_type = ?", ownerType).
+			Where("id = ?", id).
+			Where("email IS DISTINCT FROM ?", owner.Email).
+			Update("email_verified", false).
+			Error; err != nil {
+			return err
+		}
+
+		// Use Select("*") to force GORM to update ALL fields including zero-values
+		// (e.g., newsletter_subscription = false, empty strings).
+		// Without Select("*"), GORM skips zero-value fields by default.
+		return tx.Select("*").
+			Omit("UID").
+			Omit("password_hash").
+			Omit("email_verified").
+			Model(&datamodel.Owner{}).
+			Where("owner_type = ?", ownerType).
+			Where("id = ?", id).
+			Updates(owner).
+			Error
+	}); err != nil {
 
 		return errorsx.RepositoryErr(fmt.Errorf("updating owner: %w", err))
 	}
@@ -396,8 +513,7 @@ func (r *repository) UpdateUserPasswordHash(ctx context.Context, uid uuid.UUID,
 	r.PinUser(ctx)
 	db := r.CheckPinnedUser(ctx, r.db)
 
-	if err := db.Select("*").
-		Omit("UID").
+	if err := db.Select("PasswordHash", "PasswordUpdateTime").
 		Model(&datamodel.Password{}).
 		Where("uid = ?", uid.String()).
 		Updates(datamodel.Password{
@@ -411,6 +527,108 @@ func (r *repository) UpdateUserPasswordHash(ctx context.Context, uid uuid.UUID,
 	return nil
 }
 
+// ChangeUserPasswordHash replaces the password hash of a user and keeps the
+// previous one in the password history, along with the historySize-1 ones
+// before it.
+func (r *repository) ChangeUserPasswordHash(ctx context.Context, uid uuid.UUID, newPassword string, updateTime time.Time, historySize int) error {
+
+	r.PinUser(ctx)
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return changePasswordHash(tx, uid, newPassword, updateTime, historySize)
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("changing password hash: %w", err))
+	}
+
+	return nil
+}
+
+// changePasswordHash replaces the password hash of a user within a
+// transaction, keeping the previous one in the password history.
+func changePasswordHash(tx *gorm.DB, uid uuid.UUID, newPassword string, updateTime time.Time, historySize int) error {
+	var pw datamodel.Password
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pw, "uid = ?", uid.String()).Error; err != nil {
+		return err
+	}
+
+	if historySize > 0 && pw.PasswordHash.Valid {
+		historyUID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&datamodel.PasswordHistory{
+			Base:         datamodel.Base{UID: historyUID},
+			OwnerUID:     uid,
+			PasswordHash: pw.PasswordHash.String,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("owner_uid = ? AND uid NOT IN (?)", uid, tx.Model(&datamodel.PasswordHistory{}).
+		Select("uid").
+		Where("owner_uid = ?", uid).
+		Order("create_time DESC").
+		Limit(historySize)).
+		Delete(&datamodel.PasswordHistory{}).Error; err != nil {
+		return err
+	}
+
+	// A user required to change their password just did.
+	return tx.Select("PasswordHash", "PasswordUpdateTime", "PasswordChangeRequired").
+		Model(&datamodel.Password{}).
+		Where("uid = ?", uid.String()).
+		Updates(datamodel.Password{
+			PasswordHash:           sql.NullString{String: newPassword, Valid: true},
+			PasswordUpdateTime:     updateTime,
+			PasswordChangeRequired: false,
+		}).Error
+}
+
+// ListPasswordHistory returns the previous password hashes of a user, most
+// recent first.
+func (r *repository) ListPasswordHistory(ctx context.Context, ownerUID uuid.UUID, limit int) ([]string, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var hashes []string
+	if err := db.Model(&datamodel.PasswordHistory{}).
+		Where("owner_uid = ?", ownerUID).
+		Order("create_time DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error; err != nil {
+
+		return nil, errorsx.RepositoryErr(fmt.Errorf("listing password history: %w", err))
+	}
+	return hashes, nil
+}
+
+func (r *repository) GetUserPasswordChangeRequired(ctx context.Context, uid uuid.UUID) (bool, error) {
+
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	var pw datamodel.Password
+	if err := db.Select("uid", "password_change_required").First(&pw, "uid = ?", uid.String()).Error; err != nil {
+		return false, errorsx.RepositoryErr(fmt.Errorf("getting password change requirement: %w", err))
+	}
+	return pw.PasswordChangeRequired, nil
+}
+
+func (r *repository) UpdateUserPasswordChangeRequired(ctx context.Context, uid uuid.UUID, required bool) error {
+
+	r.PinUser(ctx)
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	if err := db.Model(&datamodel.Password{}).
+		Where("uid = ?", uid.String()).
+		Update("password_change_required", required).Error; err != nil {
+
+		return errorsx.RepositoryErr(fmt.Errorf("updating password change requirement: %w", err))
+	}
+	return nil
+}
+
 // TODO: use general filter
 func (r *repository) ListAllValidTokens(ctx context.Context) (tokens []datamodel.Token, err error) {
 
@@ -435,15 +653,31 @@ func (r *repository) ListAllValidTokens(ctx context.Context) (tokens []datamodel
 	return tokens, nil
 }
 
-func (r *repository) ListTokens(ctx context.Context, owner string, pageSize int64, pageToken string) (tokens []*datamodel.Token, totalSize int64, nextPageToken string, err error) {
+// tokenStateScope filters the tokens by state, StateUnspecified keeps them
+// all. The tokens past their expiration are expired, whether the worker has
+// marked them or not.
+func tokenStateScope(state datamodel.TokenState) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch state {
+		case datamodel.StateUnspecified:
+			return db
+		case datamodel.StateExpired:
+			return db.Where("(state = ? OR expire_time <= ?)", state, time.Now())
+		default:
+			return db.Where("state = ? AND expire_time > ?", state, time.Now())
+		}
+	}
+}
+
+func (r *repository) ListTokens(ctx context.Context, owner string, pageSize int64, pageToken string, state datamodel.TokenState) (tokens []*datamodel.Token, totalSize int64, nextPageToken string, err error) {
 
 	db := r.CheckPinnedUser(ctx, r.db)
 
-	if err := db.Model(&datamodel.Token{}).Where("owner = ?", owner).Count(&totalSize).Error; err != nil {
+	if err := db.Model(&datamodel.Token{}).Where("owner = ?", owner).Scopes(tokenStateScope(state)).Count(&totalSize).Error; err != nil {
 		return nil, 0, "", errorsx.RepositoryErr(fmt.Errorf("counting tokens: %w", err))
 	}
 
-	queryBuilder := db.Model(&datamodel.Token{}).Order("create_time DESC, uid DESC").Where("owner = ?", owner)
+	queryBuilder := db.Model(&datamodel.Token{}).Order("create_time DESC, uid DESC").Where("owner = ?", owner).Scopes(tokenStateScope(state))
 
 	if pageSize == 0 {
 		pageSize = DefaultPageSize
@@ -481,6 +715,7 @@ func (r *repository) ListTokens(ctx context.Context, owner string, pageSize int6
 		lastItem := &datamodel.Token{}
 		if err := db.Model(&datamodel.Token{}).
 			Where("owner = ?", owner).
+			Scopes(tokenStateScope(state)).
 			Order("create_time ASC, uid ASC").
 			Limit(1).Find(lastItem).Error; err != nil {
 
@@ -519,11 +754,13 @@ func (r *repository) GetToken(ctx context.Context, owner string, id string) (*da
 	return &token, nil
 }
 
-func (r *repository) LookupToken(ctx context.Context, accessToken string) (*datamodel.Token, error) {
+func (r *repository) LookupToken(ctx context.Context, tokenHash string) (*datamodel.Token, error) {
 
 	db := r.CheckPinnedUser(ctx, r.db)
 
-	queryBuilder := db.Model(&datamodel.Token{}).Where("access_token = ?", accessToken)
+	// The previous secret of a rotated token is looked up too, the caller
+	// checks its grace period.
+	queryBuilder := db.Model(&datamodel.Token{}).Where("access_token_hash = ? OR previous_access_token_hash = ?", tokenHash, tokenHash)
 	var token datamodel.Token
 	if err := queryBuilder.First(&token).Error; err != nil {
 		return nil, errorsx.RepositoryErr(fmt.Errorf("looking up token: %w", err))
@@ -531,6 +768,54 @@ func (r *repository) LookupToken(ctx context.Context, accessToken string) (*data
 	return &token, nil
 }
 
+// UpdateTokenState moves a token from a state to another, it isn't updated
+// when it isn't in the from state or has expired.
+func (r *repository) UpdateTokenState(ctx context.Context, owner, id string, from, to datamodel.TokenState) error {
+
+	r.PinUser(ctx)
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	result := db.Model(&datamodel.Token{}).
+		Where("id = ? AND owner = ? AND state = ? AND expire_time > ?", id, owner, from, time.Now()).
+		Update("state", to)
+	if result.Error != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("updating token state: %w", result.Error))
+	}
+
+	if result.RowsAffected == 0 {
+		return errorsx.ErrNoDataUpdated
+	}
+
+	return nil
+}
+
+// RotateToken replaces the secret of a token, identified by its current hash
+// so concurrent rotations don't overwrite each other. The current secret
+// becomes the previous one, along with the end of its grace period.
+func (r *repository) RotateToken(ctx context.Context, owner, id, tokenHash string, next *datamodel.Token) error {
+
+	r.PinUser(ctx)
+	db := r.CheckPinnedUser(ctx, r.db)
+
+	result := db.Model(&datamodel.Token{}).
+		Where("id = ? AND owner = ? AND access_token_hash = ?", id, owner, tokenHash).
+		Updates(map[string]any{
+			"access_token_hash":          next.AccessTokenHash,
+			"access_token_prefix":        next.AccessTokenPrefix,
+			"previous_access_token_hash": next.PreviousAccessTokenHash,
+			"previous_expire_time":       next.PreviousExpireTime,
+		})
+	if result.Error != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("rotating token: %w", result.Error))
+	}
+
+	if result.RowsAffected == 0 {
+		return errorsx.ErrNoDataUpdated
+	}
+
+	return nil
+}
+
 func (r *repository) DeleteToken(ctx context.Context, owner string, id string) error {
 
 	r.PinUser(ctx)
@@ -551,25 +836,710 @@ func (r *repository) DeleteToken(ctx context.Context, owner string, id string) e
 	return nil
 }
 
-func (r *repository) UpdateTokenLastUseTime(ctx context.Context, accessToken string) error {
-	r.PinUser(ctx)
+// The last uses of the API tokens are buffered in Redis by token hash, they
+// would be the hottest write path of the database otherwise. The worker
+// writes them to the tokens in batches.
+const (
+	tokenLastUseKey         = "api_token_last_use"
+	tokenLastUseFlushingKey = "api_token_last_use:flushing"
+	tokenLastUseBatchSize   = 100
+)
+
+// BufferTokenLastUse records the use of a token, by the hash it was used
+// with, until the buffer is flushed.
+func (r *repository) BufferTokenLastUse(ctx context.Context, tokenHash string, use *datamodel.TokenLastUse) error {
+	b, err := json.Marshal(use)
+	if err != nil {
+		return err
+	}
+	if err := r.redisClient.HSet(ctx, tokenLastUseKey, tokenHash, string(b)).Err(); err != nil {
+		return fmt.Errorf("buffering token last use: %w", err)
+	}
+	return nil
+}
+
+// GetBufferedTokenLastUses returns the latest buffered use of each of the
+// hashes that has one pending. Both buffers are read in a single round trip.
+func (r *repository) GetBufferedTokenLastUses(ctx context.Context, tokenHashes ...string) (map[string]*datamodel.TokenLastUse, error) {
+	uses := map[string]*datamodel.TokenLastUse{}
+	if len(tokenHashes) == 0 {
+		return uses, nil
+	}
+
+	// The buffer being flushed is still pending.
+	pipe := r.redisClient.Pipeline()
+	cmds := []*redis.SliceCmd{
+		pipe.HMGet(ctx, tokenLastUseKey, tokenHashes...),
+		pipe.HMGet(ctx, tokenLastUseFlushingKey, tokenHashes...),
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("getting buffered token last uses: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		for i, value := range cmd.Val() {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			use := &datamodel.TokenLastUse{}
+			if err := json.Unmarshal([]byte(s), use); err != nil {
+				continue
+			}
+			if last, ok := uses[tokenHashes[i]]; !ok || use.Time.After(last.Time) {
+				uses[tokenHashes[i]] = use
+			}
+		}
+	}
+	return uses, nil
+}
+
+// FlushTokenLastUses writes the buffered uses to the tokens and returns how
+// many were updated. The buffer is swapped first, the uses recorded during
+// the flush are written the next time. A failed flush is resumed, the tokens
+// aren't updated with uses older than theirs.
+func (r *repository) FlushTokenLastUses(ctx context.Context) (int64, error) {
+
+	flushing, err := r.redisClient.Exists(ctx, tokenLastUseFlushingKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("checking token last use buffer: %w", err)
+	}
+	if flushing == 0 {
+		pending, err := r.redisClient.Exists(ctx, tokenLastUseKey).Result()
+		if err != nil {
+			return 0, fmt.Errorf("checking token last use buffer: %w", err)
+		}
+		if pending == 0 {
+			return 0, nil
+		}
+		if err := r.redisClient.Rename(ctx, tokenLastUseKey, tokenLastUseFlushingKey).Err(); err != nil {
+			return 0, fmt.Errorf("swapping token last use buffer: %w", err)
+		}
+	}
+
+	values, err := r.redisClient.HGetAll(ctx, tokenLastUseFlushingKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("reading token last use buffer: %w", err)
+	}
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+	table := db.NamingStrategy.TableName("Token")
+
+	// A batch is written in a single statement. The uses of the current and
+	// the previous hash of a token are joined to it and the latest one wins.
+	var updated int64
+	for batch := range slices.Chunk(slices.Sorted(maps.Keys(values)), tokenLastUseBatchSize) {
+		rows := make([]string, 0, len(batch))
+		args := make([]any, 0, 4*len(batch))
+		for _, tokenHash := range batch {
+			use := &datamodel.TokenLastUse{}
+			if err := json.Unmarshal([]byte(values[tokenHash]), use); err != nil {
+				continue
+			}
+			rows = append(rows, "(?, ?::timestamptz, ?, ?)")
+			args = append(args, tokenHash, use.Time, use.IP, use.UserAgent)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		result := db.Exec(fmt.Sprintf(`UPDATE %[1]s SET
+			last_use_time = u.use_time,
+			last_use_ip = COALESCE(NULLIF(u.ip, ''), %[1]s.last_use_ip),
+			last_use_user_agent = COALESCE(NULLIF(u.user_agent, ''), %[1]s.last_use_user_agent),
+			update_time = now()
+		FROM (
+			SELECT DISTINCT ON (t.uid) t.uid, v.use_time, v.ip, v.user_agent
+			FROM %[1]s AS t
+			JOIN (VALUES %[2]s) AS v (token_hash, use_time, ip, user_agent)
+				ON v.token_hash IN (t.access_token_hash, t.previous_access_token_hash)
+			ORDER BY t.uid, v.use_time DESC
+		) AS u
+		WHERE %[1]s.uid = u.uid AND (%[1]s.last_use_time IS NULL OR %[1]s.last_use_time < u.use_time)`,
+			table, strings.Join(rows, ", ")), args...)
+		if result.Error != nil {
+			return updated, errorsx.RepositoryErr(fmt.Errorf("flushing token last uses: %w", result.Error))
+		}
+		updated += result.RowsAffected
+	}
+
+	if err := r.redisClient.Del(ctx, tokenLastUseFlushingKey).Err(); err != nil {
+		return updated, fmt.Errorf("deleting token last use buffer: %w", err)
+	}
+
+	return updated, nil
+}
+
+// CountActiveTokens returns the number of active tokens of an owner that
+// haven't expired.
+func (r *repository) CountActiveTokens(ctx context.Context, owner string) (count int64, err error) {
+
 	db := r.CheckPinnedUser(ctx, r.db)
 
+	if err := db.Model(&datamodel.Token{}).
+		Where("owner = ?", owner).
+		Scopes(tokenStateScope(datamodel.StateActive)).
+		Count(&count).Error; err != nil {
+		return 0, errorsx.RepositoryErr(fmt.Errorf("counting active tokens: %w", err))
+	}
+
+	return count, nil
+}
+
+// UpdateTokenPolicyViolations records the rules of the token policy a token
+// doesn't satisfy.
+func (r *repository) UpdateTokenPolicyViolations(ctx context.Context, uid uuid.UUID, rules []string) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if rules == nil {
+		rules = []string{}
+	}
+	result := db.Model(&datamodel.Token{}).
+		Where("uid = ?", uid).
+		Update("policy_violations", datatypes.JSONSlice[string](rules))
+	if result.Error != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("updating token policy violations: %w", result.Error))
+	}
+
+	if result.RowsAffected == 0 {
+		return errorsx.ErrNoDataUpdated
+	}
+
+	return nil
+}
+
+// ExpireTokens marks the active tokens past their expiration time as expired
+// and returns how many were.
+func (r *repository) ExpireTokens(ctx context.Context) (int64, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
 	result := db.Model(&datamodel.Token{}).
-		Where("access_token = ?", accessToken).
-		Update("last_use_time", time.Now())
+		Where("state = ? AND expire_time <= ?", datamodel.StateActive, time.Now()).
+		Update("state", datamodel.StateExpired)
+	if result.Error != nil {
+		return 0, errorsx.RepositoryErr(fmt.Errorf("expiring tokens: %w", result.Error))
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteExpiredTokens deletes the tokens that expired before expireTime,
+// whatever their state, and returns how many were.
+func (r *repository) DeleteExpiredTokens(ctx context.Context, expireTime time.Time) (int64, error) {
 
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	result := db.Where("expire_time < ?", expireTime).
+		Delete(&datamodel.Token{})
+	if result.Error != nil {
+		return 0, errorsx.RepositoryErr(fmt.Errorf("deleting expired tokens: %w", result.Error))
+	}
+	return result.RowsAffected, nil
+}
+
+// RevokePreviousTokens clears the previous secrets of the rotated tokens once
+// their grace period is over and returns how many were.
+func (r *repository) RevokePreviousTokens(ctx context.Context) (int64, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	result := db.Model(&datamodel.Token{}).
+		Where("previous_expire_time <= ?", time.Now()).
+		Updates(map[string]any{
+			"previous_access_token_hash": nil,
+			"previous_expire_time":       nil,
+		})
 	if result.Error != nil {
-		return errorsx.RepositoryErr(fmt.Errorf("updating token last use time: %w", result.Error))
+		return 0, errorsx.RepositoryErr(fmt.Errorf("revoking previous tokens: %w", result.Error))
 	}
+	return result.RowsAffected, nil
+}
+
+// The signing keys are shared by all the replicas, which must see a rotation
+// right away, so they're always read from the primary database.
+
+func (r *repository) CreateSigningKey(ctx context.Context, key *datamodel.SigningKey) error {
 
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Model(&datamodel.SigningKey{}).Create(key).Error; err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating signing key: %w", err))
+	}
+	return nil
+}
+
+// ListSigningKeys returns the signing keys that haven't expired, newest first.
+func (r *repository) ListSigningKeys(ctx context.Context) ([]*datamodel.SigningKey, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var keys []*datamodel.SigningKey
+	if err := db.Model(&datamodel.SigningKey{}).
+		Where("expire_time IS NULL OR expire_time > ?", time.Now()).
+		Order("create_time DESC").
+		Find(&keys).Error; err != nil {
+
+		return nil, errorsx.RepositoryErr(fmt.Errorf("listing signing keys: %w", err))
+	}
+	return keys, nil
+}
+
+// ExpireSigningKeys sets the expiration of the keys that don't have one,
+// except for the one identified by exceptKID.
+func (r *repository) ExpireSigningKeys(ctx context.Context, exceptKID string, expireTime time.Time) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Model(&datamodel.SigningKey{}).
+		Where("expire_time IS NULL AND kid <> ?", exceptKID).
+		Update("expire_time", expireTime).Error; err != nil {
+
+		return errorsx.RepositoryErr(fmt.Errorf("expiring signing keys: %w", err))
+	}
+	return nil
+}
+
+func (r *repository) DeleteExpiredSigningKeys(ctx context.Context) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Where("expire_time <= ?", time.Now()).
+		Delete(&datamodel.SigningKey{}).Error; err != nil {
+
+		return errorsx.RepositoryErr(fmt.Errorf("deleting expired signing keys: %w", err))
+	}
+	return nil
+}
+
+// The refresh tokens are read from the primary database too, as a token that
+// was just rotated must be detected when it's presented again.
+
+// CreateRefreshTokenFamily creates a family along with its first token.
+func (r *repository) CreateRefreshTokenFamily(ctx context.Context, family *datamodel.RefreshTokenFamily, token *datamodel.RefreshToken) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(family).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating refresh token family: %w", err))
+	}
+	return nil
+}
+
+func (r *repository) GetRefreshTokenFamily(ctx context.Context, uid uuid.UUID) (*datamodel.RefreshTokenFamily, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var family datamodel.RefreshTokenFamily
+	if err := db.First(&family, "uid = ?", uid).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting refresh token family: %w", err))
+	}
+	return &family, nil
+}
+
+// ListActiveRefreshTokenFamilies lists the families of a user that haven't been
+// revoked and still hold a valid token, most recently active first.
+func (r *repository) ListActiveRefreshTokenFamilies(ctx context.Context, ownerUID uuid.UUID) ([]*datamodel.RefreshTokenFamily, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var families []*datamodel.RefreshTokenFamily
+	if err := db.Model(&datamodel.RefreshTokenFamily{}).
+		Where("owner_uid = ? AND revoke_time IS NULL", ownerUID).
+		Where("EXISTS (?)", db.Model(&datamodel.RefreshToken{}).
+			Select("1").
+			Where("refresh_token.family_uid = refresh_token_family.uid AND use_time IS NULL AND expire_time > ?", time.Now())).
+		Order("last_activity_time DESC, uid DESC").
+		Find(&families).Error; err != nil {
+
+		return nil, errorsx.RepositoryErr(fmt.Errorf("listing refresh token families: %w", err))
+	}
+	return families, nil
+}
+
+// UpdateRefreshTokenFamilyActivity records the client that last used a family.
+func (r *repository) UpdateRefreshTokenFamilyActivity(ctx context.Context, uid uuid.UUID, userAgent, ipAddress string, lastActivityTime time.Time) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Model(&datamodel.RefreshTokenFamily{}).
+		Where("uid = ?", uid).
+		Updates(map[string]any{
+			"user_agent":         userAgent,
+			"ip_address":         ipAddress,
+			"last_activity_time": lastActivityTime,
+		}).Error; err != nil {
+
+		return errorsx.RepositoryErr(fmt.Errorf("updating refresh token family activity: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all the tokens in a family. Revoking a
+// family twice keeps the first revocation time.
+func (r *repository) RevokeRefreshTokenFamily(ctx context.Context, uid uuid.UUID) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Model(&datamodel.RefreshTokenFamily{}).
+		Where("uid = ? AND revoke_time IS NULL", uid).
+		Update("revoke_time", time.Now()).Error; err != nil {
+
+		return errorsx.RepositoryErr(fmt.Errorf("revoking refresh token family: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamilies revokes all the families of a user and returns
+// the UIDs of the ones that weren't revoked yet.
+func (r *repository) RevokeRefreshTokenFamilies(ctx context.Context, ownerUID uuid.UUID) ([]uuid.UUID, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var families []*datamodel.RefreshTokenFamily
+	if err := db.Model(&families).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "uid"}}}).
+		Where("owner_uid = ? AND revoke_time IS NULL", ownerUID).
+		Update("revoke_time", time.Now()).Error; err != nil {
+
+		return nil, errorsx.RepositoryErr(fmt.Errorf("revoking refresh token families: %w", err))
+	}
+
+	uids := make([]uuid.UUID, 0, len(families))
+	for _, family := range families {
+		uids = append(uids, family.UID)
+	}
+	return uids, nil
+}
+
+func (r *repository) GetRefreshToken(ctx context.Context, tokenHash string) (*datamodel.RefreshToken, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var token datamodel.RefreshToken
+	if err := db.First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting refresh token: %w", err))
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks a token as used and adds the next one to its
+// family. If the token was already used, errorsx.ErrNoDataUpdated is
+// returned and nothing is created, so concurrent refreshes with the same token
+// can't both succeed.
+func (r *repository) RotateRefreshToken(ctx context.Context, usedUID uuid.UUID, next *datamodel.RefreshToken) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&datamodel.RefreshToken{}).
+			Where("uid = ? AND use_time IS NULL", usedUID).
+			Update("use_time", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorsx.ErrNoDataUpdated
+		}
+
+		return tx.Create(next).Error
+	})
+	if errors.Is(err, errorsx.ErrNoDataUpdated) {
+		return err
+	}
+	if err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("rotating refresh token: %w", err))
+	}
+	return nil
+}
+
+// The MFA factors are read from the primary database, as a factor that was
+// just enabled or disabled must be taken into account on the next login.
+
+func (r *repository) GetTOTPFactor(ctx context.Context, ownerUID uuid.UUID) (*datamodel.TOTPFactor, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var factor datamodel.TOTPFactor
+	if err := db.First(&factor, "owner_uid = ?", ownerUID).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting TOTP factor: %w", err))
+	}
+	return &factor, nil
+}
+
+// CreateTOTPFactor creates a pending factor, replacing the pending one the
+// user may already have.
+func (r *repository) CreateTOTPFactor(ctx context.Context, factor *datamodel.TOTPFactor) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_uid = ? AND enable_time IS NULL", factor.OwnerUID).
+			Delete(&datamodel.TOTPFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(factor).Error
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating TOTP factor: %w", err))
+	}
+	return nil
+}
+
+// EnableTOTPFactor enables the pending factor of a user and replaces their
+// recovery codes. If there's no pending factor, errorsx.ErrNoDataUpdated is
+// returned.
+func (r *repository) EnableTOTPFactor(ctx context.Context, ownerUID uuid.UUID, recoveryCodes []*datamodel.RecoveryCode) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&datamodel.TOTPFactor{}).
+			Where("owner_uid = ? AND enable_time IS NULL", ownerUID).
+			Update("enable_time", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorsx.ErrNoDataUpdated
+		}
+
+		if err := tx.Where("owner_uid = ?", ownerUID).Delete(&datamodel.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(recoveryCodes).Error
+	})
+	if errors.Is(err, errorsx.ErrNoDataUpdated) {
+		return err
+	}
+	if err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("enabling TOTP factor: %w", err))
+	}
+	return nil
+}
+
+// DeleteTOTPFactor deletes the factor of a user along with their recovery
+// codes.
+func (r *repository) DeleteTOTPFactor(ctx context.Context, ownerUID uuid.UUID) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_uid = ?", ownerUID).Delete(&datamodel.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("owner_uid = ?", ownerUID).Delete(&datamodel.TOTPFactor{}).Error
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("deleting TOTP factor: %w", err))
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code as used. If the code doesn't exist or
+// was already used, errorsx.ErrNoDataUpdated is returned.
+func (r *repository) UseRecoveryCode(ctx context.Context, ownerUID uuid.UUID, codeHash string) error {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	result := db.Model(&datamodel.RecoveryCode{}).
+		Where("owner_uid = ? AND code_hash = ? AND use_time IS NULL", ownerUID, codeHash).
+		Update("use_time", time.Now())
+	if result.Error != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("using recovery code: %w", result.Error))
+	}
 	if result.RowsAffected == 0 {
 		return errorsx.ErrNoDataUpdated
 	}
+	return nil
+}
+
+// CreatePasswordResetToken creates a password reset token. The expired and
+// used tokens of the user are deleted.
+func (r *repository) CreatePasswordResetToken(ctx context.Context, token *datamodel.PasswordResetToken) error {
 
+	db := r.db.WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_uid = ? AND (use_time IS NOT NULL OR expire_time < ?)", token.OwnerUID, time.Now()).
+			Delete(&datamodel.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating password reset token: %w", err))
+	}
 	return nil
 }
 
+// GetPasswordResetToken reads a password reset token from the primary
+// database, as it's used right after being sent.
+func (r *repository) GetPasswordResetToken(ctx context.Context, tokenHash string) (*datamodel.PasswordResetToken, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var token datamodel.PasswordResetToken
+	if err := db.First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting password reset token: %w", err))
+	}
+	return &token, nil
+}
+
+// ResetUserPasswordHash claims an unused and unexpired password reset token
+// and replaces the password hash of its owner in the same transaction, so a
+// token can only be used once. The other reset tokens of the user are marked
+// as used too. It returns errorsx.ErrNoDataUpdated if the token can't be
+// claimed.
+func (r *repository) ResetUserPasswordHash(ctx context.Context, tokenHash string, ownerUID uuid.UUID, newPassword string, updateTime time.Time, historySize int) error {
+
+	r.PinUser(ctx)
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		claim := tx.Model(&datamodel.PasswordResetToken{}).
+			Where("token_hash = ? AND owner_uid = ? AND use_time IS NULL AND expire_time > now()", tokenHash, ownerUID).
+			Update("use_time", gorm.Expr("now()"))
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return errorsx.ErrNoDataUpdated
+		}
+
+		if err := changePasswordHash(tx, ownerUID, newPassword, updateTime, historySize); err != nil {
+			return err
+		}
+
+		return tx.Model(&datamodel.PasswordResetToken{}).
+			Where("owner_uid = ? AND use_time IS NULL", ownerUID).
+			Update("use_time", gorm.Expr("now()")).Error
+	}); err != nil {
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return err
+		}
+		return errorsx.RepositoryErr(fmt.Errorf("resetting password hash: %w", err))
+	}
+
+	return nil
+}
+
+// CreateEmailVerificationToken creates an email verification token. It
+// replaces the other tokens of the user, so only the last address they asked
+// for can be verified.
+func (r *repository) CreateEmailVerificationToken(ctx context.Context, token *datamodel.EmailVerificationToken) error {
+
+	db := r.db.WithContext(ctx)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_uid = ?", token.OwnerUID).
+			Delete(&datamodel.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	}); err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating email verification token: %w", err))
+	}
+	return nil
+}
+
+// GetEmailVerificationToken reads an email verification token from the
+// primary database, as it's used right after being sent.
+func (r *repository) GetEmailVerificationToken(ctx context.Context, tokenHash string) (*datamodel.EmailVerificationToken, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var token datamodel.EmailVerificationToken
+	if err := db.First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting email verification token: %w", err))
+	}
+	return &token, nil
+}
+
+// GetPendingEmailVerificationToken returns the unused and unexpired email
+// verification token of a user.
+func (r *repository) GetPendingEmailVerificationToken(ctx context.Context, ownerUID uuid.UUID) (*datamodel.EmailVerificationToken, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var token datamodel.EmailVerificationToken
+	if err := db.Where("owner_uid = ? AND use_time IS NULL AND expire_time > ?", ownerUID, time.Now()).
+		Order("create_time DESC").
+		First(&token).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting pending email verification token: %w", err))
+	}
+	return &token, nil
+}
+
+// VerifyUserEmail uses an email verification token and sets its address as
+// the verified email of the user. The password reset tokens sent to the
+// previous address are used too. If the token was already used,
+// errorsx.ErrNoDataUpdated is returned.
+func (r *repository) VerifyUserEmail(ctx context.Context, token *datamodel.EmailVerificationToken) error {
+
+	r.PinUser(ctx)
+	db := r.db.WithContext(ctx)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&datamodel.EmailVerificationToken{}).
+			Where("uid = ? AND use_time IS NULL", token.UID).
+			Update("use_time", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorsx.ErrNoDataUpdated
+		}
+
+		if err := tx.Model(&datamodel.Owner{}).
+			Where("uid = ? AND owner_type = ?", token.OwnerUID, "user").
+			Updates(map[string]any{"email": token.Email, "email_verified": true}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&datamodel.PasswordResetToken{}).
+			Where("owner_uid = ? AND use_time IS NULL", token.OwnerUID).
+			Update("use_time", now).Error
+	})
+	if errors.Is(err, errorsx.ErrNoDataUpdated) {
+		return err
+	}
+	if err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("verifying email: %w", err))
+	}
+	return nil
+}
+
+// CreateOwnerIdentity links a user to an external identity.
+func (r *repository) CreateOwnerIdentity(ctx context.Context, identity *datamodel.OwnerIdentity) error {
+
+	r.PinUser(ctx)
+	db := r.db.WithContext(ctx)
+
+	if err := db.Create(identity).Error; err != nil {
+		return errorsx.RepositoryErr(fmt.Errorf("creating owner identity: %w", err))
+	}
+	return nil
+}
+
+// GetOwnerIdentity returns the external identity with the given subject at an
+// identity provider. It's read from the primary database, so a user signing in
+// again right after their first login isn't provisioned twice.
+func (r *repository) GetOwnerIdentity(ctx context.Context, issuer, subject string) (*datamodel.OwnerIdentity, error) {
+
+	db := r.db.Clauses(dbresolver.Write).WithContext(ctx)
+
+	var identity datamodel.OwnerIdentity
+	if err := db.First(&identity, "issuer = ? AND subject = ?", issuer, subject).Error; err != nil {
+		return nil, errorsx.RepositoryErr(fmt.Errorf("getting owner identity: %w", err))
+	}
+	return &identity, nil
+}
+
 // TranspileFilter transpiles a parsed AIP filter expression to GORM DB clauses
 func (r *repository) transpileFilter(filter filtering.Filter, tableName string) (*clause.Expr, error) {
 	return (&Transpiler{
@@ -3,14 +3,22 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	qt "github.com/frankban/quicktest"
 	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+
+	errorsx "github.com/instill-ai/x/errors"
 )
 
 func mockDBRepository() (sqlmock.Sqlmock, *sql.DB, Repository, error) {
@@ -33,21 +41,320 @@ func mockDBRepository() (sqlmock.Sqlmock, *sql.DB, Repository, error) {
 	return mock, sqldb, repository, err
 }
 
-func TestRepository_UpdateTokenLastUseTime(t *testing.T) {
+func TestRepository_FlushTokenLastUses(t *testing.T) {
+	c := qt.New(t)
+	usedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	sqldb, mock, err := sqlmock.New()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+	gormdb, err := gorm.Open(postgres.New(postgres.Config{Conn: sqldb}))
+	c.Assert(err, qt.IsNil)
+	redisClient, redisMock := redismock.NewClientMock()
+	repository := NewRepository(gormdb, redisClient)
+
+	// The buffer is swapped before the uses are written.
+	redisMock.ExpectExists(tokenLastUseFlushingKey).SetVal(0)
+	redisMock.ExpectExists(tokenLastUseKey).SetVal(1)
+	redisMock.ExpectRename(tokenLastUseKey, tokenLastUseFlushingKey).SetVal("OK")
+	redisMock.ExpectHGetAll(tokenLastUseFlushingKey).SetVal(map[string]string{
+		"hashA": `{"time":"2026-01-02T03:04:05Z","ip":"10.0.0.1","userAgent":"curl/8.0"}`,
+		"hashB": `{"time":"2026-01-02T03:04:05Z"}`,
+	})
+
+	// The batch is written in a single statement.
+	mock.ExpectExec(`UPDATE tokens SET .* FROM \(\s*SELECT DISTINCT ON \(t.uid\) .* JOIN \(VALUES \(\$1, \$2::timestamptz, \$3, \$4\), \(\$5, \$6::timestamptz, \$7, \$8\)\) AS v`).
+		WithArgs("hashA", usedAt, "10.0.0.1", "curl/8.0", "hashB", usedAt, "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	redisMock.ExpectDel(tokenLastUseFlushingKey).SetVal(1)
+
+	updated, err := repository.FlushTokenLastUses(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Check(updated, qt.Equals, int64(1))
+	c.Check(mock.ExpectationsWereMet(), qt.IsNil)
+	c.Check(redisMock.ExpectationsWereMet(), qt.IsNil)
+
+	// Nothing is written when no use is buffered.
+	redisMock.ExpectExists(tokenLastUseFlushingKey).SetVal(0)
+	redisMock.ExpectExists(tokenLastUseKey).SetVal(0)
+	updated, err = repository.FlushTokenLastUses(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Check(updated, qt.Equals, int64(0))
+	c.Check(redisMock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_GetBufferedTokenLastUses(t *testing.T) {
+	c := qt.New(t)
+	earlier := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	repository := NewRepository(nil, redisClient)
+
+	// Both buffers are read, the latest use of a hash wins.
+	redisMock.ExpectHMGet(tokenLastUseKey, "hashA", "hashB", "hashC").SetVal([]any{
+		`{"time":"2026-01-02T03:05:05Z","ip":"10.0.0.1"}`, nil, nil,
+	})
+	redisMock.ExpectHMGet(tokenLastUseFlushingKey, "hashA", "hashB", "hashC").SetVal([]any{
+		`{"time":"2026-01-02T03:04:05Z"}`, `{"time":"2026-01-02T03:04:05Z"}`, nil,
+	})
+
+	uses, err := repository.GetBufferedTokenLastUses(context.Background(), "hashA", "hashB", "hashC")
+	c.Assert(err, qt.IsNil)
+	c.Check(uses, qt.DeepEquals, map[string]*datamodel.TokenLastUse{
+		"hashA": {Time: later, IP: "10.0.0.1"},
+		"hashB": {Time: earlier},
+	})
+	c.Check(redisMock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_ExpireTokens(t *testing.T) {
 	c := qt.New(t)
-	tokenAccess := "fakeTokenAccess"
 
 	mock, sqldb, repository, err := mockDBRepository()
 	c.Assert(err, qt.IsNil)
 	defer sqldb.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tokens" SET "last_use_time"=$1,"update_time"=$2 WHERE access_token = $3`)).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), tokenAccess).
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tokens" SET "state"=$1,"update_time"=$2 WHERE state = $3 AND expire_time <= $4`)).
+		WithArgs("STATE_EXPIRED", sqlmock.AnyArg(), "STATE_ACTIVE", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	expired, err := repository.ExpireTokens(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Check(expired, qt.Equals, int64(2))
+	c.Check(mock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_RotateRefreshToken(t *testing.T) {
+	c := qt.New(t)
+	usedUID := uuid.Must(uuid.NewV4())
+	next := &datamodel.RefreshToken{
+		Base:       datamodel.Base{UID: uuid.Must(uuid.NewV4())},
+		FamilyUID:  uuid.Must(uuid.NewV4()),
+		TokenHash:  "fakeTokenHash",
+		ExpireTime: time.Now().Add(time.Hour),
+	}
+
+	c.Run("ok", func(c *qt.C) {
+		mock, sqldb, repository, err := mockDBRepository()
+		c.Assert(err, qt.IsNil)
+		defer sqldb.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "use_time"=$1,"update_time"=$2 WHERE uid = $3 AND use_time IS NULL`)).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), usedUID).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "refresh_tokens"`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err = repository.RotateRefreshToken(context.Background(), usedUID, next)
+		c.Assert(err, qt.IsNil)
+		c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+	})
+
+	c.Run("nok - already used", func(c *qt.C) {
+		mock, sqldb, repository, err := mockDBRepository()
+		c.Assert(err, qt.IsNil)
+		defer sqldb.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "use_time"=$1,"update_time"=$2 WHERE uid = $3 AND use_time IS NULL`)).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), usedUID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = repository.RotateRefreshToken(context.Background(), usedUID, next)
+		c.Check(errors.Is(err, errorsx.ErrNoDataUpdated), qt.IsTrue)
+		c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+	})
+}
+
+func TestRepository_ListOwnersByOffset(t *testing.T) {
+	c := qt.New(t)
+	uid := uuid.Must(uuid.NewV4())
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+
+	where := clause.Expr{SQL: "(lower(coalesce(id, '')) = ?)", Vars: []any{"jane"}}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "owners" WHERE owner_type = $1 AND uid IN (SELECT "owner_uid" FROM "owner_identities" WHERE issuer = $2) AND (lower(coalesce(id, '')) = $3)`)).
+		WithArgs("user", "scim", "jane").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE owner_type = $1 AND uid IN (SELECT "owner_uid" FROM "owner_identities" WHERE issuer = $2) AND (lower(coalesce(id, '')) = $3) ORDER BY create_time ASC, uid ASC LIMIT $4 OFFSET $5`)).
+		WithArgs("user", "scim", "jane", 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"uid", "id"}).AddRow(uid, "jane"))
+
+	owners, totalSize, err := repository.ListOwnersByOffset(context.Background(), "user", "scim", 2, 1, where)
+	c.Assert(err, qt.IsNil)
+	c.Check(totalSize, qt.Equals, int64(3))
+	c.Assert(owners, qt.HasLen, 1)
+	c.Check(owners[0].UID, qt.Equals, uid)
+
+	// The owners past the end aren't queried.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "owners" WHERE owner_type = $1 AND uid IN (SELECT "owner_uid" FROM "owner_identities" WHERE issuer = $2)`)).
+		WithArgs("organization", "scim").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	owners, totalSize, err = repository.ListOwnersByOffset(context.Background(), "organization", "scim", 1, 10, clause.Expr{})
+	c.Assert(err, qt.IsNil)
+	c.Check(totalSize, qt.Equals, int64(1))
+	c.Check(owners, qt.HasLen, 0)
+	c.Check(mock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_ChangeUserPasswordHash(t *testing.T) {
+	c := qt.New(t)
+	uid := uuid.Must(uuid.NewV4())
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "owner" WHERE uid = $1 ORDER BY "owner"."uid" LIMIT $2 FOR UPDATE`)).
+		WithArgs(uid.String(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"uid", "password_hash"}).AddRow(uid, "oldHash"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "password_histories"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uid, "oldHash").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "password_histories" WHERE owner_uid = $1 AND uid NOT IN (SELECT "uid" FROM "password_histories" WHERE owner_uid = $2 ORDER BY create_time DESC LIMIT $3)`)).
+		WithArgs(uid, uid, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "owner" SET`)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = repository.ChangeUserPasswordHash(context.Background(), uid, "newHash", time.Now(), 4)
+	c.Assert(err, qt.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_ResetUserPasswordHash(t *testing.T) {
+	c := qt.New(t)
+	uid := uuid.Must(uuid.NewV4())
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+
+	claim := regexp.QuoteMeta(`UPDATE "password_reset_tokens" SET "use_time"=now(),"update_time"=$1 WHERE token_hash = $2 AND owner_uid = $3 AND use_time IS NULL AND expire_time > now()`)
+
+	c.Run("ok", func(c *qt.C) {
+		mock.ExpectBegin()
+		mock.ExpectExec(claim).
+			WithArgs(sqlmock.AnyArg(), "tokenHash", uid).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "owner" WHERE uid = $1 ORDER BY "owner"."uid" LIMIT $2 FOR UPDATE`)).
+			WithArgs(uid.String(), 1).
+			WillReturnRows(sqlmock.NewRows([]string{"uid", "password_hash"}).AddRow(uid, "oldHash"))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "password_histories"`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "owner" SET`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "password_reset_tokens" SET "use_time"=now(),"update_time"=$1 WHERE owner_uid = $2 AND use_time IS NULL`)).
+			WithArgs(sqlmock.AnyArg(), uid).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err := repository.ResetUserPasswordHash(context.Background(), "tokenHash", uid, "newHash", time.Now(), 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+	})
+
+	// A token used or expired in the meantime leaves the password unchanged.
+	c.Run("nok - token already used", func(c *qt.C) {
+		mock.ExpectBegin()
+		mock.ExpectExec(claim).
+			WithArgs(sqlmock.AnyArg(), "tokenHash", uid).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repository.ResetUserPasswordHash(context.Background(), "tokenHash", uid, "newHash", time.Now(), 0)
+		c.Assert(errors.Is(err, errorsx.ErrNoDataUpdated), qt.IsTrue)
+		c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+	})
+}
+
+func TestRepository_UpdateUser(t *testing.T) {
+	c := qt.New(t)
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
 
+	// A changed email loses its verification.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "owners" SET "email_verified"=$1,"update_time"=$2 WHERE owner_type = $3 AND id = $4 AND email IS DISTINCT FROM $5`)).
+		WithArgs(false, sqlmock.AnyArg(), "user", "jane", "jane@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "owners" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repository.UpdateUser(context.Background(), "jane", &datamodel.Owner{ID: "jane", Email: "jane@example.com"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_VerifyUserEmail(t *testing.T) {
+	c := qt.New(t)
+	token := &datamodel.EmailVerificationToken{
+		Base:     datamodel.Base{UID: uuid.Must(uuid.NewV4())},
+		OwnerUID: uuid.Must(uuid.NewV4()),
+		Email:    "jane@example.com",
+	}
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "email_verification_tokens" SET "use_time"=$1,"update_time"=$2 WHERE uid = $3 AND use_time IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), token.UID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "owners" SET "email"=$1,"email_verified"=$2,"update_time"=$3 WHERE uid = $4 AND owner_type = $5`)).
+		WithArgs("jane@example.com", true, sqlmock.AnyArg(), token.OwnerUID, "user").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "password_reset_tokens" SET "use_time"=$1,"update_time"=$2 WHERE owner_uid = $3 AND use_time IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), token.OwnerUID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
-	err = repository.UpdateTokenLastUseTime(context.Background(), tokenAccess)
+	err = repository.VerifyUserEmail(context.Background(), token)
+	c.Assert(err, qt.IsNil)
+
+	// A token can't be used twice.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "email_verification_tokens" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repository.VerifyUserEmail(context.Background(), token)
+	c.Assert(err, qt.ErrorIs, errorsx.ErrNoDataUpdated)
+	c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
+}
+
+func TestRepository_GetUserByEmail(t *testing.T) {
+	c := qt.New(t)
+
+	mock, sqldb, repository, err := mockDBRepository()
+	c.Assert(err, qt.IsNil)
+	defer sqldb.Close()
+
+	// The emails are compared case-insensitively, with the expression of the
+	// unique index.
+	mock.ExpectQuery(`SELECT .* FROM "owners" WHERE lower\(email\) = \$1 AND owner_type = \$2`).
+		WithArgs("alice@example.com", "user", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow("alice", "alice@example.com"))
+
+	user, err := repository.GetUserByEmail(context.Background(), " Alice@Example.com ")
 	c.Assert(err, qt.IsNil)
+	c.Check(user.ID, qt.Equals, "alice")
+	c.Assert(mock.ExpectationsWereMet(), qt.IsNil)
 }
@@ -192,8 +192,14 @@ func (t *Transpiler) transpileComparisonCallExpr(e *expr.Expr, op any) (*clause.
 			vars = append(vars, con.Vars...)
 		}
 	case clause.Neq:
-		sql = fmt.Sprintf("%s <> ?", ident.SQL)
-		vars = append(vars, con.Vars...)
+		switch ident.SQL {
+		case "email":
+			sql = "LOWER(email) <> LOWER(?)"
+			vars = append(vars, con.Vars[0])
+		default:
+			sql = fmt.Sprintf("%s <> ?", ident.SQL)
+			vars = append(vars, con.Vars...)
+		}
 	case clause.Lt:
 		sql = fmt.Sprintf("%s < ?", ident.SQL)
 		vars = append(vars, con.Vars...)
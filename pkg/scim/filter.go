@@ -0,0 +1,362 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Attributes are the values of the attributes of a resource, by their
+// lowercase path, e.g. emails.value.
+type Attributes map[string][]string
+
+// Filter is a parsed filter of a query (RFC 7644, section 3.4.2.2). The
+// attributes are compared case-insensitively, which is how all the
+// attributes of the resources served here are defined.
+type Filter interface {
+	// Match tells whether a resource with the given attributes matches the
+	// filter.
+	Match(attrs Attributes) bool
+	// SQL translates the filter into an SQL condition and its arguments.
+	// The attributes are read from the given SQL expressions, by their
+	// lowercase path, and a null value is an empty string. The filters on
+	// other attributes are refused.
+	SQL(columns map[string]string) (string, []any, error)
+}
+
+// ParseFilter parses a filter. The complex attribute filters, e.g.
+// emails[type eq "work"], aren't supported.
+func ParseFilter(filter string) (Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type logicalFilter struct {
+	and         bool
+	left, right Filter
+}
+
+func (f *logicalFilter) Match(attrs Attributes) bool {
+	if f.and {
+		return f.left.Match(attrs) && f.right.Match(attrs)
+	}
+	return f.left.Match(attrs) || f.right.Match(attrs)
+}
+
+func (f *logicalFilter) SQL(columns map[string]string) (string, []any, error) {
+	left, leftArgs, err := f.left.SQL(columns)
+	if err != nil {
+		return "", nil, err
+	}
+	right, rightArgs, err := f.right.SQL(columns)
+	if err != nil {
+		return "", nil, err
+	}
+	op := "OR"
+	if f.and {
+		op = "AND"
+	}
+	return fmt.Sprintf("(%s %s %s)", left, op, right), append(leftArgs, rightArgs...), nil
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (f *notFilter) Match(attrs Attributes) bool {
+	return !f.filter.Match(attrs)
+}
+
+func (f *notFilter) SQL(columns map[string]string) (string, []any, error) {
+	condition, args, err := f.filter.SQL(columns)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("NOT %s", condition), args, nil
+}
+
+type attrFilter struct {
+	path string
+	op   string
+	// value is nil for the pr operator and the null value.
+	value *string
+}
+
+func (f *attrFilter) Match(attrs Attributes) bool {
+	values := attrs[f.path]
+
+	switch {
+	case f.op == "pr":
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	case f.value == nil:
+		// Only the presence can be compared with null.
+		present := (&attrFilter{path: f.path, op: "pr"}).Match(attrs)
+		return (f.op == "eq" && !present) || (f.op == "ne" && present)
+	case f.op == "ne":
+		return !(&attrFilter{path: f.path, op: "eq", value: f.value}).Match(attrs)
+	}
+
+	want := strings.ToLower(*f.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+		var ok bool
+		switch f.op {
+		case "eq":
+			ok = v == want
+		case "co":
+			ok = strings.Contains(v, want)
+		case "sw":
+			ok = strings.HasPrefix(v, want)
+		case "ew":
+			ok = strings.HasSuffix(v, want)
+		case "gt":
+			ok = v > want
+		case "ge":
+			ok = v >= want
+		case "lt":
+			ok = v < want
+		case "le":
+			ok = v <= want
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlOperators are the SQL operators of the comparison operators.
+var sqlOperators = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (f *attrFilter) SQL(columns map[string]string) (string, []any, error) {
+	column, ok := columns[f.path]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s can't be filtered on", ErrInvalidFilter, f.path)
+	}
+	column = fmt.Sprintf("lower(coalesce(%s, ''))", column)
+
+	switch {
+	case f.op == "pr":
+		return fmt.Sprintf("(%s <> '')", column), nil, nil
+	case f.value == nil && f.op == "eq":
+		return fmt.Sprintf("(%s = '')", column), nil, nil
+	case f.value == nil:
+		return fmt.Sprintf("(%s <> '')", column), nil, nil
+	}
+
+	value := strings.ToLower(*f.value)
+	switch f.op {
+	case "co":
+		return fmt.Sprintf("(%s LIKE ?)", column), []any{"%" + likeEscaper.Replace(value) + "%"}, nil
+	case "sw":
+		return fmt.Sprintf("(%s LIKE ?)", column), []any{likeEscaper.Replace(value) + "%"}, nil
+	case "ew":
+		return fmt.Sprintf("(%s LIKE ?)", column), []any{"%" + likeEscaper.Replace(value)}, nil
+	}
+	return fmt.Sprintf("(%s %s ?)", column, sqlOperators[f.op]), []any{value}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(filter string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, text: ")"})
+			i++
+		case c == '[' || c == ']':
+			return nil, fmt.Errorf("%w: complex attribute filters aren't supported", ErrInvalidFilter)
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			var s string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, filter[i:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s})
+			i = end + 1
+		default:
+			n := strings.IndexAny(filter[i:], " \t\r\n()[]\"")
+			if n < 0 {
+				n = len(filter) - i
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: filter[i : i+n]})
+			i += n
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser of the filters, "not" binds tighter
+// than "and", which binds tighter than "or".
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenWord && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *parser) next() (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, fmt.Errorf("%w: unexpected end of filter", ErrInvalidFilter)
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *parser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Filter, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOpenParen {
+			return nil, fmt.Errorf("%w: not must be followed by a parenthesized filter", ErrInvalidFilter)
+		}
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notFilter{filter: f}, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokenOpenParen:
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t.kind != tokenCloseParen {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidFilter)
+		}
+		return f, nil
+	case tokenWord:
+		return p.parseAttr(t.text)
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, t.text)
+}
+
+func (p *parser) parseAttr(path string) (Filter, error) {
+	f := &attrFilter{path: strings.ToLower(path)}
+	for _, schema := range []string{UserSchema, GroupSchema} {
+		f.path = strings.TrimPrefix(f.path, strings.ToLower(schema)+":")
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	f.op = strings.ToLower(op.text)
+	switch f.op {
+	case "pr":
+		return f, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, op.text)
+	}
+
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case value.kind == tokenString:
+		f.value = &value.text
+	case value.kind != tokenWord:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, value.text)
+	case value.text == "null":
+		if f.op != "eq" && f.op != "ne" {
+			return nil, fmt.Errorf("%w: null can only be compared for equality", ErrInvalidFilter)
+		}
+	case value.text == "true" || value.text == "false":
+		f.value = &value.text
+	default:
+		if _, err := strconv.ParseFloat(value.text, 64); err != nil {
+			return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidFilter, value.text)
+		}
+		f.value = &value.text
+	}
+	return f, nil
+}
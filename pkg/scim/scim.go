@@ -0,0 +1,495 @@
+// Package scim implements the resources and the messages of the SCIM 2.0
+// protocol (RFC 7643 and RFC 7644) the identity providers provision the users
+// and the organizations through.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Issuer is the issuer of the owner identities recording the users and the
+// organizations provisioned through SCIM.
+const Issuer = "scim"
+
+// Schemas of the resources and the messages.
+const (
+	UserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// The errors are named after the SCIM error types they're reported with.
+var (
+	ErrInvalidFilter = errors.New("invalidFilter")
+	ErrInvalidPath   = errors.New("invalidPath")
+	ErrInvalidSyntax = errors.New("invalidSyntax")
+	ErrInvalidValue  = errors.New("invalidValue")
+	ErrMutability    = errors.New("mutability")
+	ErrNoTarget      = errors.New("noTarget")
+	ErrUniqueness    = errors.New("uniqueness")
+)
+
+// Meta holds the metadata of a resource.
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// Name is the name of a user.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+}
+
+// Email is an email of a user.
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// User is a user resource.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	// Active is true when it isn't set.
+	Active *bool `json:"active,omitempty"`
+	Meta   *Meta `json:"meta,omitempty"`
+}
+
+// PrimaryEmail returns the primary email of the user, or their first one.
+func (u *User) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// FormattedName returns the name the user is displayed with.
+func (u *User) FormattedName() string {
+	switch {
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Name == nil:
+		return ""
+	case u.Name.Formatted != "":
+		return u.Name.Formatted
+	default:
+		return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+	}
+}
+
+// IsActive tells whether the user is active.
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// Attributes returns the attributes of the user filters are evaluated on.
+func (u *User) Attributes() Attributes {
+	attrs := Attributes{
+		"id":          {u.ID},
+		"externalid":  {u.ExternalID},
+		"username":    {u.UserName},
+		"displayname": {u.DisplayName},
+		"active":      {strconv.FormatBool(u.IsActive())},
+	}
+	if u.Name != nil {
+		attrs["name.formatted"] = []string{u.Name.Formatted}
+		attrs["name.givenname"] = []string{u.Name.GivenName}
+		attrs["name.familyname"] = []string{u.Name.FamilyName}
+	}
+	for _, email := range u.Emails {
+		attrs["emails"] = append(attrs["emails"], email.Value)
+		attrs["emails.value"] = append(attrs["emails.value"], email.Value)
+		attrs["emails.type"] = append(attrs["emails.type"], email.Type)
+	}
+	return attrs
+}
+
+// Patch applies the operations of a PATCH request to the user. The
+// attributes that aren't stored are ignored.
+func (u *User) Patch(ops []PatchOperation) error {
+	return patch(ops, u.set)
+}
+
+func (u *User) set(op, path string, value json.RawMessage) error {
+	attr, filter, subAttr, err := parseValuePath(path)
+	if err != nil {
+		return err
+	}
+
+	switch attr {
+	case "username":
+		return decodeString(value, &u.UserName)
+	case "externalid":
+		return decodeString(value, &u.ExternalID)
+	case "displayname":
+		return decodeString(value, &u.DisplayName)
+	case "name":
+		u.Name = nil
+		return decode(value, &u.Name)
+	case "name.formatted", "name.givenname", "name.familyname":
+		if u.Name == nil {
+			u.Name = &Name{}
+		}
+		switch attr {
+		case "name.formatted":
+			return decodeString(value, &u.Name.Formatted)
+		case "name.givenname":
+			return decodeString(value, &u.Name.GivenName)
+		default:
+			return decodeString(value, &u.Name.FamilyName)
+		}
+	case "active":
+		if isNull(value) {
+			u.Active = nil
+			return nil
+		}
+		// Some providers send the booleans as strings.
+		var active bool
+		if err := json.Unmarshal(value, &active); err != nil {
+			var s string
+			if err := decode(value, &s); err != nil {
+				return err
+			}
+			if active, err = strconv.ParseBool(s); err != nil {
+				return fmt.Errorf("%w: active must be a boolean", ErrInvalidValue)
+			}
+		}
+		u.Active = &active
+		return nil
+	case "emails":
+		return u.setEmails(op, filter, subAttr, value)
+	}
+	return nil
+}
+
+func (u *User) setEmails(op string, filter Filter, subAttr string, value json.RawMessage) error {
+	if filter == nil {
+		if op == "remove" {
+			u.Emails = nil
+			return nil
+		}
+		var emails []Email
+		if err := decode(value, &emails); err != nil {
+			return err
+		}
+		if op == "add" {
+			u.Emails = append(u.Emails, emails...)
+		} else {
+			u.Emails = emails
+		}
+		return nil
+	}
+
+	// emails[type eq "work"].value
+	if op == "remove" {
+		emails := u.Emails[:0]
+		for _, email := range u.Emails {
+			if !filter.Match(email.attributes()) {
+				emails = append(emails, email)
+			}
+		}
+		u.Emails = emails
+		return nil
+	}
+	if subAttr != "value" {
+		return fmt.Errorf("%w: only the value of the emails can be set", ErrInvalidPath)
+	}
+	var v string
+	if err := decodeString(value, &v); err != nil {
+		return err
+	}
+	matched := false
+	for i := range u.Emails {
+		if filter.Match(u.Emails[i].attributes()) {
+			u.Emails[i].Value = v
+			matched = true
+		}
+	}
+	if !matched {
+		u.Emails = append(u.Emails, Email{Value: v, Primary: len(u.Emails) == 0})
+	}
+	return nil
+}
+
+func (e Email) attributes() Attributes {
+	return Attributes{
+		"value":   {e.Value},
+		"type":    {e.Type},
+		"primary": {strconv.FormatBool(e.Primary)},
+	}
+}
+
+// Member is a member of a group.
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Group is a group resource.
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Attributes returns the attributes of the group filters are evaluated on.
+func (g *Group) Attributes() Attributes {
+	attrs := Attributes{
+		"id":          {g.ID},
+		"externalid":  {g.ExternalID},
+		"displayname": {g.DisplayName},
+	}
+	for _, member := range g.Members {
+		attrs["members"] = append(attrs["members"], member.Value)
+		attrs["members.value"] = append(attrs["members.value"], member.Value)
+	}
+	return attrs
+}
+
+// Patch applies the operations of a PATCH request to the group. The
+// attributes that aren't stored are ignored.
+func (g *Group) Patch(ops []PatchOperation) error {
+	return patch(ops, g.set)
+}
+
+func (g *Group) set(op, path string, value json.RawMessage) error {
+	attr, filter, _, err := parseValuePath(path)
+	if err != nil {
+		return err
+	}
+
+	switch attr {
+	case "displayname":
+		return decodeString(value, &g.DisplayName)
+	case "externalid":
+		return decodeString(value, &g.ExternalID)
+	case "members":
+	default:
+		return nil
+	}
+
+	// members[value eq "2819c223-7f76-453a-919d-413861904646"]
+	if filter != nil {
+		if op != "remove" {
+			return fmt.Errorf("%w: members can only be removed by filter", ErrInvalidPath)
+		}
+		g.removeMembers(func(m Member) bool { return filter.Match(m.attributes()) })
+		return nil
+	}
+
+	var members []Member
+	if err := decode(value, &members); err != nil {
+		return err
+	}
+	switch op {
+	case "add":
+		for _, member := range members {
+			if !g.hasMember(member.Value) {
+				g.Members = append(g.Members, member)
+			}
+		}
+	case "replace":
+		g.Members = members
+	case "remove":
+		// All the members are removed when none is given.
+		if members == nil {
+			g.Members = nil
+			return nil
+		}
+		g.removeMembers(func(m Member) bool {
+			for _, member := range members {
+				if strings.EqualFold(m.Value, member.Value) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	return nil
+}
+
+func (g *Group) hasMember(value string) bool {
+	for _, member := range g.Members {
+		if strings.EqualFold(member.Value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) removeMembers(remove func(Member) bool) {
+	members := []Member{}
+	for _, member := range g.Members {
+		if !remove(member) {
+			members = append(members, member)
+		}
+	}
+	g.Members = members
+}
+
+func (m Member) attributes() Attributes {
+	return Attributes{
+		"value":   {m.Value},
+		"display": {m.Display},
+	}
+}
+
+// ListResponse is the response of a query.
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+// NewListResponse returns the response with a page of the resources, which
+// starts at the 1-based start index.
+func NewListResponse[T any](page []T, totalResults, startIndex int) *ListResponse[T] {
+	if page == nil {
+		page = []T{}
+	}
+
+	return &ListResponse[T]{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: totalResults,
+		StartIndex:   max(startIndex, 1),
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// PatchRequest is the body of a PATCH request.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is an operation of a PATCH request.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is the body of an error response.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// patch applies the operations through the setter of a resource. The
+// operations without a path set each attribute of their value.
+func patch(ops []PatchOperation, set func(op, path string, value json.RawMessage) error) error {
+	for _, o := range ops {
+		op := strings.ToLower(o.Op)
+		switch op {
+		case "add", "replace":
+			if o.Path != "" {
+				if err := set(op, o.Path, o.Value); err != nil {
+					return err
+				}
+				continue
+			}
+			var attrs map[string]json.RawMessage
+			if err := decode(o.Value, &attrs); err != nil {
+				return err
+			}
+			for path, value := range attrs {
+				if err := set(op, path, value); err != nil {
+					return err
+				}
+			}
+		case "remove":
+			if o.Path == "" {
+				return fmt.Errorf("%w: the path of a remove operation is required", ErrNoTarget)
+			}
+			value := o.Value
+			if len(value) == 0 {
+				value = json.RawMessage("null")
+			}
+			if err := set(op, o.Path, value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown operation %q", ErrInvalidSyntax, o.Op)
+		}
+	}
+	return nil
+}
+
+// parseValuePath splits a path like emails[type eq "work"].value into the
+// lowercase attribute, the filter and the sub-attribute. The URN of the core
+// schemas is removed.
+func parseValuePath(path string) (attr string, filter Filter, subAttr string, err error) {
+	for _, schema := range []string{UserSchema, GroupSchema} {
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+			path = path[len(schema)+1:]
+		}
+	}
+
+	open := strings.Index(path, "[")
+	if open < 0 {
+		return strings.ToLower(path), nil, "", nil
+	}
+	end := strings.LastIndex(path, "]")
+	if end < open {
+		return "", nil, "", fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+	if filter, err = ParseFilter(path[open+1 : end]); err != nil {
+		return "", nil, "", fmt.Errorf("%w: %w", ErrInvalidPath, err)
+	}
+	subAttr = strings.TrimPrefix(strings.ToLower(path[end+1:]), ".")
+	return strings.ToLower(path[:open]), filter, subAttr, nil
+}
+
+func decode(value json.RawMessage, v any) error {
+	if len(value) == 0 {
+		return fmt.Errorf("%w: the value is required", ErrInvalidValue)
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	return nil
+}
+
+// decodeString decodes a string, null clears it.
+func decodeString(value json.RawMessage, s *string) error {
+	if isNull(value) {
+		*s = ""
+		return nil
+	}
+	return decode(value, s)
+}
+
+func isNull(value json.RawMessage) bool {
+	return strings.TrimSpace(string(value)) == "null"
+}
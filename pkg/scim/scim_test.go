@@ -0,0 +1,169 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	jane := Attributes{
+		"username":    {"jane"},
+		"displayname": {"Jane Doe"},
+		"emails":      {"jane@example.com", "jane@home.example"},
+		"active":      {"true"},
+	}
+
+	for _, tc := range []struct {
+		filter string
+		match  bool
+	}{
+		{`userName eq "Jane"`, true},
+		{`userName eq "jan"`, false},
+		{`userName ne "john"`, true},
+		{`emails co "home"`, true},
+		{`emails sw "jane@e"`, true},
+		{`emails ew ".org"`, false},
+		{`displayName pr`, true},
+		{`externalId pr`, false},
+		{`externalId eq null`, true},
+		{`active eq true`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane"`, true},
+		{`userName eq "john" or emails co "example.com"`, true},
+		{`userName eq "jane" and not (emails co "example.com")`, false},
+		{`userName eq "john" or userName eq "jane" and active eq false`, false},
+		{`(userName eq "john" or userName eq "jane") and active eq true`, true},
+		{`displayName eq "Jane \"JD\" Doe"`, false},
+	} {
+		t.Run(tc.filter, func(t *testing.T) {
+			f, err := ParseFilter(tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.match, f.Match(jane))
+		})
+	}
+
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName is "jane"`,
+		`userName eq jane`,
+		`userName co null`,
+		`(userName eq "jane"`,
+		`not userName eq "jane"`,
+		`userName eq "jane" userName`,
+		`emails[type eq "work"]`,
+		`userName eq "jane`,
+	} {
+		_, err := ParseFilter(filter)
+		assert.True(t, errors.Is(err, ErrInvalidFilter), filter)
+	}
+}
+
+func TestFilterSQL(t *testing.T) {
+	columns := map[string]string{"username": "id", "emails": "email", "externalid": "''"}
+
+	for _, tc := range []struct {
+		filter string
+		sql    string
+		args   []any
+	}{
+		{`userName eq "Jane"`, `(lower(coalesce(id, '')) = ?)`, []any{"jane"}},
+		{`userName ne "jane"`, `(lower(coalesce(id, '')) <> ?)`, []any{"jane"}},
+		{`userName gt "j"`, `(lower(coalesce(id, '')) > ?)`, []any{"j"}},
+		{`emails co "50%_off"`, `(lower(coalesce(email, '')) LIKE ?)`, []any{`%50\%\_off%`}},
+		{`emails sw "jane@"`, `(lower(coalesce(email, '')) LIKE ?)`, []any{"jane@%"}},
+		{`emails ew ".org"`, `(lower(coalesce(email, '')) LIKE ?)`, []any{"%.org"}},
+		{`emails pr`, `(lower(coalesce(email, '')) <> '')`, nil},
+		{`externalId eq null`, `(lower(coalesce('', '')) = '')`, nil},
+		{
+			`userName eq "jane" or not (emails co "example")`,
+			`((lower(coalesce(id, '')) = ?) OR NOT (lower(coalesce(email, '')) LIKE ?))`,
+			[]any{"jane", "%example%"},
+		},
+		{
+			`userName eq "jane" and emails pr`,
+			`((lower(coalesce(id, '')) = ?) AND (lower(coalesce(email, '')) <> ''))`,
+			[]any{"jane"},
+		},
+	} {
+		f, err := ParseFilter(tc.filter)
+		require.NoError(t, err)
+		sql, args, err := f.SQL(columns)
+		require.NoError(t, err, tc.filter)
+		assert.Equal(t, tc.sql, sql, tc.filter)
+		assert.Equal(t, tc.args, args, tc.filter)
+	}
+
+	// The attributes that aren't stored can't be filtered on.
+	f, err := ParseFilter(`userName eq "jane" and displayName eq "Jane"`)
+	require.NoError(t, err)
+	_, _, err = f.SQL(columns)
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+}
+
+func TestUserPatch(t *testing.T) {
+	u := &User{
+		UserName: "jane",
+		Emails:   []Email{{Value: "jane@example.com", Type: "work", Primary: true}},
+	}
+
+	err := u.Patch([]PatchOperation{
+		{Op: "Replace", Path: "displayName", Value: json.RawMessage(`"Jane Doe"`)},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: json.RawMessage(`"jane@instill.test"`)},
+		{Op: "add", Value: json.RawMessage(`{"name.givenName": "Jane", "active": "False"}`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", u.FormattedName())
+	assert.Equal(t, "jane@instill.test", u.PrimaryEmail())
+	assert.Equal(t, "Jane", u.Name.GivenName)
+	assert.False(t, u.IsActive())
+
+	require.NoError(t, u.Patch([]PatchOperation{{Op: "remove", Path: "displayName"}}))
+	assert.Equal(t, "Jane", u.FormattedName())
+
+	err = u.Patch([]PatchOperation{{Op: "remove"}})
+	assert.True(t, errors.Is(err, ErrNoTarget))
+	err = u.Patch([]PatchOperation{{Op: "move", Path: "displayName"}})
+	assert.True(t, errors.Is(err, ErrInvalidSyntax))
+	err = u.Patch([]PatchOperation{{Op: "replace", Path: "displayName", Value: json.RawMessage(`1`)}})
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+}
+
+func TestGroupPatch(t *testing.T) {
+	g := &Group{DisplayName: "Engineering", Members: []Member{{Value: "a"}}}
+
+	err := g.Patch([]PatchOperation{
+		{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "a"}, {"value": "b"}, {"value": "c"}]`)},
+		{Op: "remove", Path: `members[value eq "b"]`},
+		{Op: "replace", Value: json.RawMessage(`{"displayName": "R&D"}`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "R&D", g.DisplayName)
+	assert.Equal(t, []Member{{Value: "a"}, {Value: "c"}}, g.Members)
+
+	require.NoError(t, g.Patch([]PatchOperation{{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value": "a"}]`)}}))
+	assert.Equal(t, []Member{{Value: "c"}}, g.Members)
+
+	require.NoError(t, g.Patch([]PatchOperation{{Op: "remove", Path: "members"}}))
+	assert.Empty(t, g.Members)
+
+	err = g.Patch([]PatchOperation{{Op: "add", Path: `members[value eq "b"]`}})
+	assert.True(t, errors.Is(err, ErrInvalidPath))
+}
+
+func TestNewListResponse(t *testing.T) {
+	resp := NewListResponse([]string{"b"}, 3, 2)
+	assert.Equal(t, 3, resp.TotalResults)
+	assert.Equal(t, 2, resp.StartIndex)
+	assert.Equal(t, 1, resp.ItemsPerPage)
+	assert.Equal(t, []string{"b"}, resp.Resources)
+
+	resp = NewListResponse[string](nil, 3, 0)
+	assert.Equal(t, 1, resp.StartIndex)
+	assert.Equal(t, []string{}, resp.Resources)
+	assert.Equal(t, 0, resp.ItemsPerPage)
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// secretLength is the number of random bytes in the secrets handed out to the
+// users, like the refresh, password reset and email verification tokens.
+const secretLength = 32
+
+// AccessTokenClaims holds the claims of the JWT access tokens issued on
+// login. The subject is the UID of the authenticated user and the ID (jti) is
+// used to revoke the token on logout. The session ID (sid) is the login
+// session the token belongs to, if any.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+}
+
+// newAccessTokenClaims builds the claims of a new access token for a user. The
+// session UID is nil for tokens issued outside of a login session.
+func newAccessTokenClaims(userUID, sessionUID uuid.UUID) (*AccessTokenClaims, error) {
+	jti, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	jwtConfig := config.Config.Server.JWT
+	now := time.Now()
+
+	claims := &AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtConfig.Issuer,
+			Subject:   userUID.String(),
+			Audience:  jwt.ClaimStrings{jwtConfig.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(jwtConfig.Expiration) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti.String(),
+		},
+	}
+	if sessionUID != uuid.Nil {
+		claims.SessionID = sessionUID.String()
+	}
+	return claims, nil
+}
+
+// signAccessToken signs the access token claims with the current signing key.
+// The key ID is set in the `kid` header so the token can be verified after the
+// key is rotated.
+func (s *service) signAccessToken(ctx context.Context, claims *AccessTokenClaims) (string, error) {
+	key, err := s.signingKeyManager.SigningKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("signing access token: %w", err)
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// parseAccessToken verifies the signature, issuer, audience and expiration of
+// an access token and returns its claims.
+func (s *service) parseAccessToken(ctx context.Context, accessToken string) (*AccessTokenClaims, error) {
+	jwtConfig := config.Config.Server.JWT
+
+	claims := &AccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, fmt.Errorf("missing key ID")
+			}
+
+			key, err := s.signingKeyManager.VerificationKey(ctx, kid)
+			if err != nil {
+				return nil, err
+			}
+			if key.Algorithm != token.Method.Alg() {
+				return nil, fmt.Errorf("signing method %s doesn't match key %s", token.Method.Alg(), kid)
+			}
+			return key.PublicKey, nil
+		},
+		jwt.WithValidMethods(signingkey.Algorithms),
+		jwt.WithIssuer(jwtConfig.Issuer),
+		jwt.WithAudience(jwtConfig.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// GetJWKS returns the public keys that verify the access tokens.
+func (s *service) GetJWKS(ctx context.Context) (*signingkey.JWKS, error) {
+	return s.signingKeyManager.JWKS(ctx)
+}
+
+// AuthTokenIssuer validates the user credentials and returns the claims of an
+// access token, leaving the signature to the caller.
+func (s *service) AuthTokenIssuer(ctx context.Context, username, password, mfaCode string) (*AccessTokenClaims, error) {
+	userUID, err := s.authenticate(ctx, username, password, mfaCode, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAccessTokenClaims(userUID, uuid.Nil)
+}
+
+// AuthTokens are the tokens issued on login and refresh.
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	// PasswordChangeRequired tells that the user must change their password
+	// before using the other APIs.
+	PasswordChangeRequired bool
+}
+
+// AuthLogin validates the user credentials and starts a login session. It
+// returns a signed access token along with the first refresh token of the
+// session.
+func (s *service) AuthLogin(ctx context.Context, username, password, mfaCode string) (*AuthTokens, error) {
+	userUID, err := s.authenticate(ctx, username, password, mfaCode, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, userUID)
+}
+
+// startSession starts a login session for an authenticated user.
+func (s *service) startSession(ctx context.Context, userUID uuid.UUID) (*AuthTokens, error) {
+	familyUID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, dbRefreshToken, err := newRefreshToken(familyUID)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent, ipAddress := requestClient(ctx)
+	family := &datamodel.RefreshTokenFamily{
+		Base:             datamodel.Base{UID: familyUID},
+		OwnerUID:         userUID,
+		UserAgent:        userAgent,
+		IPAddress:        ipAddress,
+		LastActivityTime: time.Now(),
+	}
+	if err := s.repository.CreateRefreshTokenFamily(ctx, family, dbRefreshToken); err != nil {
+		return nil, err
+	}
+
+	claims, err := newAccessTokenClaims(userUID, familyUID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.signAccessToken(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChangeRequired, err := s.IsPasswordChangeRequired(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		PasswordChangeRequired: passwordChangeRequired,
+	}, nil
+}
+
+// AuthRefresh exchanges a refresh token for a new access token and a new
+// refresh token. Refresh tokens are single-use: presenting one that was
+// already used means it leaked, so its whole family is revoked.
+func (s *service) AuthRefresh(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	dbRefreshToken, err := s.repository.GetRefreshToken(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil, errorsx.ErrUnauthenticated
+		}
+		return nil, err
+	}
+
+	family, err := s.repository.GetRefreshTokenFamily(ctx, dbRefreshToken.FamilyUID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil, errorsx.ErrUnauthenticated
+		}
+		return nil, err
+	}
+	if family.RevokeTime.Valid {
+		return nil, errorsx.ErrUnauthenticated
+	}
+	if dbRefreshToken.UseTime.Valid {
+		return nil, s.revokeReusedRefreshTokenFamily(ctx, family)
+	}
+	if time.Now().After(dbRefreshToken.ExpireTime) {
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	nextRefreshToken, nextDBRefreshToken, err := newRefreshToken(family.UID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repository.RotateRefreshToken(ctx, dbRefreshToken.UID, nextDBRefreshToken); err != nil {
+		// The token was used concurrently.
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return nil, s.revokeReusedRefreshTokenFamily(ctx, family)
+		}
+		return nil, err
+	}
+
+	userAgent, ipAddress := requestClient(ctx)
+	if err := s.repository.UpdateRefreshTokenFamilyActivity(ctx, family.UID, userAgent, ipAddress, time.Now()); err != nil {
+		return nil, err
+	}
+
+	claims, err := newAccessTokenClaims(family.OwnerUID, family.UID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.signAccessToken(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChangeRequired, err := s.IsPasswordChangeRequired(ctx, family.OwnerUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:            accessToken,
+		RefreshToken:           nextRefreshToken,
+		PasswordChangeRequired: passwordChangeRequired,
+	}, nil
+}
+
+// revokeReusedRefreshTokenFamily revokes a family where a token was presented
+// twice and returns the error to send back to the client.
+func (s *service) revokeReusedRefreshTokenFamily(ctx context.Context, family *datamodel.RefreshTokenFamily) error {
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Warn("Refresh token reused, revoking its family",
+		zap.String("familyUID", family.UID.String()),
+		zap.String("ownerUID", family.OwnerUID.String()),
+	)
+
+	if err := s.revokeSession(ctx, family.UID); err != nil {
+		return err
+	}
+	return errorsx.ErrUnauthenticated
+}
+
+// AuthLogout revokes an access token until it expires, along with the login
+// session it belongs to.
+func (s *service) AuthLogout(ctx context.Context, accessToken string) error {
+	claims, err := s.validateAccessToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if sessionUID := uuid.FromStringOrNil(claims.SessionID); sessionUID != uuid.Nil {
+		if err := s.revokeSession(ctx, sessionUID); err != nil {
+			return err
+		}
+	}
+
+	return s.setRevokedAccessTokenToCache(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// newRefreshToken generates a refresh token in a family. The token is returned
+// along with its database record, which only holds its hash.
+func newRefreshToken(familyUID uuid.UUID) (string, *datamodel.RefreshToken, error) {
+	refreshToken, tokenHash, err := newSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("generating refresh token: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, err
+	}
+
+	expiration := time.Duration(config.Config.Server.JWT.RefreshExpiration) * time.Second
+	return refreshToken, &datamodel.RefreshToken{
+		Base:       datamodel.Base{UID: uid},
+		FamilyUID:  familyUID,
+		TokenHash:  tokenHash,
+		ExpireTime: time.Now().Add(expiration),
+	}, nil
+}
+
+// newSecret generates a random secret, returned along with the hash it's
+// stored with.
+func newSecret() (secret, secretHash string, err error) {
+	b := make([]byte, secretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+// hashSecret returns the hash a random secret is stored with. The secrets are
+// random, so a plain SHA-256 is enough to protect them at rest.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthValidateAccessToken checks an access token and returns the UID of the
+// user it was issued to.
+func (s *service) AuthValidateAccessToken(ctx context.Context, accessToken string) (uuid.UUID, error) {
+	claims, err := s.validateAccessToken(ctx, accessToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.FromStringOrNil(claims.Subject), nil
+}
+
+func (s *service) validateAccessToken(ctx context.Context, accessToken string) (*AccessTokenClaims, error) {
+	claims, err := s.parseAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	if uuid.FromStringOrNil(claims.Subject) == uuid.Nil || claims.ID == "" {
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	if s.getRevokedAccessTokenFromCache(ctx, claims.ID, claims.SessionID) {
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	if now := time.Now(); claims.SessionID != "" && s.sessionActivity.allow(claims.SessionID, now) {
+		_ = s.setSessionActivityToCache(ctx, claims.SessionID, now)
+	}
+
+	return claims, nil
+}
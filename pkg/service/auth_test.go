@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// staticKeyManager signs with the first key and verifies with any of them.
+type staticKeyManager struct {
+	keys []*signingkey.Key
+}
+
+func (m *staticKeyManager) SigningKey(context.Context) (*signingkey.Key, error) {
+	return m.keys[0], nil
+}
+
+func (m *staticKeyManager) VerificationKey(_ context.Context, kid string) (*signingkey.Key, error) {
+	for _, key := range m.keys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+func (m *staticKeyManager) JWKS(context.Context) (*signingkey.JWKS, error) {
+	return &signingkey.JWKS{}, nil
+}
+
+func (m *staticKeyManager) RotateSigningKeys(context.Context, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func setupJWTConfig(t *testing.T) {
+	t.Helper()
+
+	original := config.Config.Server.JWT
+	t.Cleanup(func() { config.Config.Server.JWT = original })
+
+	config.Config.Server.JWT.Issuer = constant.DefaultJwtIssuer
+	config.Config.Server.JWT.Audience = constant.DefaultJwtAudience
+	config.Config.Server.JWT.Expiration = constant.DefaultJwtExpiration
+}
+
+func newTestKeyManager(t *testing.T, algorithms ...string) *staticKeyManager {
+	t.Helper()
+
+	m := &staticKeyManager{}
+	for _, algorithm := range algorithms {
+		key, err := signingkey.GenerateKey(algorithm)
+		require.NoError(t, err)
+		m.keys = append(m.keys, key)
+	}
+	return m
+}
+
+func TestAccessToken_SignAndParse(t *testing.T) {
+	setupJWTConfig(t)
+	ctx := context.Background()
+
+	for _, algorithm := range signingkey.Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			s := &service{signingKeyManager: newTestKeyManager(t, algorithm)}
+
+			userUID := uuid.Must(uuid.NewV4())
+			claims, err := newAccessTokenClaims(userUID, uuid.Nil)
+			require.NoError(t, err)
+
+			accessToken, err := s.signAccessToken(ctx, claims)
+			require.NoError(t, err)
+
+			parsed, err := s.parseAccessToken(ctx, accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, userUID.String(), parsed.Subject)
+			assert.Equal(t, claims.ID, parsed.ID)
+			assert.Equal(t, constant.DefaultJwtIssuer, parsed.Issuer)
+		})
+	}
+}
+
+func TestAccessToken_ParseRejectsInvalidTokens(t *testing.T) {
+	setupJWTConfig(t)
+	ctx := context.Background()
+
+	s := &service{signingKeyManager: newTestKeyManager(t, signingkey.AlgorithmRS256)}
+
+	claims, err := newAccessTokenClaims(uuid.Must(uuid.NewV4()), uuid.Nil)
+	require.NoError(t, err)
+
+	t.Run("unknown key", func(t *testing.T) {
+		other := &service{signingKeyManager: newTestKeyManager(t, signingkey.AlgorithmRS256)}
+		accessToken, err := other.signAccessToken(ctx, claims)
+		require.NoError(t, err)
+
+		_, err = s.parseAccessToken(ctx, accessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing key ID", func(t *testing.T) {
+		key := s.signingKeyManager.(*staticKeyManager).keys[0]
+		accessToken, err := jwt.NewWithClaims(key.Method, claims).SignedString(key.PrivateKey)
+		require.NoError(t, err)
+
+		_, err = s.parseAccessToken(ctx, accessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("symmetric signature", func(t *testing.T) {
+		key := s.signingKeyManager.(*staticKeyManager).keys[0]
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = key.ID
+		accessToken, err := token.SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		_, err = s.parseAccessToken(ctx, accessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		wrongAudience := *claims
+		wrongAudience.Audience = jwt.ClaimStrings{"https://example.com"}
+		accessToken, err := s.signAccessToken(ctx, &wrongAudience)
+		require.NoError(t, err)
+
+		_, err = s.parseAccessToken(ctx, accessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		accessToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+
+		_, err = s.parseAccessToken(ctx, accessToken)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthValidateAccessToken_Revoked(t *testing.T) {
+	setupJWTConfig(t)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient, signingKeyManager: newTestKeyManager(t, signingkey.AlgorithmEdDSA)}
+
+	userUID := uuid.Must(uuid.NewV4())
+	claims, err := newAccessTokenClaims(userUID, uuid.Nil)
+	require.NoError(t, err)
+	accessToken, err := s.signAccessToken(context.Background(), claims)
+	require.NoError(t, err)
+
+	revokedKey := fmt.Sprintf("%s:%s", CacheTargetRevokedAccessToken, claims.ID)
+
+	redisMock.ExpectExists(revokedKey).SetVal(0)
+	got, err := s.AuthValidateAccessToken(context.Background(), accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userUID, got)
+
+	redisMock.ExpectExists(revokedKey).SetVal(1)
+	_, err = s.AuthValidateAccessToken(context.Background(), accessToken)
+	assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestValidateToken_RevokedSession(t *testing.T) {
+	setupJWTConfig(t)
+	config.Config.Server.JWT.RefreshExpiration = constant.DefaultJwtRefreshExpiration
+	ctx := context.Background()
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient, signingKeyManager: newTestKeyManager(t, signingkey.AlgorithmEdDSA)}
+
+	userUID := uuid.Must(uuid.NewV4())
+	sessionUID := uuid.Must(uuid.NewV4())
+	claims, err := newAccessTokenClaims(userUID, sessionUID)
+	require.NoError(t, err)
+	accessToken, err := s.signAccessToken(ctx, claims)
+	require.NoError(t, err)
+
+	revokedKey := fmt.Sprintf("%s:%s", CacheTargetRevokedAccessToken, claims.ID)
+	revokedSessionKey := fmt.Sprintf("%s:%s", CacheTargetRevokedSession, sessionUID)
+	activityKey := fmt.Sprintf("%s:%s", CacheTargetSessionActivity, sessionUID)
+	refreshExpiration := time.Duration(constant.DefaultJwtRefreshExpiration) * time.Second
+
+	redisMock.ExpectExists(revokedKey, revokedSessionKey).SetVal(0)
+	redisMock.Regexp().ExpectSet(activityKey, `\d+`, refreshExpiration).SetVal("OK")
+	got, scopes, err := s.ValidateToken(ctx, accessToken, "")
+	require.NoError(t, err)
+	assert.Equal(t, userUID.String(), got)
+	assert.Empty(t, scopes)
+
+	// The activity is recorded at most once a minute.
+	redisMock.ExpectExists(revokedKey, revokedSessionKey).SetVal(0)
+	_, _, err = s.ValidateToken(ctx, accessToken, "")
+	require.NoError(t, err)
+
+	redisMock.ExpectExists(revokedKey, revokedSessionKey).SetVal(1)
+	_, _, err = s.ValidateToken(ctx, accessToken, "")
+	assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+// refreshTokenRepository keeps the refresh token families in memory.
+type refreshTokenRepository struct {
+	repository.Repository
+
+	families       map[uuid.UUID]*datamodel.RefreshTokenFamily
+	tokens         map[string]*datamodel.RefreshToken
+	changeRequired bool
+}
+
+func newRefreshTokenRepository() *refreshTokenRepository {
+	return &refreshTokenRepository{
+		families: map[uuid.UUID]*datamodel.RefreshTokenFamily{},
+		tokens:   map[string]*datamodel.RefreshToken{},
+	}
+}
+
+func (r *refreshTokenRepository) CreateRefreshTokenFamily(_ context.Context, family *datamodel.RefreshTokenFamily, token *datamodel.RefreshToken) error {
+	r.families[family.UID] = family
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *refreshTokenRepository) GetRefreshTokenFamily(_ context.Context, uid uuid.UUID) (*datamodel.RefreshTokenFamily, error) {
+	family, ok := r.families[uid]
+	if !ok {
+		return nil, errorsx.ErrNotFound
+	}
+	return family, nil
+}
+
+func (r *refreshTokenRepository) UpdateRefreshTokenFamilyActivity(_ context.Context, uid uuid.UUID, userAgent, ipAddress string, lastActivityTime time.Time) error {
+	family := r.families[uid]
+	family.UserAgent, family.IPAddress, family.LastActivityTime = userAgent, ipAddress, lastActivityTime
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeRefreshTokenFamily(_ context.Context, uid uuid.UUID) error {
+	r.families[uid].RevokeTime = sql.NullTime{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *refreshTokenRepository) GetRefreshToken(_ context.Context, tokenHash string) (*datamodel.RefreshToken, error) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, errorsx.ErrNotFound
+	}
+	return token, nil
+}
+
+func (r *refreshTokenRepository) GetUserPasswordChangeRequired(context.Context, uuid.UUID) (bool, error) {
+	return r.changeRequired, nil
+}
+
+func (r *refreshTokenRepository) RotateRefreshToken(_ context.Context, usedUID uuid.UUID, next *datamodel.RefreshToken) error {
+	for _, token := range r.tokens {
+		if token.UID == usedUID {
+			if token.UseTime.Valid {
+				return errorsx.ErrNoDataUpdated
+			}
+			token.UseTime = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	r.tokens[next.TokenHash] = next
+	return nil
+}
+
+func TestAuthRefresh(t *testing.T) {
+	setupJWTConfig(t)
+	config.Config.Server.JWT.RefreshExpiration = constant.DefaultJwtRefreshExpiration
+	ctx := context.Background()
+
+	newSession := func(t *testing.T) (*service, *refreshTokenRepository, redismock.ClientMock, string) {
+		repo := newRefreshTokenRepository()
+		redisClient, redisMock := redismock.NewClientMock()
+		s := &service{repository: repo, redisClient: redisClient, signingKeyManager: newTestKeyManager(t, signingkey.AlgorithmEdDSA)}
+
+		ownerUID := uuid.Must(uuid.NewV4())
+		familyUID := uuid.Must(uuid.NewV4())
+		refreshToken, dbRefreshToken, err := newRefreshToken(familyUID)
+		require.NoError(t, err)
+		require.NoError(t, repo.CreateRefreshTokenFamily(ctx, &datamodel.RefreshTokenFamily{
+			Base:     datamodel.Base{UID: familyUID},
+			OwnerUID: ownerUID,
+		}, dbRefreshToken))
+
+		return s, repo, redisMock, refreshToken
+	}
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		s, repo, _, refreshToken := newSession(t)
+
+		tokens, err := s.AuthRefresh(ctx, refreshToken)
+		require.NoError(t, err)
+		assert.NotEqual(t, refreshToken, tokens.RefreshToken)
+
+		claims, err := s.parseAccessToken(ctx, tokens.AccessToken)
+		require.NoError(t, err)
+		family := repo.families[uuid.FromStringOrNil(claims.SessionID)]
+		require.NotNil(t, family)
+		assert.Equal(t, family.OwnerUID.String(), claims.Subject)
+
+		_, err = s.AuthRefresh(ctx, tokens.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("tells that the password must be changed", func(t *testing.T) {
+		s, repo, _, refreshToken := newSession(t)
+		repo.changeRequired = true
+
+		tokens, err := s.AuthRefresh(ctx, refreshToken)
+		require.NoError(t, err)
+		assert.True(t, tokens.PasswordChangeRequired)
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		s, repo, redisMock, refreshToken := newSession(t)
+
+		tokens, err := s.AuthRefresh(ctx, refreshToken)
+		require.NoError(t, err)
+
+		for uid := range repo.families {
+			revokedSessionKey := fmt.Sprintf("%s:%s", CacheTargetRevokedSession, uid)
+			redisMock.Regexp().ExpectSet(revokedSessionKey, `\d+`, time.Hour).SetVal("OK")
+		}
+		_, err = s.AuthRefresh(ctx, refreshToken)
+		assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+
+		// The token issued by the legitimate refresh is revoked too.
+		_, err = s.AuthRefresh(ctx, tokens.RefreshToken)
+		assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+		for _, family := range repo.families {
+			assert.True(t, family.RevokeTime.Valid)
+		}
+		assert.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		s, repo, _, refreshToken := newSession(t)
+		repo.tokens[hashSecret(refreshToken)].ExpireTime = time.Now().Add(-time.Second)
+
+		_, err := s.AuthRefresh(ctx, refreshToken)
+		assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		s, _, _, _ := newSession(t)
+
+		_, err := s.AuthRefresh(ctx, "unknown")
+		assert.ErrorIs(t, err, errorsx.ErrUnauthenticated)
+	})
+}
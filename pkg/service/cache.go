@@ -2,18 +2,33 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"google.golang.org/protobuf/encoding/protojson"
 
+	"github.com/instill-ai/mgmt-backend/config"
+
 	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
 )
 
 const CacheTargetUser = "user"
 const CacheTargetToken = "api_token"
 const CacheTargetUserPasswordHash = "user_password_hash"
+const CacheTargetRevokedAccessToken = "revoked_access_token"
+const CacheTargetRevokedSession = "revoked_session"
+const CacheTargetSessionActivity = "session_activity"
+const CacheTargetLoginFailure = "login_failure"
+const CacheTargetLoginBackoff = "login_backoff"
+const CacheTargetLoginLockout = "login_lockout"
+const CacheTargetPasswordChangeRequired = "password_change_required"
+const CacheTargetUsedTOTPCode = "used_totp_code"
+const CacheTargetPasswordResetRequest = "password_reset_request"
+const CacheTargetEmailVerificationRequest = "email_verification_request"
+const CacheTargetOIDCLogin = "oidc_login"
 
 func (s *service) getFromCacheByID(ctx context.Context, target string, id string) interface{} {
 	getCmd := s.redisClient.Get(ctx, fmt.Sprintf("%s:%s", target, id))
@@ -149,17 +164,41 @@ func (s *service) deleteUserPasswordHashFromCache(ctx context.Context, uid uuid.
 	return nil
 }
 
-func (s *service) getAPITokenFromCache(ctx context.Context, token string) uuid.UUID {
-	getCmd := s.redisClient.Get(ctx, fmt.Sprintf("%s:%s:user_uid", CacheTargetToken, token))
-	if getCmd.Err() == nil {
-		return uuid.FromStringOrNil(getCmd.Val())
+// The API tokens are cached by their hash, like they're stored. A cached
+// token is accepted without a lookup, so the entry never outlives the token.
+
+// cachedAPIToken is what a cached API token authenticates.
+type cachedAPIToken struct {
+	UserUID      uuid.UUID `json:"userUid"`
+	Scopes       []string  `json:"scopes,omitempty"`
+	AllowedCIDRs []string  `json:"allowedCidrs,omitempty"`
+}
+
+func (s *service) getAPITokenFromCache(ctx context.Context, tokenHash string) *cachedAPIToken {
+	b, err := s.redisClient.Get(ctx, fmt.Sprintf("%s:%s", CacheTargetToken, tokenHash)).Bytes()
+	if err != nil {
+		return nil
+	}
+	token := &cachedAPIToken{}
+	if err := json.Unmarshal(b, token); err != nil || token.UserUID == uuid.Nil {
+		return nil
 	}
-	return uuid.Nil
+	return token
 }
 
-func (s *service) setAPITokenToCache(ctx context.Context, token string, userUID uuid.UUID, expire time.Time) error {
+func (s *service) setAPITokenToCache(ctx context.Context, tokenHash string, token *cachedAPIToken, expire time.Time) error {
 
-	setCmd := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s:user_uid", CacheTargetToken, token), userUID.String(), 5*time.Minute)
+	ttl := min(5*time.Minute, time.Until(expire))
+	if ttl <= 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	setCmd := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetToken, tokenHash), string(b), ttl)
 	if setCmd.Err() != nil {
 		return setCmd.Err()
 	}
@@ -167,12 +206,120 @@ func (s *service) setAPITokenToCache(ctx context.Context, token string, userUID
 	return nil
 }
 
-func (s *service) deleteAPITokenFromCache(ctx context.Context, token string) error {
+func (s *service) deleteAPITokenFromCache(ctx context.Context, tokenHash string) error {
 
-	setCmd := s.redisClient.Del(ctx, fmt.Sprintf("%s:%s:user_uid", CacheTargetToken, token))
+	setCmd := s.redisClient.Del(ctx, fmt.Sprintf("%s:%s", CacheTargetToken, tokenHash))
 	if setCmd.Err() != nil {
 		return setCmd.Err()
 	}
 
 	return nil
 }
+
+// getRevokedAccessTokenFromCache checks whether an access token or the session
+// it belongs to has been revoked. As this guards the authentication, a cache
+// error is treated as a revocation.
+func (s *service) getRevokedAccessTokenFromCache(ctx context.Context, jti string, sid string) bool {
+	keys := []string{fmt.Sprintf("%s:%s", CacheTargetRevokedAccessToken, jti)}
+	if sid != "" {
+		keys = append(keys, fmt.Sprintf("%s:%s", CacheTargetRevokedSession, sid))
+	}
+
+	existsCmd := s.redisClient.Exists(ctx, keys...)
+	if existsCmd.Err() != nil {
+		return true
+	}
+	return existsCmd.Val() > 0
+}
+
+// setRevokedAccessTokenToCache revokes an access token. The entry only needs
+// to outlive the token, after which its expiration rejects it anyway.
+func (s *service) setRevokedAccessTokenToCache(ctx context.Context, jti string, expire time.Time) error {
+
+	ttl := time.Until(expire)
+	if ttl <= 0 {
+		return nil
+	}
+
+	setCmd := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetRevokedAccessToken, jti), time.Now().Unix(), ttl)
+	if setCmd.Err() != nil {
+		return setCmd.Err()
+	}
+
+	return nil
+}
+
+// setRevokedSessionToCache rejects the access tokens of a session. The refresh
+// tokens are revoked in the database, so the entry only needs to outlive the
+// access tokens issued so far.
+func (s *service) setRevokedSessionToCache(ctx context.Context, sid string) error {
+
+	ttl := time.Duration(config.Config.Server.JWT.Expiration) * time.Second
+
+	setCmd := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetRevokedSession, sid), time.Now().Unix(), ttl)
+	if setCmd.Err() != nil {
+		return setCmd.Err()
+	}
+
+	return nil
+}
+
+// getSessionActivityFromCache returns the last time the access tokens of each
+// session were validated. The sessions without activity are omitted.
+func (s *service) getSessionActivityFromCache(ctx context.Context, sids []string) map[string]time.Time {
+
+	activity := map[string]time.Time{}
+	if len(sids) == 0 {
+		return activity
+	}
+
+	keys := make([]string, len(sids))
+	for i, sid := range sids {
+		keys[i] = fmt.Sprintf("%s:%s", CacheTargetSessionActivity, sid)
+	}
+
+	getCmd := s.redisClient.MGet(ctx, keys...)
+	if getCmd.Err() != nil {
+		return activity
+	}
+	for i, v := range getCmd.Val() {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if unix, err := strconv.ParseInt(str, 10, 64); err == nil {
+			activity[sids[i]] = time.Unix(unix, 0)
+		}
+	}
+
+	return activity
+}
+
+func (s *service) setSessionActivityToCache(ctx context.Context, sid string, activityTime time.Time) error {
+
+	ttl := time.Duration(config.Config.Server.JWT.RefreshExpiration) * time.Second
+
+	setCmd := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetSessionActivity, sid), activityTime.Unix(), ttl)
+	if setCmd.Err() != nil {
+		return setCmd.Err()
+	}
+
+	return nil
+}
+
+func (s *service) getPasswordChangeRequiredFromCache(ctx context.Context, uid uuid.UUID) (required bool, ok bool) {
+	getCmd := s.redisClient.Get(ctx, fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid))
+	if getCmd.Err() != nil {
+		return false, false
+	}
+	required, err := strconv.ParseBool(getCmd.Val())
+	return required, err == nil
+}
+
+func (s *service) setPasswordChangeRequiredToCache(ctx context.Context, uid uuid.UUID, required bool) error {
+	return s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid), strconv.FormatBool(required), 5*time.Minute).Err()
+}
+
+func (s *service) deletePasswordChangeRequiredFromCache(ctx context.Context, uid uuid.UUID) error {
+	return s.redisClient.Del(ctx, fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid)).Err()
+}
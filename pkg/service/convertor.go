@@ -19,6 +19,7 @@ import (
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
 	"golang.org/x/image/draw"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -28,6 +29,7 @@ import (
 	"github.com/instill-ai/x/resource"
 
 	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
+	logx "github.com/instill-ai/x/log"
 )
 
 // generateSlug generates a URL-friendly slug from a display name.
@@ -48,6 +50,11 @@ func generateSlug(displayName string) string {
 	return slug
 }
 
+// newUserID returns the ID of a new user, derived from their UID.
+func newUserID(uid uuid.UUID) string {
+	return resource.GeneratePrefixedID("usr", uid)
+}
+
 // maps for user owner type
 var (
 	PBUserType2DBUserType = map[mgmtpb.OwnerType]string{
@@ -235,11 +242,11 @@ func (s *service) PBAuthenticatedUser2DBUser(ctx context.Context, pbUser *mgmtpb
 		// ID format: usr-{base62(sha256(uid)[:10])}
 		// Example: "usr-8f3A2k9E7c1xYz"
 		uid = uuid.Must(uuid.NewV4())
-		userID = resource.GeneratePrefixedID("usr", uid)
+		userID = newUserID(uid)
 	}
 
 	userType := "user"
-	email := pbUser.GetEmail()
+	email := datamodel.NormalizeEmail(pbUser.GetEmail())
 
 	profileAvatar, err := s.compressAvatar(pbUser.GetProfile().GetAvatar())
 	if err != nil {
@@ -335,28 +342,63 @@ func (s *service) DBUsers2PBAuthenticatedUsers(ctx context.Context, dbUsers []*d
 
 // DBToken2PBToken converts a database user instance to proto user
 func (s *service) DBToken2PBToken(ctx context.Context, dbToken *datamodel.Token) (*mgmtpb.ApiToken, error) {
+	return dbToken2PBToken(dbToken, s.bufferedTokenLastUses(ctx, []*datamodel.Token{dbToken})), nil
+}
+
+// bufferedTokenLastUses returns the uses of the tokens that aren't flushed
+// yet, by token hash. The stored last uses are shown if they can't be read.
+func (s *service) bufferedTokenLastUses(ctx context.Context, dbTokens []*datamodel.Token) map[string]*datamodel.TokenLastUse {
+	tokenHashes := make([]string, 0, 2*len(dbTokens))
+	for _, dbToken := range dbTokens {
+		tokenHashes = append(tokenHashes, dbToken.AccessTokenHash)
+		if dbToken.PreviousAccessTokenHash.Valid {
+			tokenHashes = append(tokenHashes, dbToken.PreviousAccessTokenHash.String)
+		}
+	}
+
+	uses, err := s.repository.GetBufferedTokenLastUses(ctx, tokenHashes...)
+	if err != nil {
+		logger, _ := logx.GetZapLogger(ctx)
+		logger.Warn("Failed to get the buffered token last uses", zap.Error(err))
+	}
+	return uses
+}
+
+func dbToken2PBToken(dbToken *datamodel.Token, bufferedUses map[string]*datamodel.TokenLastUse) *mgmtpb.ApiToken {
 	id := dbToken.ID
 	state := mgmtpb.ApiToken_State(dbToken.State)
 	if dbToken.ExpireTime.Before(time.Now()) {
 		state = mgmtpb.ApiToken_State(mgmtpb.ApiToken_STATE_EXPIRED)
 	}
 
+	// The uses not flushed yet are more recent than the stored one.
+	lastUseTime := dbToken.LastUseTime
+	tokenHashes := []string{dbToken.AccessTokenHash}
+	if dbToken.PreviousAccessTokenHash.Valid {
+		tokenHashes = append(tokenHashes, dbToken.PreviousAccessTokenHash.String)
+	}
+	for _, tokenHash := range tokenHashes {
+		if use, ok := bufferedUses[tokenHash]; ok && use.Time.After(lastUseTime) {
+			lastUseTime = use.Time
+		}
+	}
+
 	return &mgmtpb.ApiToken{
 		Name:        fmt.Sprintf("tokens/%s", id),
 		Id:          id,
 		State:       state,
-		AccessToken: dbToken.AccessToken,
+		AccessToken: dbToken.AccessTokenPrefix,
 		TokenType:   dbToken.TokenType,
 		Expiration:  &mgmtpb.ApiToken_ExpireTime{ExpireTime: timestamppb.New(dbToken.ExpireTime)},
 		CreateTime:  timestamppb.New(dbToken.CreateTime),
 		UpdateTime:  timestamppb.New(dbToken.UpdateTime),
 		LastUseTime: func() *timestamppb.Timestamp {
-			if dbToken.LastUseTime.IsZero() {
+			if lastUseTime.IsZero() {
 				return nil
 			}
-			return timestamppb.New(dbToken.LastUseTime)
+			return timestamppb.New(lastUseTime)
 		}(),
-	}, nil
+	}
 }
 
 // PBToken2DBToken converts a proto user instance to database user
@@ -380,28 +422,20 @@ func (s *service) PBToken2DBToken(ctx context.Context, pbToken *mgmtpb.ApiToken)
 				return time.Time{}
 			}(),
 		},
-		ID:          pbToken.GetId(),
-		State:       datamodel.TokenState(pbToken.GetState()),
-		AccessToken: pbToken.AccessToken,
-		TokenType:   pbToken.TokenType,
-		ExpireTime:  pbToken.GetExpireTime().AsTime(),
+		ID:         pbToken.GetId(),
+		State:      datamodel.TokenState(pbToken.GetState()),
+		TokenType:  pbToken.TokenType,
+		ExpireTime: pbToken.GetExpireTime().AsTime(),
 	}
 	return r, nil
 
 }
 
 func (s *service) DBTokens2PBTokens(ctx context.Context, dbTokens []*datamodel.Token) ([]*mgmtpb.ApiToken, error) {
-	var err error
-	pbUsers := make([]*mgmtpb.ApiToken, len(dbTokens))
+	bufferedUses := s.bufferedTokenLastUses(ctx, dbTokens)
+	pbTokens := make([]*mgmtpb.ApiToken, len(dbTokens))
 	for idx := range dbTokens {
-		pbUsers[idx], err = s.DBToken2PBToken(
-			ctx,
-			dbTokens[idx],
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		pbTokens[idx] = dbToken2PBToken(dbTokens[idx], bufferedUses)
 	}
-	return pbUsers, nil
+	return pbTokens, nil
 }
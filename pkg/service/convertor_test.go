@@ -123,3 +123,11 @@ func TestPBAuthenticatedUser2DBUser_CreateGeneratesUniqueIDs(t *testing.T) {
 	assert.NotEqual(t, dbUser1.UID, dbUser2.UID, "Each new user should get a unique UID")
 	assert.NotEqual(t, dbUser1.ID, dbUser2.ID, "Each new user should get a unique ID")
 }
+
+func TestPBAuthenticatedUser2DBUser_NormalizesEmail(t *testing.T) {
+	s := &service{}
+
+	dbUser, err := s.PBAuthenticatedUser2DBUser(context.Background(), &mgmtpb.AuthenticatedUser{Email: " Alice@Example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", dbUser.Email)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/mail"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// emailVerificationRequestInterval is the minimum time between two
+// verification emails sent for the same user.
+const emailVerificationRequestInterval = time.Minute
+
+// ErrInvalidEmailVerificationToken is returned when an email verification
+// token doesn't exist, expired or was already used.
+var ErrInvalidEmailVerificationToken = fmt.Errorf("%w: invalid or expired email verification token", errorsx.ErrInvalidArgument)
+
+const emailVerificationMailBody = `Hi %s,
+
+Follow this link to verify the email address of your account:
+
+%s
+
+The link expires in %s and can only be used once. If you didn't ask for it,
+you can ignore this email.
+`
+
+const emailChangedMailBody = `Hi %s,
+
+The email address of your account was changed to %s. If you didn't make this
+change, contact your administrator right away.
+`
+
+// EmailStatus describes the email of a user and the address they're changing
+// it to, if any.
+type EmailStatus struct {
+	Email    string
+	Verified bool
+	// PendingEmail is the address waiting for a confirmation, when it isn't
+	// the current one.
+	PendingEmail string
+}
+
+// GetEmailStatus returns the email status of a user.
+func (s *service) GetEmailStatus(ctx context.Context, userUID uuid.UUID) (*EmailStatus, error) {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	user, err := s.repository.GetUserByUID(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	emailStatus := &EmailStatus{Email: user.Email, Verified: user.EmailVerified}
+
+	token, err := s.repository.GetPendingEmailVerificationToken(ctx, userUID)
+	if err != nil && !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && token.Email != user.Email {
+		emailStatus.PendingEmail = token.Email
+	}
+
+	return emailStatus, nil
+}
+
+// SendEmailVerification sends a verification link to the current email of a
+// user.
+func (s *service) SendEmailVerification(ctx context.Context, userUID uuid.UUID) error {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	user, err := s.repository.GetUserByUID(ctx, userUID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return fmt.Errorf("%w: email is already verified", errorsx.ErrAlreadyExists)
+	}
+
+	return s.sendEmailVerification(ctx, user, user.Email)
+}
+
+// RequestEmailChange sends a verification link to the new email of a user.
+// The email only changes once the link is followed, the current address is
+// then notified.
+func (s *service) RequestEmailChange(ctx context.Context, userUID uuid.UUID, email string) error {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	email = datamodel.NormalizeEmail(email)
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("%w: invalid email address", errorsx.ErrInvalidArgument)
+	}
+
+	user, err := s.repository.GetUserByUID(ctx, userUID)
+	if err != nil {
+		return err
+	}
+	if email == user.Email {
+		return fmt.Errorf("%w: the email is already %s", errorsx.ErrInvalidArgument, email)
+	}
+
+	if _, err := s.repository.GetUserByEmail(ctx, email); err == nil {
+		return fmt.Errorf("%w: email is already used", errorsx.ErrAlreadyExists)
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return err
+	}
+
+	return s.sendEmailVerification(ctx, user, email)
+}
+
+// ConfirmEmail verifies the email address an email verification token was
+// sent to. If it isn't the current email of the user, it replaces it.
+func (s *service) ConfirmEmail(ctx context.Context, token string) error {
+	dbToken, err := s.repository.GetEmailVerificationToken(ctx, hashSecret(token))
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return ErrInvalidEmailVerificationToken
+		}
+		return err
+	}
+	if dbToken.UseTime.Valid || time.Now().After(dbToken.ExpireTime) {
+		return ErrInvalidEmailVerificationToken
+	}
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, dbToken.OwnerUID)
+	user, err := s.repository.GetUserByUID(ctx, dbToken.OwnerUID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.VerifyUserEmail(ctx, dbToken); err != nil {
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return ErrInvalidEmailVerificationToken
+		}
+		return err
+	}
+	if err := s.deleteUserFromCacheByIDAndUID(ctx, user.ID, user.UID); err != nil {
+		return err
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	if dbToken.Email == user.Email {
+		logger.Info("Email verified", zap.String("userUID", user.UID.String()))
+		return nil
+	}
+	logger.Info("Email changed", zap.String("userUID", user.UID.String()))
+
+	// The email already changed, a failure to notify the previous address
+	// isn't returned to the user.
+	if user.Email != "" {
+		if err := s.mailSender.Send(ctx, &mail.Message{
+			To:      user.Email,
+			Subject: "Your email address was changed",
+			Body:    fmt.Sprintf(emailChangedMailBody, user.ID, dbToken.Email),
+		}); err != nil {
+			logger.Error("Failed to notify the previous email address", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// sendEmailVerification sends a verification link to an address of a user.
+// At most one link is sent per interval, so the endpoints can't be used to
+// flood a mailbox. The check fails open.
+func (s *service) sendEmailVerification(ctx context.Context, user *datamodel.Owner, email string) error {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	sent, err := s.redisClient.SetNX(ctx, fmt.Sprintf("%s:%s", CacheTargetEmailVerificationRequest, user.UID), 1, emailVerificationRequestInterval).Result()
+	if err != nil {
+		logger.Error("Failed to throttle email verification requests", zap.Error(err))
+	} else if !sent {
+		return fmt.Errorf("%w: a verification email was sent recently, try again later", errorsx.ErrRateLimiting)
+	}
+
+	token, dbToken, err := newEmailVerificationToken(user.UID, email)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.CreateEmailVerificationToken(ctx, dbToken); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(config.Config.Server.EmailVerification.URL)
+	if err != nil {
+		return fmt.Errorf("parsing email verification URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return s.mailSender.Send(ctx, &mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf(emailVerificationMailBody, user.ID, link, config.Config.Server.EmailVerification.TokenTTL),
+	})
+}
+
+// newEmailVerificationToken generates an email verification token for an
+// address. The token is returned along with its database record, which only
+// holds its hash.
+func newEmailVerificationToken(userUID uuid.UUID, email string) (string, *datamodel.EmailVerificationToken, error) {
+	token, tokenHash, err := newSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("generating email verification token: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &datamodel.EmailVerificationToken{
+		Base:       datamodel.Base{UID: uid},
+		OwnerUID:   userUID,
+		Email:      email,
+		TokenHash:  tokenHash,
+		ExpireTime: time.Now().Add(config.Config.Server.EmailVerification.TokenTTL),
+	}, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// emailRepository keeps a single user and their verification tokens in
+// memory.
+type emailRepository struct {
+	repository.Repository
+
+	owner  *datamodel.Owner
+	tokens []*datamodel.EmailVerificationToken
+}
+
+func (r *emailRepository) GetUserByUID(context.Context, uuid.UUID) (*datamodel.Owner, error) {
+	owner := *r.owner
+	return &owner, nil
+}
+
+func (r *emailRepository) GetUserByEmail(_ context.Context, email string) (*datamodel.Owner, error) {
+	if email == "taken@example.com" {
+		return &datamodel.Owner{}, nil
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *emailRepository) CreateEmailVerificationToken(_ context.Context, token *datamodel.EmailVerificationToken) error {
+	r.tokens = []*datamodel.EmailVerificationToken{token}
+	return nil
+}
+
+func (r *emailRepository) GetEmailVerificationToken(_ context.Context, tokenHash string) (*datamodel.EmailVerificationToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *emailRepository) GetPendingEmailVerificationToken(context.Context, uuid.UUID) (*datamodel.EmailVerificationToken, error) {
+	for _, token := range r.tokens {
+		if !token.UseTime.Valid {
+			return token, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *emailRepository) VerifyUserEmail(_ context.Context, token *datamodel.EmailVerificationToken) error {
+	if token.UseTime.Valid {
+		return errorsx.ErrNoDataUpdated
+	}
+	token.UseTime.Time, token.UseTime.Valid = time.Now(), true
+	r.owner.Email, r.owner.EmailVerified = token.Email, true
+	return nil
+}
+
+func TestEmailChange(t *testing.T) {
+	original := config.Config.Server.EmailVerification
+	t.Cleanup(func() { config.Config.Server.EmailVerification = original })
+	config.Config.Server.EmailVerification.URL = "http://localhost:3000/verify-email"
+	config.Config.Server.EmailVerification.TokenTTL = time.Hour
+
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	repo := &emailRepository{owner: &datamodel.Owner{
+		Base:          datamodel.Base{UID: uid},
+		ID:            "jane",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+	}}
+	redisClient, redisMock := redismock.NewClientMock()
+	sender := &mailbox{}
+	s := &service{repository: repo, redisClient: redisClient, mailSender: sender}
+
+	assert.True(t, errors.Is(s.RequestEmailChange(ctx, uid, "Jane <jane@new.com>"), errorsx.ErrInvalidArgument))
+	assert.True(t, errors.Is(s.RequestEmailChange(ctx, uid, "taken@example.com"), errorsx.ErrAlreadyExists))
+
+	requestKey := fmt.Sprintf("%s:%s", CacheTargetEmailVerificationRequest, uid)
+	redisMock.ExpectSetNX(requestKey, 1, emailVerificationRequestInterval).SetVal(true)
+	require.NoError(t, s.RequestEmailChange(ctx, uid, "jane@new.com"))
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "jane@new.com", sender.messages[0].To)
+
+	// A second request within the interval doesn't send another link.
+	redisMock.ExpectSetNX(requestKey, 1, emailVerificationRequestInterval).SetVal(false)
+	assert.True(t, errors.Is(s.RequestEmailChange(ctx, uid, "jane@other.com"), errorsx.ErrRateLimiting))
+	assert.Len(t, sender.messages, 1)
+
+	// The new address is pending until it's verified.
+	emailStatus, err := s.GetEmailStatus(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, &EmailStatus{Email: "jane@example.com", Verified: true, PendingEmail: "jane@new.com"}, emailStatus)
+
+	link, err := url.Parse(regexp.MustCompile(`http://\S+`).FindString(sender.messages[0].Body))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+
+	assert.True(t, errors.Is(s.ConfirmEmail(ctx, "wrong"), ErrInvalidEmailVerificationToken))
+
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUser, "jane")).SetVal(1)
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUser, uid)).SetVal(1)
+	require.NoError(t, s.ConfirmEmail(ctx, token))
+	assert.Equal(t, "jane@new.com", repo.owner.Email)
+
+	// The previous address is notified.
+	require.Len(t, sender.messages, 2)
+	assert.Equal(t, "jane@example.com", sender.messages[1].To)
+	assert.Contains(t, sender.messages[1].Body, "jane@new.com")
+
+	assert.True(t, errors.Is(s.ConfirmEmail(ctx, token), ErrInvalidEmailVerificationToken))
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/ldap"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/x/checkfield"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// authenticateWithLDAP checks the credentials against the directory. Nil is
+// returned when there's no directory, the credentials are rejected or the
+// directory can't be reached.
+func (s *service) authenticateWithLDAP(ctx context.Context, username, password string) *ldap.Identity {
+	if s.ldapAuthenticator == nil {
+		return nil
+	}
+
+	identity, err := s.ldapAuthenticator.Authenticate(ctx, username, password)
+	if err != nil {
+		if !errors.Is(err, ldap.ErrInvalidCredentials) {
+			logger, _ := logx.GetZapLogger(ctx)
+			logger.Error("Failed to authenticate against the LDAP server", zap.Error(err))
+		}
+		return nil
+	}
+
+	return identity
+}
+
+// getOrCreateLDAPUser returns the user linked to a directory identity. The
+// user is created on their first login, with the ID derived from their
+// directory username. A local user is never linked to a directory identity,
+// the login is refused if their ID or email is already used.
+func (s *service) getOrCreateLDAPUser(ctx context.Context, identity *ldap.Identity) (*datamodel.Owner, error) {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	ownerIdentity, err := s.repository.GetOwnerIdentity(ctx, ldap.Issuer, identity.ID)
+	if err == nil {
+		return s.repository.GetUserByUID(ctx, ownerIdentity.OwnerUID)
+	}
+	if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+
+	id := generateSlug(identity.Username)
+	if err := checkfield.CheckResourceID(id); err != nil {
+		logger.Error("LDAP username can't be used as a user ID", zap.String("username", identity.Username), zap.Error(err))
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	// The email is unique and required, the directory is trusted to have
+	// verified it.
+	email := datamodel.NormalizeEmail(identity.Email)
+	if email == "" {
+		logger.Error("LDAP user has no email", zap.String("username", identity.Username))
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	if _, err := s.repository.GetUser(ctx, id, false); err == nil {
+		logger.Warn("LDAP username is already used by a local user", zap.String("userID", id))
+		return nil, fmt.Errorf("%w: the username is already used by another user", errorsx.ErrAlreadyExists)
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+	if _, err := s.repository.GetUserByEmail(ctx, email); err == nil {
+		logger.Warn("LDAP email is already used by a local user", zap.String("userID", id))
+		return nil, fmt.Errorf("%w: the email is already used by another user", errorsx.ErrAlreadyExists)
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	user := &datamodel.Owner{
+		Base:          datamodel.Base{UID: uid},
+		ID:            id,
+		OwnerType:     sql.NullString{String: "user", Valid: true},
+		Email:         email,
+		EmailVerified: true,
+		DisplayName: sql.NullString{
+			String: identity.DisplayName,
+			Valid:  len(identity.DisplayName) > 0,
+		},
+		OnboardingStatus: datamodel.OnboardingStatusInProgress,
+	}
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
+	if err := s.repository.CreateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("provisioning LDAP user: %w", err)
+	}
+
+	identityUID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repository.CreateOwnerIdentity(ctx, &datamodel.OwnerIdentity{
+		Base:     datamodel.Base{UID: identityUID},
+		OwnerUID: uid,
+		Issuer:   ldap.Issuer,
+		Subject:  identity.ID,
+		Email:    sql.NullString{String: email, Valid: true},
+	}); err != nil {
+		// A user that can't be signed in to is removed, so the ID and email
+		// are free on the next attempt.
+		if err := s.repository.DeleteUser(ctx, id); err != nil {
+			logger.Error("Failed to remove LDAP user", zap.String("userUID", uid.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	logger.Info("LDAP user provisioned", zap.String("userUID", uid.String()), zap.String("userID", id))
+	return user, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/ldap"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// ldapRepository keeps the users, their directory entries and their local
+// passwords in memory.
+type ldapRepository struct {
+	repository.Repository
+
+	users          map[string]*datamodel.Owner
+	identities     []*datamodel.OwnerIdentity
+	passwordHashes map[uuid.UUID]string
+}
+
+func newLDAPRepository(users ...*datamodel.Owner) *ldapRepository {
+	r := &ldapRepository{users: map[string]*datamodel.Owner{}, passwordHashes: map[uuid.UUID]string{}}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *ldapRepository) GetUser(_ context.Context, id string, _ bool) (*datamodel.Owner, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *ldapRepository) GetUserByUID(_ context.Context, uid uuid.UUID) (*datamodel.Owner, error) {
+	for _, user := range r.users {
+		if user.UID == uid {
+			return user, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *ldapRepository) GetUserByEmail(_ context.Context, email string) (*datamodel.Owner, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *ldapRepository) CreateUser(_ context.Context, user *datamodel.Owner) error {
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *ldapRepository) GetOwnerIdentity(_ context.Context, issuer, subject string) (*datamodel.OwnerIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *ldapRepository) CreateOwnerIdentity(_ context.Context, identity *datamodel.OwnerIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *ldapRepository) GetUserPasswordHash(_ context.Context, uid uuid.UUID) (string, time.Time, error) {
+	return r.passwordHashes[uid], time.Time{}, nil
+}
+
+func (r *ldapRepository) GetTOTPFactor(context.Context, uuid.UUID) (*datamodel.TOTPFactor, error) {
+	return nil, errorsx.ErrNotFound
+}
+
+// directory accepts a single password for all its users.
+type directory struct {
+	password   string
+	identities map[string]*ldap.Identity
+	err        error
+}
+
+func (d *directory) Authenticate(_ context.Context, username, password string) (*ldap.Identity, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	identity, ok := d.identities[username]
+	if !ok || password != d.password {
+		return nil, ldap.ErrInvalidCredentials
+	}
+	return identity, nil
+}
+
+func TestLDAPAuthentication(t *testing.T) {
+	ctx := context.Background()
+
+	repo := newLDAPRepository(&datamodel.Owner{
+		Base:  datamodel.Base{UID: uuid.Must(uuid.NewV4())},
+		ID:    "john",
+		Email: "john@example.com",
+	})
+	dir := &directory{password: "secret", identities: map[string]*ldap.Identity{
+		"jane":  {ID: "uid=jane,dc=example,dc=com", Username: "Jane", Email: "Jane@Example.com ", DisplayName: "Jane Doe"},
+		"john":  {ID: "uid=john,dc=example,dc=com", Username: "john", Email: "john@corp.com"},
+		"jdoe":  {ID: "uid=jdoe,dc=example,dc=com", Username: "jdoe", Email: "john@example.com"},
+		"ghost": {ID: "uid=ghost,dc=example,dc=com", Username: "ghost"},
+	}}
+	s := &service{repository: repo, ldapAuthenticator: dir}
+
+	assert.Nil(t, s.authenticateWithLDAP(ctx, "jane", "wrong"))
+	assert.Nil(t, s.authenticateWithLDAP(ctx, "nobody", "secret"))
+
+	// The user is provisioned on their first login and linked to the entry.
+	identity := s.authenticateWithLDAP(ctx, "jane", "secret")
+	require.NotNil(t, identity)
+	user, err := s.getOrCreateLDAPUser(ctx, identity)
+	require.NoError(t, err)
+	assert.Equal(t, "jane", user.ID)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, "Jane Doe", user.DisplayName.String)
+	assert.Equal(t, "user", user.OwnerType.String)
+	require.Len(t, repo.identities, 1)
+	assert.Equal(t, ldap.Issuer, repo.identities[0].Issuer)
+	assert.Equal(t, "uid=jane,dc=example,dc=com", repo.identities[0].Subject)
+
+	// The link doesn't depend on the username.
+	again, err := s.getOrCreateLDAPUser(ctx, &ldap.Identity{ID: identity.ID, Username: "jane.doe"})
+	require.NoError(t, err)
+	assert.Equal(t, user.UID, again.UID)
+	assert.Len(t, repo.users, 2)
+
+	// The local users aren't taken over, by ID or by email.
+	_, err = s.getOrCreateLDAPUser(ctx, dir.identities["john"])
+	assert.True(t, errors.Is(err, errorsx.ErrAlreadyExists))
+	_, err = s.getOrCreateLDAPUser(ctx, dir.identities["jdoe"])
+	assert.True(t, errors.Is(err, errorsx.ErrAlreadyExists))
+	assert.Len(t, repo.users, 2)
+
+	// The users without an email can't be provisioned.
+	_, err = s.getOrCreateLDAPUser(ctx, dir.identities["ghost"])
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+
+	dir.err = errors.New("connection refused")
+	assert.Nil(t, s.authenticateWithLDAP(ctx, "jane", "secret"))
+
+	s.ldapAuthenticator = nil
+	assert.Nil(t, s.authenticateWithLDAP(ctx, "jane", "secret"))
+}
+
+func TestAuthenticateUser_LDAP(t *testing.T) {
+	original := config.Config.Server
+	t.Cleanup(func() { config.Config.Server = original })
+	config.Config.Server.Password.Algorithm = password.AlgorithmBcrypt
+	config.Config.Server.Password.Bcrypt.Cost = bcrypt.MinCost
+
+	ctx := context.Background()
+	johnUID := uuid.Must(uuid.NewV4())
+
+	hasher, err := password.NewHasher(config.Config.Server.Password)
+	require.NoError(t, err)
+	repo := newLDAPRepository(&datamodel.Owner{
+		Base:  datamodel.Base{UID: johnUID},
+		ID:    "john",
+		Email: "john@example.com",
+	})
+	repo.passwordHashes[johnUID], err = hasher.Hash("local-secret")
+	require.NoError(t, err)
+	dir := &directory{password: "secret", identities: map[string]*ldap.Identity{
+		"jane": {ID: "uid=jane,dc=example,dc=com", Username: "jane", Email: "jane@example.com"},
+		"john": {ID: "uid=john,dc=example,dc=com", Username: "john", Email: "john@corp.com"},
+	}}
+
+	// The lockout fails open without Redis.
+	redisClient, _ := redismock.NewClientMock()
+	s := &service{repository: repo, redisClient: redisClient, passwordHasher: hasher, ldapAuthenticator: dir}
+
+	// The directory isn't asked about the users with a local password.
+	_, err = s.AuthenticateUser(ctx, "john", "secret")
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+	uid, err := s.AuthenticateUser(ctx, "john", "local-secret")
+	require.NoError(t, err)
+	assert.Equal(t, johnUID, uid)
+
+	// The other users are provisioned by the directory and keep using it.
+	uid, err = s.AuthenticateUser(ctx, "jane", "secret")
+	require.NoError(t, err)
+	again, err := s.AuthenticateUser(ctx, "jane", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, uid, again)
+
+	_, err = s.AuthenticateUser(ctx, "jane", "wrong")
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+}
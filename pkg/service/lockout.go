@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// The password checks are throttled per account and per client IP. Each
+// failure delays the next attempt exponentially and, after too many of them,
+// the target is locked for a while. The failures on an account are counted per
+// client IP, so an attacker can neither slow down nor lock its owner out from
+// other addresses. The state lives in Redis so it's shared by all the
+// replicas.
+
+// loginTarget is an account or a client IP whose failed password checks are
+// counted. A target without a maximum number of attempts is never locked.
+type loginTarget struct {
+	key         string
+	maxAttempts int
+}
+
+func userLoginTargetKey(uid uuid.UUID) string {
+	return fmt.Sprintf("user:%s", uid)
+}
+
+// userLoginTargets returns the account seen from the client IP of the request
+// as a login target. The account itself is the target only if the gateway
+// didn't forward the IP.
+func userLoginTargets(ctx context.Context, uid uuid.UUID) []loginTarget {
+	key := userLoginTargetKey(uid)
+	if _, ipAddress := requestClient(ctx); ipAddress != "" {
+		key = fmt.Sprintf("%s:ip:%s", key, ipAddress)
+	}
+
+	return []loginTarget{{key: key, maxAttempts: config.Config.Server.Lockout.MaxAttempts}}
+}
+
+// ipLoginTargets returns the client IP of the request as a login target, if
+// the gateway forwarded it.
+func ipLoginTargets(ctx context.Context) []loginTarget {
+	_, ipAddress := requestClient(ctx)
+	if ipAddress == "" {
+		return nil
+	}
+
+	return []loginTarget{{
+		key:         fmt.Sprintf("ip:%s", ipAddress),
+		maxAttempts: config.Config.Server.Lockout.MaxIPAttempts,
+	}}
+}
+
+// checkLoginAllowed rejects the request if any of the targets is locked or
+// backing off. The check fails open, as a Redis outage shouldn't prevent every
+// user from logging in.
+func (s *service) checkLoginAllowed(ctx context.Context, targets []loginTarget) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, 2*len(targets))
+	for _, t := range targets {
+		keys = append(keys,
+			fmt.Sprintf("%s:%s", CacheTargetLoginLockout, t.key),
+			fmt.Sprintf("%s:%s", CacheTargetLoginBackoff, t.key),
+		)
+	}
+
+	getCmd := s.redisClient.MGet(ctx, keys...)
+	if getCmd.Err() != nil {
+		logger, _ := logx.GetZapLogger(ctx)
+		logger.Error("Failed to check login lockout", zap.Error(getCmd.Err()))
+		return nil
+	}
+
+	// Each entry holds the time until which the target is blocked.
+	var blockedUntil time.Time
+	for _, v := range getCmd.Val() {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if unixMilli, err := strconv.ParseInt(str, 10, 64); err == nil {
+			if t := time.UnixMilli(unixMilli); t.After(blockedUntil) {
+				blockedUntil = t
+			}
+		}
+	}
+
+	if wait := time.Until(blockedUntil); wait > 0 {
+		return fmt.Errorf("%w: too many failed attempts, retry in %s", errorsx.ErrRateLimiting, wait.Round(time.Second))
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed password check. The targets back off
+// exponentially and are locked once they reach their maximum number of
+// attempts.
+func (s *service) recordLoginFailure(ctx context.Context, targets []loginTarget) {
+	logger, _ := logx.GetZapLogger(ctx)
+	lockoutConfig := config.Config.Server.Lockout
+
+	for _, t := range targets {
+		failureKey := fmt.Sprintf("%s:%s", CacheTargetLoginFailure, t.key)
+
+		failures, err := s.redisClient.Incr(ctx, failureKey).Result()
+		if err == nil {
+			err = s.redisClient.Expire(ctx, failureKey, lockoutConfig.Window).Err()
+		}
+		if err != nil {
+			logger.Error("Failed to record login failure", zap.String("target", t.key), zap.Error(err))
+			continue
+		}
+
+		if t.maxAttempts > 0 && failures >= int64(t.maxAttempts) {
+			lockoutKey := fmt.Sprintf("%s:%s", CacheTargetLoginLockout, t.key)
+			until := time.Now().Add(lockoutConfig.Duration)
+			if err := s.redisClient.Set(ctx, lockoutKey, until.UnixMilli(), lockoutConfig.Duration).Err(); err != nil {
+				logger.Error("Failed to lock login target", zap.String("target", t.key), zap.Error(err))
+				continue
+			}
+			_ = s.redisClient.Del(ctx, failureKey).Err()
+
+			logger.Warn("Login locked out after too many failed attempts",
+				zap.String("target", t.key),
+				zap.Int64("failures", failures),
+				zap.Time("lockedUntil", until),
+			)
+			continue
+		}
+
+		backoff := lockoutConfig.BackoffBase << (failures - 1)
+		if backoff <= 0 || backoff > lockoutConfig.BackoffMax {
+			backoff = lockoutConfig.BackoffMax
+		}
+		if backoff <= 0 {
+			continue
+		}
+		backoffKey := fmt.Sprintf("%s:%s", CacheTargetLoginBackoff, t.key)
+		if err := s.redisClient.Set(ctx, backoffKey, time.Now().Add(backoff).UnixMilli(), backoff).Err(); err != nil {
+			logger.Error("Failed to set login back-off", zap.String("target", t.key), zap.Error(err))
+		}
+	}
+}
+
+// resetLoginFailures forgets the failures of the targets after a successful
+// password check.
+func (s *service) resetLoginFailures(ctx context.Context, targets []loginTarget) {
+	keys := make([]string, 0, 2*len(targets))
+	for _, t := range targets {
+		keys = append(keys,
+			fmt.Sprintf("%s:%s", CacheTargetLoginFailure, t.key),
+			fmt.Sprintf("%s:%s", CacheTargetLoginBackoff, t.key),
+		)
+	}
+	_ = s.redisClient.Del(ctx, keys...).Err()
+}
+
+// UnlockUserAdmin lifts the lockouts and the back-off of an account, from
+// every client IP.
+func (s *service) UnlockUserAdmin(ctx context.Context, uid uuid.UUID) error {
+	key := userLoginTargetKey(uid)
+
+	keys := []string{}
+	for _, target := range []string{CacheTargetLoginFailure, CacheTargetLoginBackoff, CacheTargetLoginLockout} {
+		keys = append(keys, fmt.Sprintf("%s:%s", target, key))
+
+		iter := s.redisClient.Scan(ctx, 0, fmt.Sprintf("%s:%s:ip:*", target, key), 100).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.redisClient.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("Login lockout lifted by an admin", zap.String("target", key))
+	return nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/instill-ai/mgmt-backend/config"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+func setupLockoutConfig(t *testing.T) {
+	t.Helper()
+
+	original := config.Config.Server.Lockout
+	t.Cleanup(func() { config.Config.Server.Lockout = original })
+
+	config.Config.Server.Lockout.MaxAttempts = 3
+	config.Config.Server.Lockout.MaxIPAttempts = 10
+	config.Config.Server.Lockout.Window = 15 * time.Minute
+	config.Config.Server.Lockout.Duration = 15 * time.Minute
+	config.Config.Server.Lockout.BackoffBase = time.Second
+	config.Config.Server.Lockout.BackoffMax = 30 * time.Second
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	setupLockoutConfig(t)
+	ctx := context.Background()
+
+	uid := uuid.Must(uuid.NewV4())
+	targets := userLoginTargets(ctx, uid)
+	failureKey := fmt.Sprintf("%s:user:%s", CacheTargetLoginFailure, uid)
+	backoffKey := fmt.Sprintf("%s:user:%s", CacheTargetLoginBackoff, uid)
+	lockoutKey := fmt.Sprintf("%s:user:%s", CacheTargetLoginLockout, uid)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient}
+
+	// The back-off doubles on each failure.
+	for i, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		redisMock.ExpectIncr(failureKey).SetVal(int64(i + 1))
+		redisMock.ExpectExpire(failureKey, 15*time.Minute).SetVal(true)
+		redisMock.Regexp().ExpectSet(backoffKey, `\d+`, backoff).SetVal("OK")
+		s.recordLoginFailure(ctx, targets)
+	}
+
+	// The last allowed failure locks the account.
+	redisMock.ExpectIncr(failureKey).SetVal(3)
+	redisMock.ExpectExpire(failureKey, 15*time.Minute).SetVal(true)
+	redisMock.Regexp().ExpectSet(lockoutKey, `\d+`, 15*time.Minute).SetVal("OK")
+	redisMock.ExpectDel(failureKey).SetVal(1)
+	s.recordLoginFailure(ctx, targets)
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestRecordLoginFailure_ClientIP(t *testing.T) {
+	setupLockoutConfig(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+
+	uid := uuid.Must(uuid.NewV4())
+	targets := userLoginTargets(ctx, uid)
+	require.Len(t, targets, 1)
+
+	clientKey := fmt.Sprintf("user:%s:ip:203.0.113.7", uid)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient}
+
+	// Only the client that failed is locked out of the account.
+	redisMock.ExpectIncr(CacheTargetLoginFailure + ":" + clientKey).SetVal(3)
+	redisMock.ExpectExpire(CacheTargetLoginFailure+":"+clientKey, 15*time.Minute).SetVal(true)
+	redisMock.Regexp().ExpectSet(CacheTargetLoginLockout+":"+clientKey, `\d+`, 15*time.Minute).SetVal("OK")
+	redisMock.ExpectDel(CacheTargetLoginFailure + ":" + clientKey).SetVal(1)
+	s.recordLoginFailure(ctx, targets)
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestCheckLoginAllowed_OtherClientIP(t *testing.T) {
+	setupLockoutConfig(t)
+	uid := uuid.Must(uuid.NewV4())
+	ctxA := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+	ctxB := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-forwarded-for", "198.51.100.4"))
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient}
+
+	// The failures from A back A off...
+	keyA := fmt.Sprintf("user:%s:ip:203.0.113.7", uid)
+	redisMock.ExpectIncr(CacheTargetLoginFailure + ":" + keyA).SetVal(1)
+	redisMock.ExpectExpire(CacheTargetLoginFailure+":"+keyA, 15*time.Minute).SetVal(true)
+	redisMock.Regexp().ExpectSet(CacheTargetLoginBackoff+":"+keyA, `\d+`, time.Second).SetVal("OK")
+	s.recordLoginFailure(ctxA, userLoginTargets(ctxA, uid))
+
+	// ...but B doesn't look them up.
+	keyB := fmt.Sprintf("user:%s:ip:198.51.100.4", uid)
+	redisMock.ExpectMGet(CacheTargetLoginLockout+":"+keyB, CacheTargetLoginBackoff+":"+keyB).SetVal([]any{nil, nil})
+	assert.NoError(t, s.checkLoginAllowed(ctxB, userLoginTargets(ctxB, uid)))
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestCheckLoginAllowed(t *testing.T) {
+	setupLockoutConfig(t)
+	ctx := context.Background()
+
+	uid := uuid.Must(uuid.NewV4())
+	target := userLoginTargets(context.Background(), uid)[0]
+	keys := []string{
+		fmt.Sprintf("%s:user:%s", CacheTargetLoginLockout, uid),
+		fmt.Sprintf("%s:user:%s", CacheTargetLoginBackoff, uid),
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		redisClient, redisMock := redismock.NewClientMock()
+		s := &service{redisClient: redisClient}
+
+		redisMock.ExpectMGet(keys...).SetVal([]any{nil, nil})
+		assert.NoError(t, s.checkLoginAllowed(ctx, []loginTarget{target}))
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		redisClient, redisMock := redismock.NewClientMock()
+		s := &service{redisClient: redisClient}
+
+		until := strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)
+		redisMock.ExpectMGet(keys...).SetVal([]any{until, nil})
+
+		err := s.checkLoginAllowed(ctx, []loginTarget{target})
+		assert.ErrorIs(t, err, errorsx.ErrRateLimiting)
+		require.NoError(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("fails open", func(t *testing.T) {
+		redisClient, redisMock := redismock.NewClientMock()
+		s := &service{redisClient: redisClient}
+
+		redisMock.ExpectMGet(keys...).SetErr(fmt.Errorf("connection refused"))
+		assert.NoError(t, s.checkLoginAllowed(ctx, []loginTarget{target}))
+	})
+}
+
+func TestUnlockUserAdmin(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient}
+
+	clientLockoutKey := fmt.Sprintf("%s:user:%s:ip:203.0.113.7", CacheTargetLoginLockout, uid)
+	redisMock.ExpectScan(0, fmt.Sprintf("%s:user:%s:ip:*", CacheTargetLoginFailure, uid), 100).SetVal(nil, 0)
+	redisMock.ExpectScan(0, fmt.Sprintf("%s:user:%s:ip:*", CacheTargetLoginBackoff, uid), 100).SetVal(nil, 0)
+	redisMock.ExpectScan(0, fmt.Sprintf("%s:user:%s:ip:*", CacheTargetLoginLockout, uid), 100).SetVal([]string{clientLockoutKey}, 0)
+	redisMock.ExpectDel(
+		fmt.Sprintf("%s:user:%s", CacheTargetLoginFailure, uid),
+		fmt.Sprintf("%s:user:%s", CacheTargetLoginBackoff, uid),
+		fmt.Sprintf("%s:user:%s", CacheTargetLoginLockout, uid),
+		clientLockoutKey,
+	).SetVal(2)
+
+	require.NoError(t, s.UnlockUserAdmin(ctx, uid))
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// recoveryCodeLength is the number of random bytes in a recovery code. The 80
+// bits can't be guessed offline from the stored hashes.
+const recoveryCodeLength = 10
+
+// totpCodeTTL covers the validity of a TOTP code, including the time steps
+// accepted for clock skew. A code can't be used twice in this period.
+const totpCodeTTL = 90 * time.Second
+
+// ErrMFARequired is returned when the password of a user who enrolled a second
+// factor is right but no code was given, so the client can prompt for one.
+var ErrMFARequired = fmt.Errorf("%w: MFA code required", errorsx.ErrUnauthenticated)
+
+// ErrMFABasicAuth is returned when a user who enrolled a second factor uses
+// Basic Auth, which can't carry a code.
+var ErrMFABasicAuth = fmt.Errorf("%w: the users with MFA must log in or use an API token", errorsx.ErrUnauthenticated)
+
+// MFAEnrollment holds what a user needs to register a TOTP factor in an
+// authenticator app.
+type MFAEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// EnrollMFA creates a pending TOTP factor for a user. The factor is enabled
+// once a first code is verified with VerifyMFA.
+func (s *service) EnrollMFA(ctx context.Context, userUID uuid.UUID) (*MFAEnrollment, error) {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	factor, err := s.repository.GetTOTPFactor(ctx, userUID)
+	if err != nil && !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && factor.EnableTime.Valid {
+		return nil, fmt.Errorf("%w: MFA is already enabled", errorsx.ErrAlreadyExists)
+	}
+
+	user, err := s.repository.GetUserByUID(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      config.Config.Server.MFA.Issuer,
+		AccountName: user.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generating TOTP secret: %w", err)
+	}
+
+	secret, err := s.secretCipher.Encrypt([]byte(key.Secret()))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting TOTP secret: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repository.CreateTOTPFactor(ctx, &datamodel.TOTPFactor{
+		Base:     datamodel.Base{UID: uid},
+		OwnerUID: userUID,
+		Secret:   secret,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{Secret: key.Secret(), ProvisioningURI: key.URL()}, nil
+}
+
+// VerifyMFA checks a code of the pending TOTP factor of a user and enables
+// it. The recovery codes are returned, this is the only time they can be
+// read.
+func (s *service) VerifyMFA(ctx context.Context, userUID uuid.UUID, code string) ([]string, error) {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	factor, err := s.repository.GetTOTPFactor(ctx, userUID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil, fmt.Errorf("%w: no MFA enrollment in progress", errorsx.ErrInvalidArgument)
+		}
+		return nil, err
+	}
+	if factor.EnableTime.Valid {
+		return nil, fmt.Errorf("%w: MFA is already enabled", errorsx.ErrAlreadyExists)
+	}
+	valid, err := s.validateTOTPCode(ctx, userUID, factor, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: invalid MFA code", errorsx.ErrInvalidArgument)
+	}
+
+	codes, dbCodes, err := newRecoveryCodes(userUID, config.Config.Server.MFA.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repository.EnableTOTPFactor(ctx, userUID, dbCodes); err != nil {
+		// The factor was enabled concurrently.
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return nil, fmt.Errorf("%w: MFA is already enabled", errorsx.ErrAlreadyExists)
+		}
+		return nil, err
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("MFA enabled", zap.String("userUID", userUID.String()))
+
+	return codes, nil
+}
+
+// DisableMFA removes the TOTP factor of a user, who must prove they still
+// hold it with a code or a recovery code.
+func (s *service) DisableMFA(ctx context.Context, userUID uuid.UUID, code string) error {
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, userUID)
+
+	factor, err := s.repository.GetTOTPFactor(ctx, userUID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return fmt.Errorf("%w: MFA isn't enabled", errorsx.ErrInvalidArgument)
+		}
+		return err
+	}
+
+	if factor.EnableTime.Valid {
+		if err := s.checkSecondFactor(ctx, userUID, factor, code); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repository.DeleteTOTPFactor(ctx, userUID); err != nil {
+		return err
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("MFA disabled", zap.String("userUID", userUID.String()))
+
+	return nil
+}
+
+// enabledTOTPFactor returns the TOTP factor of a user, or nil if the user
+// didn't enable one.
+func (s *service) enabledTOTPFactor(ctx context.Context, userUID uuid.UUID) (*datamodel.TOTPFactor, error) {
+	factor, err := s.repository.GetTOTPFactor(ctx, userUID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !factor.EnableTime.Valid {
+		return nil, nil
+	}
+	return factor, nil
+}
+
+// verifySecondFactor checks the second factor of a user who passed the
+// password check on an interactive login. Users without an enabled factor
+// don't need any.
+func (s *service) verifySecondFactor(ctx context.Context, userUID uuid.UUID, code string) error {
+	factor, err := s.enabledTOTPFactor(ctx, userUID)
+	if err != nil || factor == nil {
+		return err
+	}
+
+	return s.checkSecondFactor(ctx, userUID, factor, code)
+}
+
+// refuseSecondFactorUsers refuses the users who enabled a second factor. The
+// codes are single-use, so they can't authenticate each request of a client.
+func (s *service) refuseSecondFactorUsers(ctx context.Context, userUID uuid.UUID) error {
+	factor, err := s.enabledTOTPFactor(ctx, userUID)
+	if err != nil {
+		return err
+	}
+	if factor != nil {
+		return ErrMFABasicAuth
+	}
+	return nil
+}
+
+// checkSecondFactor accepts a code of the TOTP factor or an unused recovery
+// code, which is then consumed.
+func (s *service) checkSecondFactor(ctx context.Context, userUID uuid.UUID, factor *datamodel.TOTPFactor, code string) error {
+	if code == "" {
+		return ErrMFARequired
+	}
+	valid, err := s.validateTOTPCode(ctx, userUID, factor, code)
+	if err != nil {
+		return err
+	}
+	if valid {
+		return nil
+	}
+
+	err = s.repository.UseRecoveryCode(ctx, userUID, hashRecoveryCode(code))
+	if err == nil {
+		logger, _ := logx.GetZapLogger(ctx)
+		logger.Info("MFA recovery code used", zap.String("userUID", userUID.String()))
+		return nil
+	}
+	if errors.Is(err, errorsx.ErrNoDataUpdated) {
+		return errorsx.ErrUnauthenticated
+	}
+	return err
+}
+
+// totpSecret returns the secret of a TOTP factor. The secrets stored before
+// they were encrypted are read as is.
+func (s *service) totpSecret(factor *datamodel.TOTPFactor) (string, error) {
+	if !encryption.IsEncrypted(factor.Secret) {
+		return factor.Secret, nil
+	}
+	secret, err := s.secretCipher.Decrypt(factor.Secret)
+	if err != nil {
+		return "", fmt.Errorf("decrypting TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// validateTOTPCode checks a TOTP code and prevents it from being replayed.
+// The replay check fails open, as the password was already verified.
+func (s *service) validateTOTPCode(ctx context.Context, userUID uuid.UUID, factor *datamodel.TOTPFactor, code string) (bool, error) {
+	secret, err := s.totpSecret(factor)
+	if err != nil {
+		return false, err
+	}
+	if !totp.Validate(code, secret) {
+		return false, nil
+	}
+
+	used, err := s.redisClient.SetNX(ctx, fmt.Sprintf("%s:%s:%s", CacheTargetUsedTOTPCode, userUID, code), 1, totpCodeTTL).Result()
+	if err != nil {
+		logger, _ := logx.GetZapLogger(ctx)
+		logger.Error("Failed to check TOTP code replay", zap.Error(err))
+		return true, nil
+	}
+	return used, nil
+}
+
+// newRecoveryCodes generates the recovery codes of a user, formatted for
+// display as `xxxx-xxxx-xxxx-xxxx`.
+func newRecoveryCodes(userUID uuid.UUID, n int) ([]string, []*datamodel.RecoveryCode, error) {
+	codes := make([]string, 0, n)
+	dbCodes := make([]*datamodel.RecoveryCode, 0, n)
+
+	for range n {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		groups := make([]string, 0, len(encoded)/4)
+		for i := 0; i < len(encoded); i += 4 {
+			groups = append(groups, encoded[i:i+4])
+		}
+		code := strings.Join(groups, "-")
+
+		uid, err := uuid.NewV4()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes = append(codes, code)
+		dbCodes = append(dbCodes, &datamodel.RecoveryCode{
+			Base:     datamodel.Base{UID: uid},
+			OwnerUID: userUID,
+			CodeHash: hashRecoveryCode(code),
+		})
+	}
+
+	return codes, dbCodes, nil
+}
+
+// hashRecoveryCode returns the hash a recovery code is stored with. The codes
+// are normalized first, as users may type them differently.
+func hashRecoveryCode(code string) string {
+	return hashSecret(strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code)))
+}
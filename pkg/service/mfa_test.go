@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// mfaRepository keeps the MFA factor of a single user in memory.
+type mfaRepository struct {
+	repository.Repository
+
+	factor        *datamodel.TOTPFactor
+	recoveryCodes []*datamodel.RecoveryCode
+}
+
+func (r *mfaRepository) GetUserByUID(_ context.Context, uid uuid.UUID) (*datamodel.Owner, error) {
+	return &datamodel.Owner{Base: datamodel.Base{UID: uid}, ID: "admin"}, nil
+}
+
+func (r *mfaRepository) GetTOTPFactor(context.Context, uuid.UUID) (*datamodel.TOTPFactor, error) {
+	if r.factor == nil {
+		return nil, errorsx.ErrNotFound
+	}
+	return r.factor, nil
+}
+
+func (r *mfaRepository) CreateTOTPFactor(_ context.Context, factor *datamodel.TOTPFactor) error {
+	r.factor = factor
+	return nil
+}
+
+func (r *mfaRepository) EnableTOTPFactor(_ context.Context, _ uuid.UUID, recoveryCodes []*datamodel.RecoveryCode) error {
+	r.factor.EnableTime = sql.NullTime{Time: time.Now(), Valid: true}
+	r.recoveryCodes = recoveryCodes
+	return nil
+}
+
+func (r *mfaRepository) UseRecoveryCode(_ context.Context, _ uuid.UUID, codeHash string) error {
+	for _, code := range r.recoveryCodes {
+		if code.CodeHash == codeHash && !code.UseTime.Valid {
+			code.UseTime = sql.NullTime{Time: time.Now(), Valid: true}
+			return nil
+		}
+	}
+	return errorsx.ErrNoDataUpdated
+}
+
+func testSecretCipher(t *testing.T) encryption.Cipher {
+	t.Helper()
+
+	c, err := encryption.NewCipher("test-encryption-key")
+	require.NoError(t, err)
+	return c
+}
+
+func TestMFA(t *testing.T) {
+	original := config.Config.Server.MFA
+	t.Cleanup(func() { config.Config.Server.MFA = original })
+	config.Config.Server.MFA.Issuer = "Instill AI"
+	config.Config.Server.MFA.RecoveryCodes = 3
+
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	repo := &mfaRepository{}
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{repository: repo, redisClient: redisClient, secretCipher: testSecretCipher(t)}
+
+	// Users without an enabled factor don't need a second one.
+	require.NoError(t, s.verifySecondFactor(ctx, uid, ""))
+	require.NoError(t, s.refuseSecondFactorUsers(ctx, uid))
+
+	enrollment, err := s.EnrollMFA(ctx, uid)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/Instill%20AI:admin")
+	assert.True(t, encryption.IsEncrypted(repo.factor.Secret), "the secret is encrypted at rest")
+	require.NoError(t, s.verifySecondFactor(ctx, uid, ""), "the factor is pending")
+
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	usedCodeKey := fmt.Sprintf("%s:%s:%s", CacheTargetUsedTOTPCode, uid, code)
+
+	redisMock.ExpectSetNX(usedCodeKey, 1, totpCodeTTL).SetVal(true)
+	recoveryCodes, err := s.VerifyMFA(ctx, uid, code)
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, 3)
+	assert.Regexp(t, `^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`, recoveryCodes[0])
+
+	_, err = s.EnrollMFA(ctx, uid)
+	assert.True(t, errors.Is(err, errorsx.ErrAlreadyExists))
+
+	// Once enabled, the second factor is required and a code can't be
+	// replayed. Basic Auth can't carry one.
+	assert.True(t, errors.Is(s.verifySecondFactor(ctx, uid, ""), ErrMFARequired))
+	assert.True(t, errors.Is(s.refuseSecondFactorUsers(ctx, uid), ErrMFABasicAuth))
+
+	redisMock.ExpectSetNX(usedCodeKey, 1, totpCodeTTL).SetVal(false)
+	assert.True(t, errors.Is(s.verifySecondFactor(ctx, uid, code), errorsx.ErrUnauthenticated))
+
+	// A recovery code can be used once, however it's typed.
+	assert.NoError(t, s.verifySecondFactor(ctx, uid, " "+recoveryCodes[0][:4]+recoveryCodes[0][5:]))
+	assert.True(t, errors.Is(s.verifySecondFactor(ctx, uid, recoveryCodes[0]), errorsx.ErrUnauthenticated))
+	assert.NoError(t, s.verifySecondFactor(ctx, uid, recoveryCodes[1]))
+
+	// The secrets stored before they were encrypted are still read.
+	repo.factor.Secret = enrollment.Secret
+	code, err = totp.GenerateCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+	require.NoError(t, err)
+	redisMock.ExpectSetNX(fmt.Sprintf("%s:%s:%s", CacheTargetUsedTOTPCode, uid, code), 1, totpCodeTTL).SetVal(true)
+	assert.NoError(t, s.verifySecondFactor(ctx, uid, code))
+
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/oidc"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// oidcLoginTTL is how long a user has to sign in at the OIDC provider.
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcStateLength is the number of random bytes in the state and the nonce of
+// an OIDC login.
+const oidcStateLength = 32
+
+// ErrOIDCDisabled is returned by the OIDC login endpoints when no provider is
+// configured.
+var ErrOIDCDisabled = status.Error(codes.Unimplemented, "OIDC login is not enabled")
+
+// oidcLogin is kept between the authorization request and the callback of a
+// login through the OIDC provider, under its state.
+type oidcLogin struct {
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	BindingHash string `json:"bindingHash"`
+}
+
+// AuthOIDCAuthorize starts a login through the OIDC provider. It returns the
+// URL of the provider the user is sent to, which redirects them to the console
+// with an authorization code and the state of the login, along with the
+// binding the browser must present to complete the login. The binding stays
+// in the browser, so a victim can't be signed in to the account of an
+// attacker who sends them their own callback.
+func (s *service) AuthOIDCAuthorize(ctx context.Context) (authorizationURL, binding string, err error) {
+	if s.oidcProvider == nil {
+		return "", "", ErrOIDCDisabled
+	}
+
+	state, err := newOIDCLoginSecret()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newOIDCLoginSecret()
+	if err != nil {
+		return "", "", err
+	}
+	binding, bindingHash, err := newSecret()
+	if err != nil {
+		return "", "", err
+	}
+	login := oidcLogin{Nonce: nonce, Verifier: oauth2.GenerateVerifier(), BindingHash: bindingHash}
+
+	b, err := json.Marshal(login)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.redisClient.Set(ctx, fmt.Sprintf("%s:%s", CacheTargetOIDCLogin, state), b, oidcLoginTTL).Err(); err != nil {
+		return "", "", err
+	}
+
+	authorizationURL, err = s.oidcProvider.AuthCodeURL(ctx, state, login.Nonce, login.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+	return authorizationURL, binding, nil
+}
+
+// AuthOIDCLogin completes a login through the OIDC provider, from the browser
+// that started it. The authorization code is exchanged for the identity of the
+// user, who is provisioned on their first login, and a login session is
+// started.
+func (s *service) AuthOIDCLogin(ctx context.Context, code, state, binding string) (*AuthTokens, error) {
+	if s.oidcProvider == nil {
+		return nil, ErrOIDCDisabled
+	}
+	logger, _ := logx.GetZapLogger(ctx)
+
+	// The state can only be used once.
+	b, err := s.redisClient.GetDel(ctx, fmt.Sprintf("%s:%s", CacheTargetOIDCLogin, state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: invalid or expired login state", errorsx.ErrUnauthenticated)
+		}
+		return nil, err
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(b, &login); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(binding)), []byte(login.BindingHash)) != 1 {
+		logger.Warn("OIDC login from another browser")
+		return nil, fmt.Errorf("%w: the login was started by another browser", errorsx.ErrUnauthenticated)
+	}
+
+	claims, err := s.oidcProvider.Exchange(ctx, code, login.Nonce, login.Verifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			logger.Warn("OIDC login failed", zap.Error(err))
+			return nil, errorsx.ErrUnauthenticated
+		}
+		return nil, err
+	}
+
+	user, err := s.getOrCreateOIDCUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user.UID)
+}
+
+// getOrCreateOIDCUser returns the user linked to the identity in the claims of
+// an ID token. On the first login, the identity is linked to the local user
+// with the same email if the configuration allows it, or to a user
+// provisioned just in time.
+func (s *service) getOrCreateOIDCUser(ctx context.Context, claims *oidc.Claims) (*datamodel.Owner, error) {
+	logger, _ := logx.GetZapLogger(ctx)
+	issuer := s.oidcProvider.Issuer()
+
+	identity, err := s.repository.GetOwnerIdentity(ctx, issuer, claims.Subject)
+	if err == nil {
+		return s.repository.GetUserByUID(ctx, identity.OwnerUID)
+	}
+	if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+
+	email := datamodel.NormalizeEmail(claims.Email)
+	if email == "" {
+		logger.Warn("OIDC identity has no email", zap.String("subject", claims.Subject))
+		return nil, fmt.Errorf("%w: the identity provider didn't share an email", errorsx.ErrUnauthenticated)
+	}
+
+	created := false
+	user, err := s.repository.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		// Both sides must have verified the email, otherwise anyone could
+		// take over a local user by registering their email at the provider.
+		if !config.Config.OIDC.LinkVerifiedEmail || !claims.EmailVerified || !user.EmailVerified {
+			return nil, fmt.Errorf("%w: the email is already used by another user", errorsx.ErrAlreadyExists)
+		}
+	case errors.Is(err, errorsx.ErrNotFound):
+		uid, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.CreateAuthenticatedUser(ctx, uid, &mgmtpb.AuthenticatedUser{
+			Email:            email,
+			Profile:          &mgmtpb.UserProfile{DisplayName: claims.Name},
+			OnboardingStatus: mgmtpb.OnboardingStatus_ONBOARDING_STATUS_IN_PROGRESS,
+		}); err != nil {
+			return nil, err
+		}
+		if user, err = s.repository.GetUserByUID(ctx, uid); err != nil {
+			return nil, err
+		}
+		created = true
+	default:
+		return nil, err
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, user.UID)
+	if err := s.repository.CreateOwnerIdentity(ctx, &datamodel.OwnerIdentity{
+		Base:     datamodel.Base{UID: uid},
+		OwnerUID: user.UID,
+		Issuer:   issuer,
+		Subject:  claims.Subject,
+		Email:    sql.NullString{String: email, Valid: true},
+	}); err != nil {
+		// A user that can't be signed in to is removed, so the email is
+		// free on the next attempt.
+		if created {
+			if err := s.repository.DeleteUser(ctx, user.ID); err != nil {
+				logger.Error("Failed to remove OIDC user", zap.String("userUID", user.UID.String()), zap.Error(err))
+			}
+		}
+		return nil, err
+	}
+
+	logger.Info("OIDC identity linked", zap.String("userUID", user.UID.String()), zap.Bool("provisioned", created))
+	return user, nil
+}
+
+// newOIDCLoginSecret generates the state or the nonce of an OIDC login.
+func newOIDCLoginSecret() (string, error) {
+	b := make([]byte, oidcStateLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating OIDC login secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/oidc"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// oidcRepository keeps the users and their external identities in memory.
+type oidcRepository struct {
+	repository.Repository
+
+	users      map[uuid.UUID]*datamodel.Owner
+	identities []*datamodel.OwnerIdentity
+}
+
+func (r *oidcRepository) GetUserByUID(_ context.Context, uid uuid.UUID) (*datamodel.Owner, error) {
+	if user, ok := r.users[uid]; ok {
+		return user, nil
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *oidcRepository) GetUserByEmail(_ context.Context, email string) (*datamodel.Owner, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *oidcRepository) CreateUser(_ context.Context, user *datamodel.Owner) error {
+	r.users[user.UID] = user
+	return nil
+}
+
+func (r *oidcRepository) GetOwnerIdentity(_ context.Context, issuer, subject string) (*datamodel.OwnerIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *oidcRepository) CreateOwnerIdentity(_ context.Context, identity *datamodel.OwnerIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+// identityProvider is an OIDC provider only known by its issuer.
+type identityProvider struct {
+	oidc.Provider
+}
+
+func (identityProvider) Issuer() string {
+	return "https://idp.example.com"
+}
+
+func TestGetOrCreateOIDCUser(t *testing.T) {
+	original := config.Config.OIDC
+	t.Cleanup(func() { config.Config.OIDC = original })
+
+	ctx := context.Background()
+	localUID := uuid.Must(uuid.NewV4())
+	repo := &oidcRepository{users: map[uuid.UUID]*datamodel.Owner{
+		localUID: {
+			Base:          datamodel.Base{UID: localUID},
+			ID:            "admin",
+			OwnerType:     sql.NullString{String: "user", Valid: true},
+			Email:         "admin@example.com",
+			EmailVerified: true,
+		},
+	}}
+	s := &service{repository: repo, oidcProvider: identityProvider{}}
+
+	// The user is provisioned on their first login.
+	jane := &oidc.Claims{Subject: "jane-sub", Email: "Jane@Example.com", EmailVerified: true, Name: "Jane Doe"}
+	user, err := s.getOrCreateOIDCUser(ctx, jane)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.Equal(t, "Jane Doe", user.DisplayName.String)
+	assert.Equal(t, newUserID(user.UID), user.ID)
+	require.Len(t, repo.identities, 1)
+	assert.Equal(t, user.UID, repo.identities[0].OwnerUID)
+	assert.Equal(t, "https://idp.example.com", repo.identities[0].Issuer)
+
+	again, err := s.getOrCreateOIDCUser(ctx, jane)
+	require.NoError(t, err)
+	assert.Equal(t, user.UID, again.UID)
+	assert.Len(t, repo.users, 2)
+
+	// A local user is only linked when both sides verified the email and the
+	// configuration allows it.
+	admin := &oidc.Claims{Subject: "admin-sub", Email: "admin@example.com", EmailVerified: true}
+	_, err = s.getOrCreateOIDCUser(ctx, admin)
+	assert.True(t, errors.Is(err, errorsx.ErrAlreadyExists))
+
+	config.Config.OIDC.LinkVerifiedEmail = true
+	admin.EmailVerified = false
+	_, err = s.getOrCreateOIDCUser(ctx, admin)
+	assert.True(t, errors.Is(err, errorsx.ErrAlreadyExists))
+
+	admin.EmailVerified = true
+	user, err = s.getOrCreateOIDCUser(ctx, admin)
+	require.NoError(t, err)
+	assert.Equal(t, localUID, user.UID)
+	assert.Len(t, repo.identities, 2)
+
+	_, err = s.getOrCreateOIDCUser(ctx, &oidc.Claims{Subject: "anonymous"})
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+}
+
+func TestAuthOIDCLogin_State(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := (&service{}).AuthOIDCLogin(ctx, "code", "state", "binding")
+	assert.ErrorIs(t, err, ErrOIDCDisabled)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient, oidcProvider: identityProvider{}}
+
+	redisMock.ExpectGetDel(fmt.Sprintf("%s:%s", CacheTargetOIDCLogin, "unknown")).RedisNil()
+	_, err = s.AuthOIDCLogin(ctx, "code", "unknown", "binding")
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+// loginProvider is an OIDC provider that refuses the authorization codes and
+// records the ones it was given.
+type loginProvider struct {
+	identityProvider
+	codes *[]string
+}
+
+func (loginProvider) AuthCodeURL(_ context.Context, state, _, _ string) (string, error) {
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p loginProvider) Exchange(_ context.Context, code, _, _ string) (*oidc.Claims, error) {
+	*p.codes = append(*p.codes, code)
+	return nil, oidc.ErrInvalidToken
+}
+
+func TestAuthOIDCLogin_Binding(t *testing.T) {
+	ctx := context.Background()
+
+	codes := []string{}
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{redisClient: redisClient, oidcProvider: loginProvider{codes: &codes}}
+
+	var key string
+	var login any
+	redisMock.CustomMatch(func(_, actual []any) error {
+		key, login = actual[1].(string), actual[2]
+		return nil
+	}).ExpectSet("", nil, oidcLoginTTL).SetVal("OK")
+	authorizationURL, binding, err := s.AuthOIDCAuthorize(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, binding)
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	state := u.Query().Get("state")
+	assert.Equal(t, fmt.Sprintf("%s:%s", CacheTargetOIDCLogin, state), key)
+
+	// Another browser can't complete the login, the state is used up anyway.
+	redisMock.ExpectGetDel(key).SetVal(string(login.([]byte)))
+	_, err = s.AuthOIDCLogin(ctx, "code", state, "another-binding")
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+	assert.Empty(t, codes)
+
+	redisMock.ExpectGetDel(key).SetVal(string(login.([]byte)))
+	_, err = s.AuthOIDCLogin(ctx, "code", state, binding)
+	assert.True(t, errors.Is(err, errorsx.ErrUnauthenticated))
+	assert.Equal(t, []string{"code"}, codes)
+
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/mail"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// passwordResetRequestInterval is the minimum time between two reset emails
+// sent to the same user.
+const passwordResetRequestInterval = time.Minute
+
+// ErrInvalidPasswordResetToken is returned when a password reset token
+// doesn't exist, expired or was already used.
+var ErrInvalidPasswordResetToken = fmt.Errorf("%w: invalid or expired password reset token", errorsx.ErrInvalidArgument)
+
+const passwordResetMailBody = `Hi %s,
+
+Someone asked to reset the password of your account. If it was you, follow
+this link to choose a new password:
+
+%s
+
+The link expires in %s and can only be used once. If you didn't ask for it,
+you can ignore this email.
+`
+
+// RequestPasswordReset sends a password reset link to the user with the given
+// email. Only verified addresses receive a link. Whether the user exists isn't
+// disclosed, so an unknown address doesn't return an error.
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	user, err := s.repository.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			logger.Info("Password reset requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+	if !user.EmailVerified {
+		logger.Info("Password reset requested for an unverified email", zap.String("userUID", user.UID.String()))
+		return nil
+	}
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, user.UID)
+
+	// A link is sent at most once per interval, so the endpoint can't be
+	// used to flood the mailbox of a user. The check fails open.
+	sent, err := s.redisClient.SetNX(ctx, fmt.Sprintf("%s:%s", CacheTargetPasswordResetRequest, user.UID), 1, passwordResetRequestInterval).Result()
+	if err != nil {
+		logger.Error("Failed to throttle password reset requests", zap.Error(err))
+	} else if !sent {
+		logger.Info("Password reset throttled", zap.String("userUID", user.UID.String()))
+		return nil
+	}
+
+	token, dbToken, err := newPasswordResetToken(user.UID)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.CreatePasswordResetToken(ctx, dbToken); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(config.Config.Server.PasswordReset.URL)
+	if err != nil {
+		return fmt.Errorf("parsing password reset URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	if err := s.mailSender.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(passwordResetMailBody, user.ID, link, config.Config.Server.PasswordReset.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	logger.Info("Password reset requested", zap.String("userUID", user.UID.String()))
+	return nil
+}
+
+// ConfirmPasswordReset sets the password of the user a reset token was sent
+// to. All their reset tokens and login sessions are revoked.
+func (s *service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	dbToken, err := s.repository.GetPasswordResetToken(ctx, hashSecret(token))
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return ErrInvalidPasswordResetToken
+		}
+		return err
+	}
+	if dbToken.UseTime.Valid || time.Now().After(dbToken.ExpireTime) {
+		return ErrInvalidPasswordResetToken
+	}
+
+	// The token is only used once the new password is accepted, so the user
+	// can try again if it doesn't comply with the policy.
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, dbToken.OwnerUID)
+	passwordHash, err := s.hashNewPassword(ctx, dbToken.OwnerUID, newPassword)
+	if err != nil {
+		return err
+	}
+	_ = s.deleteUserPasswordHashFromCache(ctx, dbToken.OwnerUID)
+
+	// Claiming the token and changing the password happen in one
+	// transaction, so concurrent requests can't use the same token twice.
+	historySize := config.Config.Server.Password.HistorySize
+	if err := s.repository.ResetUserPasswordHash(ctx, dbToken.TokenHash, dbToken.OwnerUID, passwordHash, time.Now(), historySize-1); err != nil {
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return ErrInvalidPasswordResetToken
+		}
+		return err
+	}
+	_ = s.deletePasswordChangeRequiredFromCache(ctx, dbToken.OwnerUID)
+
+	if err := s.RevokeSessions(ctx, dbToken.OwnerUID); err != nil {
+		return err
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("Password reset", zap.String("userUID", dbToken.OwnerUID.String()))
+
+	return nil
+}
+
+// newPasswordResetToken generates a password reset token. The token is
+// returned along with its database record, which only holds its hash.
+func newPasswordResetToken(userUID uuid.UUID) (string, *datamodel.PasswordResetToken, error) {
+	token, tokenHash, err := newSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("generating password reset token: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &datamodel.PasswordResetToken{
+		Base:       datamodel.Base{UID: uid},
+		OwnerUID:   userUID,
+		TokenHash:  tokenHash,
+		ExpireTime: time.Now().Add(config.Config.Server.PasswordReset.TokenTTL),
+	}, nil
+}
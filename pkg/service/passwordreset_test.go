@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/mail"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// passwordResetRepository keeps the password and the reset tokens of a single
+// user in memory.
+type passwordResetRepository struct {
+	passwordRepository
+
+	tokens          []*datamodel.PasswordResetToken
+	revokedSessions bool
+}
+
+func (r *passwordResetRepository) GetUserByEmail(_ context.Context, email string) (*datamodel.Owner, error) {
+	if email != r.owner.Email {
+		return nil, errorsx.ErrNotFound
+	}
+	return r.owner, nil
+}
+
+func (r *passwordResetRepository) CreatePasswordResetToken(_ context.Context, token *datamodel.PasswordResetToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *passwordResetRepository) GetPasswordResetToken(_ context.Context, tokenHash string) (*datamodel.PasswordResetToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *passwordResetRepository) ResetUserPasswordHash(ctx context.Context, tokenHash string, uid uuid.UUID, newPassword string, updateTime time.Time, historySize int) error {
+	var claimed bool
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.OwnerUID == uid && !token.UseTime.Valid && time.Now().Before(token.ExpireTime) {
+			claimed = true
+		}
+	}
+	if !claimed {
+		return errorsx.ErrNoDataUpdated
+	}
+
+	for _, token := range r.tokens {
+		token.UseTime.Time, token.UseTime.Valid = time.Now(), true
+	}
+	return r.ChangeUserPasswordHash(ctx, uid, newPassword, updateTime, historySize)
+}
+
+func (r *passwordResetRepository) RevokeRefreshTokenFamilies(context.Context, uuid.UUID) ([]uuid.UUID, error) {
+	r.revokedSessions = true
+	return nil, nil
+}
+
+// mailbox records the messages it's asked to send.
+type mailbox struct {
+	messages []*mail.Message
+}
+
+func (m *mailbox) Send(_ context.Context, msg *mail.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	original := config.Config.Server
+	t.Cleanup(func() { config.Config.Server = original })
+	config.Config.Server.Password.Algorithm = password.AlgorithmBcrypt
+	config.Config.Server.Password.Bcrypt.Cost = bcrypt.MinCost
+	config.Config.Server.Password.HistorySize = 1
+	config.Config.Server.PasswordReset.URL = "http://localhost:3000/reset-password"
+	config.Config.Server.PasswordReset.TokenTTL = time.Hour
+
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	hasher, err := password.NewHasher(config.Config.Server.Password)
+	require.NoError(t, err)
+	policyCfg := config.PasswordConfig{}
+	policyCfg.Policy.MinLength = 8
+	policy, err := password.NewPolicy(policyCfg)
+	require.NoError(t, err)
+
+	repo := &passwordResetRepository{passwordRepository: passwordRepository{owner: &datamodel.Owner{
+		Base:  datamodel.Base{UID: uid},
+		ID:    "admin",
+		Email: "admin@instill-ai.com",
+	}}}
+	repo.current, err = hasher.Hash("forgotten")
+	require.NoError(t, err)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	sender := &mailbox{}
+	s := &service{repository: repo, redisClient: redisClient, passwordHasher: hasher, passwordPolicy: policy, mailSender: sender}
+
+	// Unknown and unverified addresses aren't disclosed.
+	require.NoError(t, s.RequestPasswordReset(ctx, "nobody@instill-ai.com"))
+	require.NoError(t, s.RequestPasswordReset(ctx, "admin@instill-ai.com"))
+	assert.Empty(t, sender.messages)
+
+	repo.owner.EmailVerified = true
+
+	requestKey := fmt.Sprintf("%s:%s", CacheTargetPasswordResetRequest, uid)
+	redisMock.ExpectSetNX(requestKey, 1, passwordResetRequestInterval).SetVal(true)
+	require.NoError(t, s.RequestPasswordReset(ctx, "admin@instill-ai.com"))
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "admin@instill-ai.com", sender.messages[0].To)
+
+	// Only the hash of the token is stored.
+	link, err := url.Parse(regexp.MustCompile(`http://\S+`).FindString(sender.messages[0].Body))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+	assert.Equal(t, hashSecret(token), repo.tokens[0].TokenHash)
+
+	// A second request within the interval doesn't send another link.
+	redisMock.ExpectSetNX(requestKey, 1, passwordResetRequestInterval).SetVal(false)
+	require.NoError(t, s.RequestPasswordReset(ctx, "admin@instill-ai.com"))
+	assert.Len(t, sender.messages, 1)
+
+	assert.True(t, errors.Is(s.ConfirmPasswordReset(ctx, "wrong", "new-password"), ErrInvalidPasswordResetToken))
+
+	// A password rejected by the policy doesn't use the token.
+	var policyErr *violation.Error
+	require.True(t, errors.As(s.ConfirmPasswordReset(ctx, token, "short"), &policyErr))
+	assert.False(t, repo.revokedSessions)
+
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUserPasswordHash, uid)).SetVal(1)
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid)).SetVal(1)
+	require.NoError(t, s.ConfirmPasswordReset(ctx, token, "new-password"))
+	assert.True(t, repo.revokedSessions)
+
+	match, _, err := hasher.Verify("new-password", repo.current)
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	assert.True(t, errors.Is(s.ConfirmPasswordReset(ctx, token, "other-password"), ErrInvalidPasswordResetToken))
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,609 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/scim"
+	"github.com/instill-ai/x/checkfield"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// The users and the organizations are provisioned by the identity providers
+// through SCIM as users and groups. A user is identified by their UID and
+// their user name is their ID, which can't be changed. A group is an
+// organization, whose members are its members in the ACL.
+
+// scimUserColumns are the SQL expressions the attributes of the user filters
+// are read from, by their path. The attributes that aren't stored have their
+// constant value.
+var scimUserColumns = map[string]string{
+	"id":              "uid::text",
+	"externalid":      "''",
+	"username":        "id",
+	"displayname":     "display_name",
+	"active":          "'true'",
+	"name.formatted":  "display_name",
+	"name.givenname":  "''",
+	"name.familyname": "''",
+	"emails":          "email",
+	"emails.value":    "email",
+	"emails.type":     "''",
+}
+
+// scimGroupColumns are the SQL expressions the attributes of the group
+// filters are read from. The members are in the ACL, they can't be filtered
+// on.
+var scimGroupColumns = map[string]string{
+	"id":          "uid::text",
+	"externalid":  "''",
+	"displayname": "display_name",
+}
+
+// ListSCIMUsers returns the page of the users matching the filter.
+func (s *service) ListSCIMUsers(ctx context.Context, filter string, startIndex, count int) (*scim.ListResponse[*scim.User], error) {
+	where, err := parseSCIMFilter(filter, scimUserColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	dbUsers, totalSize, err := s.repository.ListOwnersByOffset(ctx, "user", scim.Issuer, max(startIndex, 1)-1, count, where)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*scim.User, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users = append(users, s.dbUser2SCIMUser(dbUser))
+	}
+
+	return scim.NewListResponse(users, int(totalSize), startIndex), nil
+}
+
+// GetSCIMUser returns a user by their UID.
+func (s *service) GetSCIMUser(ctx context.Context, id string) (*scim.User, error) {
+	dbUser, err := s.getSCIMUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.dbUser2SCIMUser(dbUser), nil
+}
+
+// CreateSCIMUser provisions a user. The identity provider is trusted to have
+// verified their email, the user signs in through it.
+func (s *service) CreateSCIMUser(ctx context.Context, user *scim.User) (*scim.User, error) {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	if !user.IsActive() {
+		return nil, fmt.Errorf("%w: inactive users can't be provisioned", scim.ErrInvalidValue)
+	}
+	if err := checkfield.CheckResourceID(user.UserName); err != nil {
+		return nil, fmt.Errorf("%w: userName must be a valid user ID: %w", scim.ErrInvalidValue, err)
+	}
+	if err := s.checkSCIMOwnerID(ctx, user.UserName); err != nil {
+		return nil, err
+	}
+	email, err := s.checkSCIMUserEmail(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	name := user.FormattedName()
+	dbUser := &datamodel.Owner{
+		Base:             datamodel.Base{UID: uid},
+		ID:               user.UserName,
+		OwnerType:        sql.NullString{String: "user", Valid: true},
+		Email:            email,
+		EmailVerified:    true,
+		DisplayName:      sql.NullString{String: name, Valid: len(name) > 0},
+		OnboardingStatus: datamodel.OnboardingStatusInProgress,
+	}
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
+	if err := s.repository.CreateUser(ctx, dbUser); err != nil {
+		return nil, fmt.Errorf("provisioning SCIM user: %w", err)
+	}
+	if err := s.createSCIMOwnerIdentity(ctx, uid, sql.NullString{String: email, Valid: true}); err != nil {
+		// A user that isn't recorded can't be managed through SCIM, it's
+		// removed so the ID and email are free on the next attempt.
+		if err := s.repository.DeleteUser(ctx, dbUser.ID); err != nil {
+			logger.Error("Failed to remove SCIM user", zap.String("userUID", uid.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	logger.Info("SCIM user provisioned", zap.String("userUID", uid.String()), zap.String("userID", dbUser.ID))
+	return s.GetSCIMUser(ctx, uid.String())
+}
+
+// ReplaceSCIMUser replaces the attributes of a user.
+func (s *service) ReplaceSCIMUser(ctx context.Context, id string, user *scim.User) (*scim.User, error) {
+	dbUser, err := s.getSCIMUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.updateSCIMUser(ctx, dbUser, user)
+}
+
+// PatchSCIMUser applies the operations of a PATCH request to a user.
+func (s *service) PatchSCIMUser(ctx context.Context, id string, ops []scim.PatchOperation) (*scim.User, error) {
+	dbUser, err := s.getSCIMUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user := s.dbUser2SCIMUser(dbUser)
+	if err := user.Patch(ops); err != nil {
+		return nil, err
+	}
+	return s.updateSCIMUser(ctx, dbUser, user)
+}
+
+// DeleteSCIMUser deletes a user, who leaves their organizations first.
+func (s *service) DeleteSCIMUser(ctx context.Context, id string) error {
+	dbUser, err := s.getSCIMUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, dbUser.UID)
+
+	orgs, err := s.aclClient.GetUserOrganizations(ctx, dbUser.UID)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		if err := s.aclClient.DeleteOrganizationUserMembership(ctx, org.UID, dbUser.UID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.deleteUserFromCacheByIDAndUID(ctx, dbUser.ID, dbUser.UID); err != nil {
+		return err
+	}
+	if err := s.repository.DeleteUser(ctx, dbUser.ID); err != nil {
+		return fmt.Errorf("users/%s: %w", dbUser.ID, err)
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("SCIM user deprovisioned", zap.String("userUID", dbUser.UID.String()))
+	return nil
+}
+
+// getSCIMUser returns a user provisioned through SCIM. The default user and
+// the owner of the SCIM organizations are never managed through SCIM.
+func (s *service) getSCIMUser(ctx context.Context, id string) (*datamodel.Owner, error) {
+	uid, err := s.getSCIMOwnerUID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	dbUser, err := s.repository.GetUserByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if dbUser.ID == constant.DefaultUserID || dbUser.ID == config.Config.SCIM.OrganizationOwner {
+		return nil, fmt.Errorf("%w: the user %q can't be managed through SCIM", scim.ErrMutability, dbUser.ID)
+	}
+	return dbUser, nil
+}
+
+// getSCIMOwnerUID returns the UID of an owner provisioned through SCIM. The
+// other owners aren't found.
+func (s *service) getSCIMOwnerUID(ctx context.Context, id string) (uuid.UUID, error) {
+	uid, err := uuid.FromString(id)
+	if err != nil {
+		return uuid.Nil, errorsx.ErrNotFound
+	}
+	identity, err := s.repository.GetOwnerIdentity(ctx, scim.Issuer, uid.String())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return identity.OwnerUID, nil
+}
+
+// createSCIMOwnerIdentity records that an owner is provisioned through SCIM.
+func (s *service) createSCIMOwnerIdentity(ctx context.Context, ownerUID uuid.UUID, email sql.NullString) error {
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	return s.repository.CreateOwnerIdentity(ctx, &datamodel.OwnerIdentity{
+		Base:     datamodel.Base{UID: uid},
+		OwnerUID: ownerUID,
+		Issuer:   scim.Issuer,
+		Subject:  ownerUID.String(),
+		Email:    email,
+	})
+}
+
+// updateSCIMUser updates the name and the email of a user. There's no
+// inactive user, the users are deleted instead.
+func (s *service) updateSCIMUser(ctx context.Context, existingUser *datamodel.Owner, user *scim.User) (*scim.User, error) {
+	if !strings.EqualFold(user.UserName, existingUser.ID) {
+		return nil, fmt.Errorf("%w: userName can't be changed", scim.ErrMutability)
+	}
+	if !user.IsActive() {
+		return nil, fmt.Errorf("%w: users can't be deactivated, delete them instead", scim.ErrMutability)
+	}
+	email, err := s.checkSCIMUserEmail(ctx, user, existingUser.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// All the columns are updated, the avatar must be loaded.
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, existingUser.UID)
+	dbUser, err := s.repository.GetUser(ctx, existingUser.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	name := user.FormattedName()
+	dbUser.Email = email
+	dbUser.DisplayName = sql.NullString{String: name, Valid: len(name) > 0}
+
+	if err := s.deleteUserFromCacheByIDAndUID(ctx, dbUser.ID, dbUser.UID); err != nil {
+		return nil, err
+	}
+	if err := s.repository.UpdateUser(ctx, dbUser.ID, dbUser); err != nil {
+		return nil, fmt.Errorf("users/%s: %w", dbUser.ID, err)
+	}
+
+	return s.GetSCIMUser(ctx, dbUser.UID.String())
+}
+
+// checkSCIMUserEmail returns the normalized primary email of a user, which
+// mustn't be used by another user.
+func (s *service) checkSCIMUserEmail(ctx context.Context, user *scim.User, currentEmail string) (string, error) {
+	email := datamodel.NormalizeEmail(user.PrimaryEmail())
+	if email == "" {
+		return "", fmt.Errorf("%w: an email is required", scim.ErrInvalidValue)
+	}
+	if email == currentEmail {
+		return email, nil
+	}
+
+	_, err := s.repository.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		return "", fmt.Errorf("%w: the email is already used by another user", scim.ErrUniqueness)
+	case !errors.Is(err, errorsx.ErrNotFound):
+		return "", err
+	}
+	return email, nil
+}
+
+// checkSCIMOwnerID checks that no user or organization has the ID.
+func (s *service) checkSCIMOwnerID(ctx context.Context, id string) error {
+	_, err := s.repository.GetOwner(ctx, id, false)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: the ID %q is already taken", scim.ErrUniqueness, id)
+	case !errors.Is(err, errorsx.ErrNotFound):
+		return err
+	}
+	return nil
+}
+
+func (s *service) dbUser2SCIMUser(dbUser *datamodel.Owner) *scim.User {
+	active := true
+	user := &scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          dbUser.UID.String(),
+		UserName:    dbUser.ID,
+		DisplayName: dbUser.DisplayName.String,
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      dbUser.CreateTime,
+			LastModified: dbUser.UpdateTime,
+			Location:     s.scimLocation("Users", dbUser.UID),
+		},
+	}
+	if dbUser.DisplayName.Valid {
+		user.Name = &scim.Name{Formatted: dbUser.DisplayName.String}
+	}
+	if dbUser.Email != "" {
+		user.Emails = []scim.Email{{Value: dbUser.Email, Primary: true}}
+	}
+	return user
+}
+
+// ListSCIMGroups returns the page of the organizations matching the filter.
+func (s *service) ListSCIMGroups(ctx context.Context, filter string, startIndex, count int) (*scim.ListResponse[*scim.Group], error) {
+	where, err := parseSCIMFilter(filter, scimGroupColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	dbOrgs, totalSize, err := s.repository.ListOwnersByOffset(ctx, "organization", scim.Issuer, max(startIndex, 1)-1, count, where)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]*scim.Group, 0, len(dbOrgs))
+	for _, dbOrg := range dbOrgs {
+		group, err := s.dbOrg2SCIMGroup(ctx, dbOrg)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return scim.NewListResponse(groups, int(totalSize), startIndex), nil
+}
+
+// GetSCIMGroup returns an organization by its UID.
+func (s *service) GetSCIMGroup(ctx context.Context, id string) (*scim.Group, error) {
+	dbOrg, err := s.getSCIMGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.dbOrg2SCIMGroup(ctx, dbOrg)
+}
+
+// CreateSCIMGroup creates an organization, whose ID is derived from the
+// display name of the group. It's owned by the user set in the configuration,
+// as the identity providers don't tell who owns a group.
+func (s *service) CreateSCIMGroup(ctx context.Context, group *scim.Group) (*scim.Group, error) {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	id := generateSlug(group.DisplayName)
+	if err := checkfield.CheckResourceID(id); err != nil {
+		return nil, fmt.Errorf("%w: displayName can't be used as an organization ID: %w", scim.ErrInvalidValue, err)
+	}
+	if err := s.checkSCIMOwnerID(ctx, id); err != nil {
+		return nil, err
+	}
+	members, err := s.getSCIMMembers(ctx, group.Members)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := s.repository.GetUser(ctx, config.Config.SCIM.OrganizationOwner, false)
+	if err != nil {
+		return nil, fmt.Errorf("getting SCIM organization owner: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	dbOrg := &datamodel.Owner{
+		Base:        datamodel.Base{UID: uid},
+		ID:          id,
+		OwnerType:   sql.NullString{String: "organization", Valid: true},
+		DisplayName: sql.NullString{String: group.DisplayName, Valid: len(group.DisplayName) > 0},
+	}
+	if err := s.repository.CreateOrganization(ctx, dbOrg); err != nil {
+		return nil, fmt.Errorf("provisioning SCIM group: %w", err)
+	}
+	if err := s.createSCIMOwnerIdentity(ctx, uid, sql.NullString{}); err != nil {
+		if err := s.repository.DeleteOrganization(ctx, id); err != nil {
+			logger.Error("Failed to remove SCIM organization", zap.String("organizationUID", uid.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+	if err := s.aclClient.SetOrganizationUserMembership(ctx, uid, owner.UID, "owner"); err != nil {
+		return nil, err
+	}
+	if err := s.setSCIMMembers(ctx, uid, members); err != nil {
+		return nil, err
+	}
+
+	logger.Info("SCIM group provisioned", zap.String("organizationUID", uid.String()), zap.String("organizationID", id))
+	return s.GetSCIMGroup(ctx, uid.String())
+}
+
+// ReplaceSCIMGroup replaces the display name and the members of an
+// organization.
+func (s *service) ReplaceSCIMGroup(ctx context.Context, id string, group *scim.Group) (*scim.Group, error) {
+	dbOrg, err := s.getSCIMGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.updateSCIMGroup(ctx, dbOrg, group)
+}
+
+// PatchSCIMGroup applies the operations of a PATCH request to an
+// organization.
+func (s *service) PatchSCIMGroup(ctx context.Context, id string, ops []scim.PatchOperation) (*scim.Group, error) {
+	dbOrg, err := s.getSCIMGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	group, err := s.dbOrg2SCIMGroup(ctx, dbOrg)
+	if err != nil {
+		return nil, err
+	}
+	if err := group.Patch(ops); err != nil {
+		return nil, err
+	}
+	return s.updateSCIMGroup(ctx, dbOrg, group)
+}
+
+// DeleteSCIMGroup deletes an organization and all its memberships.
+func (s *service) DeleteSCIMGroup(ctx context.Context, id string) error {
+	dbOrg, err := s.getSCIMGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	relations, err := s.aclClient.GetOrganizationUsers(ctx, dbOrg.UID)
+	if err != nil {
+		return err
+	}
+	for _, relation := range relations {
+		if err := s.aclClient.DeleteOrganizationUserMembership(ctx, dbOrg.UID, relation.UID); err != nil {
+			return err
+		}
+	}
+	if err := s.repository.DeleteOrganization(ctx, dbOrg.ID); err != nil {
+		return fmt.Errorf("organizations/%s: %w", dbOrg.ID, err)
+	}
+
+	logger, _ := logx.GetZapLogger(ctx)
+	logger.Info("SCIM group deprovisioned", zap.String("organizationUID", dbOrg.UID.String()))
+	return nil
+}
+
+// getSCIMGroup returns an organization provisioned through SCIM.
+func (s *service) getSCIMGroup(ctx context.Context, id string) (*datamodel.Owner, error) {
+	uid, err := s.getSCIMOwnerUID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetOrganizationByUID(ctx, uid)
+}
+
+// updateSCIMGroup updates the display name and the members of an
+// organization. Its ID doesn't change with the display name.
+func (s *service) updateSCIMGroup(ctx context.Context, existingOrg *datamodel.Owner, group *scim.Group) (*scim.Group, error) {
+	members, err := s.getSCIMMembers(ctx, group.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	// All the columns are updated, the avatar must be loaded.
+	dbOrg, err := s.repository.GetOrganization(ctx, existingOrg.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	dbOrg.DisplayName = sql.NullString{String: group.DisplayName, Valid: len(group.DisplayName) > 0}
+	if err := s.repository.UpdateOrganization(ctx, dbOrg.ID, dbOrg); err != nil {
+		return nil, fmt.Errorf("organizations/%s: %w", dbOrg.ID, err)
+	}
+	if err := s.setSCIMMembers(ctx, dbOrg.UID, members); err != nil {
+		return nil, err
+	}
+
+	return s.GetSCIMGroup(ctx, dbOrg.UID.String())
+}
+
+// getSCIMMembers returns the UIDs of the members of a group, which must be
+// users.
+func (s *service) getSCIMMembers(ctx context.Context, members []scim.Member) ([]uuid.UUID, error) {
+	uids := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		uid, err := uuid.FromString(member.Value)
+		if err == nil {
+			_, err = s.repository.GetUserByUID(ctx, uid)
+		}
+		if err != nil {
+			if errors.Is(err, errorsx.ErrNotFound) || uid.IsNil() {
+				return nil, fmt.Errorf("%w: unknown member %q", scim.ErrInvalidValue, member.Value)
+			}
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// setSCIMMembers sets the members of an organization. The new members join
+// it as members and the members that left are removed. The owners, the
+// admins and the pending invitations are managed in the organization, they
+// aren't changed.
+func (s *service) setSCIMMembers(ctx context.Context, orgUID uuid.UUID, memberUIDs []uuid.UUID) error {
+	relations, err := s.aclClient.GetOrganizationUsers(ctx, orgUID)
+	if err != nil {
+		return err
+	}
+
+	// The relation of each user who joined the organization.
+	current := map[uuid.UUID]string{}
+	for _, relation := range relations {
+		if !strings.HasPrefix(relation.Relation, "pending_") {
+			current[relation.UID] = relation.Relation
+		}
+	}
+	wanted := map[uuid.UUID]bool{}
+	for _, uid := range memberUIDs {
+		wanted[uid] = true
+		if _, ok := current[uid]; !ok {
+			if err := s.aclClient.SetOrganizationUserMembership(ctx, orgUID, uid, "member"); err != nil {
+				return err
+			}
+		}
+	}
+	for uid, relation := range current {
+		if relation == "member" && !wanted[uid] {
+			if err := s.aclClient.DeleteOrganizationUserMembership(ctx, orgUID, uid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dbOrg2SCIMGroup converts an organization. The pending invitations aren't
+// members yet.
+func (s *service) dbOrg2SCIMGroup(ctx context.Context, dbOrg *datamodel.Owner) (*scim.Group, error) {
+	relations, err := s.aclClient.GetOrganizationUsers(ctx, dbOrg.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []scim.Member{}
+	for _, relation := range relations {
+		if strings.HasPrefix(relation.Relation, "pending_") {
+			continue
+		}
+		user, err := s.repository.GetUserByUID(ctx, relation.UID)
+		if err != nil {
+			if errors.Is(err, errorsx.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		members = append(members, scim.Member{
+			Value:   user.UID.String(),
+			Display: user.ID,
+			Ref:     s.scimLocation("Users", user.UID),
+		})
+	}
+
+	return &scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          dbOrg.UID.String(),
+		DisplayName: dbOrg.DisplayName.String,
+		Members:     members,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      dbOrg.CreateTime,
+			LastModified: dbOrg.UpdateTime,
+			Location:     s.scimLocation("Groups", dbOrg.UID),
+		},
+	}, nil
+}
+
+func (s *service) scimLocation(resourceType string, uid uuid.UUID) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", s.instillCoreHost, resourceType, uid)
+}
+
+// parseSCIMFilter parses the filter of a query and translates it to an SQL
+// condition on the given columns. The condition is empty when there's no
+// filter.
+func parseSCIMFilter(filter string, columns map[string]string) (clause.Expr, error) {
+	if strings.TrimSpace(filter) == "" {
+		return clause.Expr{}, nil
+	}
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return clause.Expr{}, err
+	}
+	sql, args, err := f.SQL(columns)
+	if err != nil {
+		return clause.Expr{}, err
+	}
+	return clause.Expr{SQL: sql, Vars: args}, nil
+}
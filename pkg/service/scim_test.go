@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/clause"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/constant"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/scim"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// scimRepository keeps the owners and their identities in memory, the filters
+// aren't applied but recorded.
+type scimRepository struct {
+	repository.Repository
+
+	owners     []*datamodel.Owner
+	identities []*datamodel.OwnerIdentity
+	filters    []clause.Expr
+}
+
+func (r *scimRepository) ListOwnersByOffset(ctx context.Context, ownerType, issuer string, offset, limit int, where clause.Expr) ([]*datamodel.Owner, int64, error) {
+	r.filters = append(r.filters, where)
+
+	owners := []*datamodel.Owner{}
+	for _, owner := range r.owners {
+		if _, err := r.GetOwnerIdentity(ctx, issuer, owner.UID.String()); err == nil && owner.OwnerType.String == ownerType {
+			owners = append(owners, owner)
+		}
+	}
+	page := owners[min(offset, len(owners)):]
+	return page[:min(limit, len(page))], int64(len(owners)), nil
+}
+
+func (r *scimRepository) find(match func(*datamodel.Owner) bool) (*datamodel.Owner, error) {
+	for _, owner := range r.owners {
+		if match(owner) {
+			copied := *owner
+			return &copied, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func (r *scimRepository) GetUser(_ context.Context, id string, _ bool) (*datamodel.Owner, error) {
+	return r.find(func(u *datamodel.Owner) bool { return u.ID == id })
+}
+
+func (r *scimRepository) GetOwner(ctx context.Context, id string, includeAvatar bool) (*datamodel.Owner, error) {
+	return r.GetUser(ctx, id, includeAvatar)
+}
+
+func (r *scimRepository) GetUserByUID(_ context.Context, uid uuid.UUID) (*datamodel.Owner, error) {
+	return r.find(func(u *datamodel.Owner) bool { return u.UID == uid })
+}
+
+func (r *scimRepository) GetUserByEmail(_ context.Context, email string) (*datamodel.Owner, error) {
+	return r.find(func(u *datamodel.Owner) bool { return u.Email == email })
+}
+
+func (r *scimRepository) CreateUser(_ context.Context, user *datamodel.Owner) error {
+	r.owners = append(r.owners, user)
+	return nil
+}
+
+func (r *scimRepository) UpdateUser(_ context.Context, id string, user *datamodel.Owner) error {
+	for i, u := range r.owners {
+		if u.ID == id {
+			r.owners[i] = user
+			return nil
+		}
+	}
+	return errorsx.ErrNotFound
+}
+
+func (r *scimRepository) CreateOwnerIdentity(_ context.Context, identity *datamodel.OwnerIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *scimRepository) GetOwnerIdentity(_ context.Context, issuer, subject string) (*datamodel.OwnerIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, errorsx.ErrNotFound
+}
+
+func TestSCIMUsers(t *testing.T) {
+	ctx := context.Background()
+	redisClient, redisMock := redismock.NewClientMock()
+	repo := &scimRepository{}
+	s := &service{repository: repo, redisClient: redisClient}
+
+	jane, err := s.CreateSCIMUser(ctx, &scim.User{
+		UserName: "jane",
+		Name:     &scim.Name{GivenName: "Jane", FamilyName: "Doe"},
+		Emails:   []scim.Email{{Value: "Jane@Example.com", Primary: true}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "jane", jane.UserName)
+	assert.Equal(t, "Jane Doe", jane.DisplayName)
+	assert.Equal(t, "jane@example.com", jane.PrimaryEmail())
+	stored, err := repo.GetUser(ctx, "jane", false)
+	require.NoError(t, err)
+	assert.True(t, stored.EmailVerified)
+	identity, err := repo.GetOwnerIdentity(ctx, scim.Issuer, jane.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stored.UID, identity.OwnerUID)
+
+	_, err = s.CreateSCIMUser(ctx, &scim.User{UserName: "jane", Emails: []scim.Email{{Value: "other@example.com"}}})
+	assert.True(t, errors.Is(err, scim.ErrUniqueness))
+	_, err = s.CreateSCIMUser(ctx, &scim.User{UserName: "john", Emails: []scim.Email{{Value: "jane@example.com"}}})
+	assert.True(t, errors.Is(err, scim.ErrUniqueness))
+	_, err = s.CreateSCIMUser(ctx, &scim.User{UserName: "john"})
+	assert.True(t, errors.Is(err, scim.ErrInvalidValue))
+
+	john, err := s.CreateSCIMUser(ctx, &scim.User{UserName: "john", Emails: []scim.Email{{Value: "john@instill.test"}}})
+	require.NoError(t, err)
+
+	// The filter and the page are applied by the database.
+	resp, err := s.ListSCIMUsers(ctx, `emails ew "example.com" or userName eq "john"`, 2, 10)
+	require.NoError(t, err)
+	assert.Equal(t, clause.Expr{
+		SQL:  `((lower(coalesce(email, '')) LIKE ?) OR (lower(coalesce(id, '')) = ?))`,
+		Vars: []any{"%example.com", "john"},
+	}, repo.filters[0])
+	assert.Equal(t, 2, resp.TotalResults)
+	assert.Equal(t, 2, resp.StartIndex)
+	require.Len(t, resp.Resources, 1)
+	assert.Equal(t, john.ID, resp.Resources[0].ID)
+
+	resp, err = s.ListSCIMUsers(ctx, "", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, clause.Expr{}, repo.filters[1])
+	require.Len(t, resp.Resources, 1)
+	assert.Equal(t, jane.ID, resp.Resources[0].ID)
+
+	_, err = s.ListSCIMUsers(ctx, `userName eq`, 1, 10)
+	assert.True(t, errors.Is(err, scim.ErrInvalidFilter))
+	_, err = s.ListSCIMUsers(ctx, `nickName eq "jj"`, 1, 10)
+	assert.True(t, errors.Is(err, scim.ErrInvalidFilter))
+
+	// The updates invalidate the cached user.
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUser, "jane")).SetVal(1)
+	redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUser, jane.ID)).SetVal(1)
+	updated, err := s.PatchSCIMUser(ctx, jane.ID, []scim.PatchOperation{
+		{Op: "replace", Path: "displayName", Value: json.RawMessage(`"J. Doe"`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "J. Doe", updated.DisplayName)
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+
+	_, err = s.PatchSCIMUser(ctx, jane.ID, []scim.PatchOperation{
+		{Op: "replace", Path: "userName", Value: json.RawMessage(`"janet"`)},
+	})
+	assert.True(t, errors.Is(err, scim.ErrMutability))
+	_, err = s.PatchSCIMUser(ctx, jane.ID, []scim.PatchOperation{
+		{Op: "replace", Path: "active", Value: json.RawMessage(`false`)},
+	})
+	assert.True(t, errors.Is(err, scim.ErrMutability))
+
+	john.Emails = []scim.Email{{Value: "jane@example.com"}}
+	_, err = s.ReplaceSCIMUser(ctx, john.ID, john)
+	assert.True(t, errors.Is(err, scim.ErrUniqueness))
+
+	_, err = s.GetSCIMUser(ctx, "not-a-uid")
+	assert.True(t, errors.Is(err, errorsx.ErrNotFound))
+}
+
+func TestSCIMUsers_NotProvisioned(t *testing.T) {
+	original := config.Config.SCIM
+	t.Cleanup(func() { config.Config.SCIM = original })
+	config.Config.SCIM.OrganizationOwner = "owner"
+
+	ctx := context.Background()
+	repo := &scimRepository{}
+	s := &service{repository: repo}
+	newUser := func(id string) *datamodel.Owner {
+		user := &datamodel.Owner{
+			Base:      datamodel.Base{UID: uuid.Must(uuid.NewV4())},
+			ID:        id,
+			OwnerType: sql.NullString{String: "user", Valid: true},
+		}
+		repo.owners = append(repo.owners, user)
+		return user
+	}
+
+	// The users created outside of SCIM aren't found.
+	local := newUser("local")
+	_, err := s.GetSCIMUser(ctx, local.UID.String())
+	assert.True(t, errors.Is(err, errorsx.ErrNotFound))
+	_, err = s.ReplaceSCIMUser(ctx, local.UID.String(), &scim.User{UserName: "local"})
+	assert.True(t, errors.Is(err, errorsx.ErrNotFound))
+	err = s.DeleteSCIMUser(ctx, local.UID.String())
+	assert.True(t, errors.Is(err, errorsx.ErrNotFound))
+	resp, err := s.ListSCIMUsers(ctx, "", 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Resources)
+
+	// The default user and the owner of the organizations are refused, even
+	// when they're recorded.
+	for _, id := range []string{constant.DefaultUserID, "owner"} {
+		user := newUser(id)
+		require.NoError(t, s.createSCIMOwnerIdentity(ctx, user.UID, sql.NullString{}))
+
+		_, err := s.GetSCIMUser(ctx, user.UID.String())
+		assert.True(t, errors.Is(err, scim.ErrMutability))
+		err = s.DeleteSCIMUser(ctx, user.UID.String())
+		assert.True(t, errors.Is(err, scim.ErrMutability))
+	}
+}
@@ -2,24 +2,38 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.einride.tech/aip/filtering"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 
+	"github.com/instill-ai/mgmt-backend/config"
 	"github.com/instill-ai/mgmt-backend/internal/resource"
 	"github.com/instill-ai/mgmt-backend/pkg/acl"
 	"github.com/instill-ai/mgmt-backend/pkg/constant"
 	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+	"github.com/instill-ai/mgmt-backend/pkg/ldap"
+	"github.com/instill-ai/mgmt-backend/pkg/mail"
+	"github.com/instill-ai/mgmt-backend/pkg/oidc"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
 	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/scim"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+	"github.com/instill-ai/mgmt-backend/pkg/tokenpolicy"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
 
 	mgmtpb "github.com/instill-ai/protogen-go/mgmt/v1beta"
 	pipelinepb "github.com/instill-ai/protogen-go/pipeline/v1beta"
 	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
 )
 
 // Service interface
@@ -40,16 +54,61 @@ type Service interface {
 	GetUserByUIDAdmin(ctx context.Context, uid uuid.UUID) (*mgmtpb.User, error)
 	GetUserUIDByID(ctx context.Context, id string) (uuid.UUID, error)
 
-	CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *mgmtpb.ApiToken) error
-	ListTokens(ctx context.Context, ctxUserUID uuid.UUID, pageSize int64, pageToken string) ([]*mgmtpb.ApiToken, int64, string, error)
+	CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *mgmtpb.ApiToken, restrictions *TokenRestrictions) (*mgmtpb.ApiToken, error)
+	ListTokens(ctx context.Context, ctxUserUID uuid.UUID, pageSize int64, pageToken string, state mgmtpb.ApiToken_State) ([]*mgmtpb.ApiToken, int64, string, error)
 	GetToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error)
+	GetTokenRestrictions(ctx context.Context, ctxUserUID uuid.UUID, id string) (*TokenRestrictions, error)
+	RotateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error)
+	DeactivateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error)
+	ActivateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error)
 	DeleteToken(ctx context.Context, ctxUserUID uuid.UUID, id string) error
-	ValidateToken(ctx context.Context, accessToken string) (string, error)
-	UpdateTokenLastUseTime(ctx context.Context, accessToken string) error
+	ValidateToken(ctx context.Context, accessToken string, clientIP string) (userUID string, scopes []string, err error)
+	GetAPITokenScopes(ctx context.Context, apiToken string) ([]string, error)
+	UpdateTokenLastUseTime(ctx context.Context, accessToken string, clientIP string, userAgent string) error
 
 	CheckUserPassword(ctx context.Context, uid uuid.UUID, password string) error
 	UpdateUserPassword(ctx context.Context, uid uuid.UUID, newPassword string) error
 	AuthenticateUser(ctx context.Context, username, password string) (uuid.UUID, error)
+	IsPasswordChangeRequired(ctx context.Context, uid uuid.UUID) (bool, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, token, newPassword string) error
+	AuthOIDCAuthorize(ctx context.Context) (authorizationURL, binding string, err error)
+	AuthOIDCLogin(ctx context.Context, code, state, binding string) (*AuthTokens, error)
+
+	GetEmailStatus(ctx context.Context, userUID uuid.UUID) (*EmailStatus, error)
+	SendEmailVerification(ctx context.Context, userUID uuid.UUID) error
+	RequestEmailChange(ctx context.Context, userUID uuid.UUID, email string) error
+	ConfirmEmail(ctx context.Context, token string) error
+
+	AuthTokenIssuer(ctx context.Context, username, password, mfaCode string) (*AccessTokenClaims, error)
+	AuthLogin(ctx context.Context, username, password, mfaCode string) (*AuthTokens, error)
+	AuthRefresh(ctx context.Context, refreshToken string) (*AuthTokens, error)
+	AuthLogout(ctx context.Context, accessToken string) error
+	AuthValidateAccessToken(ctx context.Context, accessToken string) (uuid.UUID, error)
+	GetJWKS(ctx context.Context) (*signingkey.JWKS, error)
+
+	ListSessions(ctx context.Context, userUID uuid.UUID) ([]*Session, error)
+	RevokeSession(ctx context.Context, userUID, sessionUID uuid.UUID) error
+	RevokeSessions(ctx context.Context, userUID uuid.UUID) error
+
+	UnlockUserAdmin(ctx context.Context, uid uuid.UUID) error
+
+	ListSCIMUsers(ctx context.Context, filter string, startIndex, count int) (*scim.ListResponse[*scim.User], error)
+	GetSCIMUser(ctx context.Context, id string) (*scim.User, error)
+	CreateSCIMUser(ctx context.Context, user *scim.User) (*scim.User, error)
+	ReplaceSCIMUser(ctx context.Context, id string, user *scim.User) (*scim.User, error)
+	PatchSCIMUser(ctx context.Context, id string, ops []scim.PatchOperation) (*scim.User, error)
+	DeleteSCIMUser(ctx context.Context, id string) error
+	ListSCIMGroups(ctx context.Context, filter string, startIndex, count int) (*scim.ListResponse[*scim.Group], error)
+	GetSCIMGroup(ctx context.Context, id string) (*scim.Group, error)
+	CreateSCIMGroup(ctx context.Context, group *scim.Group) (*scim.Group, error)
+	ReplaceSCIMGroup(ctx context.Context, id string, group *scim.Group) (*scim.Group, error)
+	PatchSCIMGroup(ctx context.Context, id string, ops []scim.PatchOperation) (*scim.Group, error)
+	DeleteSCIMGroup(ctx context.Context, id string) error
+
+	EnrollMFA(ctx context.Context, userUID uuid.UUID) (*MFAEnrollment, error)
+	VerifyMFA(ctx context.Context, userUID uuid.UUID, code string) ([]string, error)
+	DisableMFA(ctx context.Context, userUID uuid.UUID, code string) error
 
 	ListPipelineTriggerChartRecords(_ context.Context, _ *mgmtpb.ListPipelineTriggerChartRecordsRequest, ctxUserUID uuid.UUID) (*mgmtpb.ListPipelineTriggerChartRecordsResponse, error)
 	GetPipelineTriggerCount(_ context.Context, _ *mgmtpb.GetPipelineTriggerCountRequest, ctxUserUID uuid.UUID) (*mgmtpb.GetPipelineTriggerCountResponse, error)
@@ -79,10 +138,19 @@ type service struct {
 	redisClient                 *redis.Client
 	aclClient                   *acl.ACLClient
 	instillCoreHost             string
+	signingKeyManager           signingkey.Manager
+	passwordHasher              password.Hasher
+	passwordPolicy              password.Policy
+	tokenPolicy                 tokenpolicy.Policy
+	mailSender                  mail.Sender
+	ldapAuthenticator           ldap.Authenticator
+	oidcProvider                oidc.Provider
+	secretCipher                encryption.Cipher
+	sessionActivity             activityThrottle
 }
 
 // NewService initiates a service instance
-func NewService(p pipelinepb.PipelinePublicServiceClient, r repository.Repository, rc *redis.Client, i repository.InfluxDB, acl *acl.ACLClient, h string) Service {
+func NewService(p pipelinepb.PipelinePublicServiceClient, r repository.Repository, rc *redis.Client, i repository.InfluxDB, acl *acl.ACLClient, h string, k signingkey.Manager, ph password.Hasher, pp password.Policy, tp tokenpolicy.Policy, ms mail.Sender, la ldap.Authenticator, op oidc.Provider, sc encryption.Cipher) Service {
 	return &service{
 		pipelinePublicServiceClient: p,
 		repository:                  r,
@@ -90,6 +158,14 @@ func NewService(p pipelinepb.PipelinePublicServiceClient, r repository.Repositor
 		redisClient:                 rc,
 		aclClient:                   acl,
 		instillCoreHost:             h,
+		signingKeyManager:           k,
+		passwordHasher:              ph,
+		passwordPolicy:              pp,
+		tokenPolicy:                 tp,
+		mailSender:                  ms,
+		ldapAuthenticator:           la,
+		oidcProvider:                op,
+		secretCipher:                sc,
 	}
 }
 
@@ -157,12 +233,24 @@ func (s *service) ListUsers(ctx context.Context, ctxUserUID uuid.UUID, pageSize
 	return users, totalSize, nextPageToken, err
 }
 
+// CreateAuthenticatedUser provisions the authenticated user just in time. The
+// user is created with the UID of the context on their first request, e.g.
+// after signing in through an external identity provider, and is returned as
+// is afterwards.
 func (s *service) CreateAuthenticatedUser(ctx context.Context, ctxUserUID uuid.UUID, user *mgmtpb.AuthenticatedUser) (*mgmtpb.AuthenticatedUser, error) {
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
+	if _, err := s.repository.GetUserByUID(ctx, ctxUserUID); err == nil {
+		return s.GetAuthenticatedUser(ctx, ctxUserUID)
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+
 	dbUser, err := s.PBAuthenticatedUser2DBUser(ctx, user, nil)
 	if err != nil {
 		return nil, err
 	}
+	dbUser.UID = ctxUserUID
+	dbUser.ID = newUserID(ctxUserUID)
 
 	if err := s.repository.CreateUser(ctx, dbUser); err != nil {
 		return nil, err
@@ -299,6 +387,15 @@ func (s *service) UpdateAuthenticatedUser(ctx context.Context, ctxUserUID uuid.U
 		return nil, err
 	}
 
+	// The email can't be overwritten without a proof of ownership, the new
+	// address stays pending until it's verified.
+	if dbUser.Email != existingUser.Email {
+		if err := s.RequestEmailChange(ctx, ctxUserUID, dbUser.Email); err != nil {
+			return nil, err
+		}
+		dbUser.Email = existingUser.Email
+	}
+
 	// Delete both ID and UID cache entries since setUserToCacheWithUID stores under both keys
 	err = s.deleteUserFromCacheByIDAndUID(ctx, existingUser.ID, existingUser.UID)
 	if err != nil {
@@ -338,6 +435,11 @@ func (s *service) CheckUserPassword(ctx context.Context, uid uuid.UUID, password
 
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
 
+	targets := append(ipLoginTargets(ctx), userLoginTargets(ctx, uid)...)
+	if err := s.checkLoginAllowed(ctx, targets); err != nil {
+		return err
+	}
+
 	var err error
 	passwordHash := s.getUserPasswordHashFromCache(ctx, uid)
 	if passwordHash == "" {
@@ -348,10 +450,15 @@ func (s *service) CheckUserPassword(ctx context.Context, uid uuid.UUID, password
 		_ = s.setUserPasswordHashToCache(ctx, uid, passwordHash)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+	match, _, err := s.passwordHasher.Verify(password, passwordHash)
 	if err != nil {
+		return err
+	}
+	if !match {
+		s.recordLoginFailure(ctx, targets)
 		return errorsx.ErrPasswordNotMatch
 	}
+	s.resetLoginFailures(ctx, userLoginTargets(ctx, uid))
 	return nil
 }
 
@@ -359,47 +466,230 @@ func (s *service) UpdateUserPassword(ctx context.Context, uid uuid.UUID, newPass
 
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
 
-	passwordBytes, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	passwordHash, err := s.hashNewPassword(ctx, uid, newPassword)
 	if err != nil {
 		return err
 	}
 	_ = s.deleteUserPasswordHashFromCache(ctx, uid)
-	return s.repository.UpdateUserPasswordHash(ctx, uid, string(passwordBytes), time.Now())
+
+	// The current password joins the history, which holds the ones before
+	// it.
+	historySize := config.Config.Server.Password.HistorySize
+	if err := s.repository.ChangeUserPasswordHash(ctx, uid, passwordHash, time.Now(), historySize-1); err != nil {
+		return err
+	}
+	_ = s.deletePasswordChangeRequiredFromCache(ctx, uid)
+	return nil
 }
 
-// AuthenticateUser validates username/password credentials and returns the user UID.
-// Used by API Gateway's simple-auth plugin for Basic Auth authentication.
-func (s *service) AuthenticateUser(ctx context.Context, username, password string) (uuid.UUID, error) {
-	// Get user by username (ID)
-	user, err := s.repository.GetUser(ctx, username, false)
+// hashNewPassword checks a new password of a user against the password policy
+// and history, and returns its hash.
+func (s *service) hashNewPassword(ctx context.Context, uid uuid.UUID, newPassword string) (string, error) {
+	user, err := s.repository.GetUserByUID(ctx, uid)
 	if err != nil {
-		return uuid.Nil, errorsx.ErrUnauthenticated
+		return "", err
+	}
+	if err := s.passwordPolicy.Validate(newPassword, user.ID, user.Email); err != nil {
+		return "", err
+	}
+
+	historySize := config.Config.Server.Password.HistorySize
+	if err := s.checkPasswordHistory(ctx, uid, newPassword, historySize); err != nil {
+		return "", err
+	}
+
+	return s.passwordHasher.Hash(newPassword)
+}
+
+// IsPasswordChangeRequired tells whether a user must change their password
+// before using the other APIs.
+func (s *service) IsPasswordChangeRequired(ctx context.Context, uid uuid.UUID) (bool, error) {
+	if required, ok := s.getPasswordChangeRequiredFromCache(ctx, uid); ok {
+		return required, nil
 	}
 
-	// Get password hash and verify
-	passwordHash, _, err := s.repository.GetUserPasswordHash(ctx, user.UID)
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
+	required, err := s.repository.GetUserPasswordChangeRequired(ctx, uid)
 	if err != nil {
-		return uuid.Nil, errorsx.ErrUnauthenticated
+		return false, err
 	}
+	_ = s.setPasswordChangeRequiredToCache(ctx, uid, required)
+	return required, nil
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+// checkPasswordHistory rejects a password matching the current one or one of
+// the previous ones, historySize in total.
+func (s *service) checkPasswordHistory(ctx context.Context, uid uuid.UUID, newPassword string, historySize int) error {
+	if historySize <= 0 {
+		return nil
+	}
+
+	currentHash, _, err := s.repository.GetUserPasswordHash(ctx, uid)
 	if err != nil {
-		return uuid.Nil, errorsx.ErrUnauthenticated
+		return err
+	}
+	previousHashes, err := s.repository.ListPasswordHistory(ctx, uid, historySize-1)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range append([]string{currentHash}, previousHashes...) {
+		if hash == "" {
+			continue
+		}
+		match, _, err := s.passwordHasher.Verify(newPassword, hash)
+		if err != nil {
+			return err
+		}
+		if match {
+			return password.NewPolicyError(violation.Violation{
+				Rule:        password.RuleReused,
+				Description: fmt.Sprintf("must not be one of the last %d passwords", historySize),
+			})
+		}
+	}
+	return nil
+}
+
+// AuthenticateUser validates username/password credentials and returns the user UID.
+// Used by API Gateway's simple-auth plugin for Basic Auth authentication. When
+// a directory is configured, the credentials of the users without a local
+// password are checked against it. The users who enrolled MFA can't use
+// Basic Auth, they must log in or use an API token.
+func (s *service) AuthenticateUser(ctx context.Context, username, password string) (uuid.UUID, error) {
+	return s.authenticate(ctx, username, password, "", false)
+}
+
+// authenticate checks the credentials of a user. On the interactive logins,
+// the users who enrolled MFA must give a code of their second factor too.
+func (s *service) authenticate(ctx context.Context, username, password, mfaCode string, interactive bool) (uuid.UUID, error) {
+	// Failures are counted per client IP and, when the user exists, per
+	// account. Unknown usernames count against the IP only.
+	targets := ipLoginTargets(ctx)
+
+	// Get user by username (ID)
+	user, userErr := s.repository.GetUser(ctx, username, false)
+	if userErr == nil {
+		targets = append(targets, userLoginTargets(ctx, user.UID)...)
+	}
+	if err := s.checkLoginAllowed(ctx, targets); err != nil {
+		return uuid.Nil, err
+	}
+
+	var passwordHash string
+	var passwordUpdateTime time.Time
+	if userErr == nil {
+		var err error
+		if passwordHash, passwordUpdateTime, err = s.repository.GetUserPasswordHash(ctx, user.UID); err != nil {
+			return uuid.Nil, errorsx.ErrUnauthenticated
+		}
+	}
+
+	// The directory is only asked about the users without a local password,
+	// i.e. the unknown users and the ones it provisioned, so it can't be used
+	// to sign in to a local user.
+	var needsRehash bool
+	if passwordHash == "" {
+		identity := s.authenticateWithLDAP(ctx, username, password)
+		if identity == nil {
+			s.recordLoginFailure(ctx, targets)
+			return uuid.Nil, errorsx.ErrUnauthenticated
+		}
+
+		var err error
+		if user, err = s.getOrCreateLDAPUser(ctx, identity); err != nil {
+			return uuid.Nil, err
+		}
+	} else {
+		var match bool
+		var err error
+		match, needsRehash, err = s.passwordHasher.Verify(password, passwordHash)
+		if err != nil || !match {
+			s.recordLoginFailure(ctx, targets)
+			return uuid.Nil, errorsx.ErrUnauthenticated
+		}
+	}
+
+	if !interactive {
+		if err := s.refuseSecondFactorUsers(ctx, user.UID); err != nil {
+			return uuid.Nil, err
+		}
+	} else if err := s.verifySecondFactor(ctx, user.UID, mfaCode); err != nil {
+		// A missing code isn't a failure, the client is expected to prompt
+		// for one and try again.
+		if errors.Is(err, errorsx.ErrUnauthenticated) && !errors.Is(err, ErrMFARequired) {
+			s.recordLoginFailure(ctx, targets)
+		}
+		return uuid.Nil, err
+	}
+	s.resetLoginFailures(ctx, userLoginTargets(ctx, user.UID))
+
+	// Upgrade the hash to the configured algorithm and parameters while the
+	// plain password is at hand. The password itself doesn't change, so its
+	// update time is kept.
+	if needsRehash {
+		s.rehashUserPassword(ctx, user.UID, password, passwordUpdateTime)
 	}
 
 	return user.UID, nil
 }
 
-func (s *service) CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *mgmtpb.ApiToken) error {
+// rehashUserPassword replaces the hash of a password. A failure doesn't
+// prevent the authentication, the hash is upgraded on a later login.
+func (s *service) rehashUserPassword(ctx context.Context, uid uuid.UUID, password string, passwordUpdateTime time.Time) {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	passwordHash, err := s.passwordHasher.Hash(password)
+	if err == nil {
+		ctx = context.WithValue(ctx, repository.UserUIDCtxKey, uid)
+		err = s.repository.UpdateUserPasswordHash(ctx, uid, passwordHash, passwordUpdateTime)
+	}
+	if err != nil {
+		logger.Warn("Failed to rehash user password", zap.String("userUID", uid.String()), zap.Error(err))
+		return
+	}
+	_ = s.deleteUserPasswordHashFromCache(ctx, uid)
+}
+
+// TokenRestrictions restricts what an API token grants. A token without
+// restrictions grants the full power of its owner.
+type TokenRestrictions struct {
+	Scopes []string
+	// The source CIDRs the token is allowed from.
+	AllowedCIDRs []string
+	// The rules of the token policy the token was flagged for by the worker,
+	// it's output only.
+	PolicyViolations []string
+}
+
+// CreateToken creates an API token. The token is only returned on creation,
+// it's displayed by its prefix afterwards.
+func (s *service) CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *mgmtpb.ApiToken, restrictions *TokenRestrictions) (*mgmtpb.ApiToken, error) {
 
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
 
 	dbToken, err := s.PBToken2DBToken(ctx, token)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if restrictions == nil {
+		restrictions = &TokenRestrictions{}
+	}
+	scopes, err := datamodel.NormalizeTokenScopes(restrictions.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
+	}
+	dbToken.Scopes = scopes
+	allowedCIDRs, err := datamodel.NormalizeTokenCIDRs(restrictions.AllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorsx.ErrInvalidArgument, err)
 	}
+	dbToken.AllowedCIDRs = allowedCIDRs
 
-	dbToken.AccessToken = datamodel.GenerateToken()
+	accessToken := datamodel.GenerateToken()
+	dbToken.AccessTokenHash = hashSecret(accessToken)
+	dbToken.AccessTokenPrefix = datamodel.TokenPrefix(accessToken)
 	dbToken.Owner = fmt.Sprintf("users/%s", ctxUserUID)
 	curTime := time.Now()
 	dbToken.CreateTime = curTime
@@ -411,9 +701,9 @@ func (s *service) CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *
 		if token.GetTtl() >= 0 {
 			dbToken.ExpireTime = curTime.Add(time.Second * time.Duration(token.GetTtl()))
 		} else if token.GetTtl() == -1 {
-			dbToken.ExpireTime = time.Date(2099, 12, 31, 0, 0, 0, 0, time.Now().UTC().Location())
+			dbToken.ExpireTime = datamodel.NonExpiringTokenExpireTime
 		} else {
-			return errorsx.ErrInvalidTokenTTL
+			return nil, errorsx.ErrInvalidTokenTTL
 		}
 	case *mgmtpb.ApiToken_ExpireTime:
 		dbToken.ExpireTime = token.GetExpireTime().AsTime()
@@ -421,21 +711,43 @@ func (s *service) CreateToken(ctx context.Context, ctxUserUID uuid.UUID, token *
 
 	dbToken.TokenType = constant.DefaultTokenType
 
+	// The tokens created concurrently may exceed the limit of active tokens,
+	// the worker flags them.
+	activeTokens, err := s.repository.CountActiveTokens(ctx, dbToken.Owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenPolicy.Validate(dbToken, activeTokens); err != nil {
+		return nil, err
+	}
+
 	err = s.repository.CreateToken(ctx, dbToken)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_ = s.setAPITokenToCache(ctx, dbToken.AccessToken, ctxUserUID, dbToken.ExpireTime)
+	_ = s.setAPITokenToCache(ctx, dbToken.AccessTokenHash, &cachedAPIToken{
+		UserUID:      ctxUserUID,
+		Scopes:       scopes,
+		AllowedCIDRs: allowedCIDRs,
+	}, dbToken.ExpireTime)
 
-	return nil
+	pbToken, err := s.DBToken2PBToken(ctx, dbToken)
+	if err != nil {
+		return nil, err
+	}
+	pbToken.AccessToken = accessToken
+	return pbToken, nil
 }
-func (s *service) ListTokens(ctx context.Context, ctxUserUID uuid.UUID, pageSize int64, pageToken string) ([]*mgmtpb.ApiToken, int64, string, error) {
+
+// ListTokens lists the API tokens of a user, in the given state unless it's
+// STATE_UNSPECIFIED.
+func (s *service) ListTokens(ctx context.Context, ctxUserUID uuid.UUID, pageSize int64, pageToken string, state mgmtpb.ApiToken_State) ([]*mgmtpb.ApiToken, int64, string, error) {
 
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
 
 	ownerPermlink := fmt.Sprintf("users/%s", ctxUserUID.String())
-	dbTokens, pageSize, pageToken, err := s.repository.ListTokens(ctx, ownerPermlink, pageSize, pageToken)
+	dbTokens, pageSize, pageToken, err := s.repository.ListTokens(ctx, ownerPermlink, pageSize, pageToken, datamodel.TokenState(state))
 	if err != nil {
 		return nil, 0, "", fmt.Errorf("tokens/ with page_size=%d page_token=%s: %w", pageSize, pageToken, err)
 	}
@@ -457,6 +769,151 @@ func (s *service) GetToken(ctx context.Context, ctxUserUID uuid.UUID, id string)
 	return s.DBToken2PBToken(ctx, dbToken)
 
 }
+
+// GetTokenRestrictions returns what an API token is restricted to. The API
+// tokens don't expose them until the ApiToken message has the fields.
+func (s *service) GetTokenRestrictions(ctx context.Context, ctxUserUID uuid.UUID, id string) (*TokenRestrictions, error) {
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
+
+	ownerPermlink := fmt.Sprintf("users/%s", ctxUserUID.String())
+	dbToken, err := s.repository.GetToken(ctx, ownerPermlink, id)
+	if err != nil {
+		return nil, fmt.Errorf("tokens/%s: %w", id, err)
+	}
+
+	return &TokenRestrictions{
+		Scopes:           dbToken.Scopes,
+		AllowedCIDRs:     dbToken.AllowedCIDRs,
+		PolicyViolations: dbToken.PolicyViolations,
+	}, nil
+}
+
+// RotateToken issues a new secret for an API token. The current secret stays
+// valid for the rotation grace period, a secret still in its grace period is
+// revoked right away. Like on creation, the new secret is only returned once.
+func (s *service) RotateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error) {
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
+
+	ownerPermlink := fmt.Sprintf("users/%s", ctxUserUID.String())
+	dbToken, err := s.repository.GetToken(ctx, ownerPermlink, id)
+	if err != nil {
+		return nil, fmt.Errorf("tokens/%s: %w", id, err)
+	}
+
+	now := time.Now()
+	if dbToken.State != datamodel.StateActive || !dbToken.ExpireTime.After(now) {
+		return nil, fmt.Errorf("%w: tokens/%s isn't active", errorsx.ErrInvalidArgument, id)
+	}
+
+	// The grace period doesn't extend the token.
+	graceEndTime := now.Add(config.Config.Server.APIToken.RotationGracePeriod)
+	if graceEndTime.After(dbToken.ExpireTime) {
+		graceEndTime = dbToken.ExpireTime
+	}
+
+	accessToken := datamodel.GenerateToken()
+	next := &datamodel.Token{
+		AccessTokenHash:         hashSecret(accessToken),
+		AccessTokenPrefix:       datamodel.TokenPrefix(accessToken),
+		PreviousAccessTokenHash: sql.NullString{String: dbToken.AccessTokenHash, Valid: true},
+		PreviousExpireTime:      sql.NullTime{Time: graceEndTime, Valid: true},
+	}
+	if err := s.repository.RotateToken(ctx, ownerPermlink, id, dbToken.AccessTokenHash, next); err != nil {
+		return nil, fmt.Errorf("tokens/%s: %w", id, err)
+	}
+
+	// The cached secrets are looked up again, which caches the previous one
+	// until the end of its grace period at most.
+	_ = s.deleteAPITokenFromCache(ctx, dbToken.AccessTokenHash)
+	if dbToken.PreviousAccessTokenHash.Valid {
+		_ = s.deleteAPITokenFromCache(ctx, dbToken.PreviousAccessTokenHash.String)
+	}
+
+	dbToken.AccessTokenHash = next.AccessTokenHash
+	dbToken.AccessTokenPrefix = next.AccessTokenPrefix
+	dbToken.PreviousAccessTokenHash = next.PreviousAccessTokenHash
+	dbToken.PreviousExpireTime = next.PreviousExpireTime
+	dbToken.UpdateTime = now
+
+	pbToken, err := s.DBToken2PBToken(ctx, dbToken)
+	if err != nil {
+		return nil, err
+	}
+	pbToken.AccessToken = accessToken
+	return pbToken, nil
+}
+
+// DeactivateToken suspends an active API token, it's refused until it's
+// activated again.
+func (s *service) DeactivateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error) {
+	return s.updateTokenState(ctx, ctxUserUID, id, datamodel.StateActive, datamodel.StateInactive)
+}
+
+// ActivateToken resumes an inactive API token that hasn't expired. Like on
+// creation, the token must satisfy the token policy.
+func (s *service) ActivateToken(ctx context.Context, ctxUserUID uuid.UUID, id string) (*mgmtpb.ApiToken, error) {
+	return s.updateTokenState(ctx, ctxUserUID, id, datamodel.StateInactive, datamodel.StateActive)
+}
+
+func (s *service) updateTokenState(ctx context.Context, ctxUserUID uuid.UUID, id string, from, to datamodel.TokenState) (*mgmtpb.ApiToken, error) {
+
+	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
+
+	ownerPermlink := fmt.Sprintf("users/%s", ctxUserUID.String())
+	if to == datamodel.StateActive {
+		if err := s.validateTokenActivation(ctx, ownerPermlink, id, from); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repository.UpdateTokenState(ctx, ownerPermlink, id, from, to); err != nil {
+		if errors.Is(err, errorsx.ErrNoDataUpdated) {
+			// Tell a missing token from one in another state.
+			if _, err := s.repository.GetToken(ctx, ownerPermlink, id); err != nil {
+				return nil, fmt.Errorf("tokens/%s: %w", id, err)
+			}
+			return nil, fmt.Errorf("%w: tokens/%s isn't %s", errorsx.ErrInvalidArgument, id, mgmtpb.ApiToken_State(from))
+		}
+		return nil, fmt.Errorf("tokens/%s: %w", id, err)
+	}
+
+	dbToken, err := s.repository.GetToken(ctx, ownerPermlink, id)
+	if err != nil {
+		return nil, fmt.Errorf("tokens/%s: %w", id, err)
+	}
+
+	// The cached secrets would be accepted until their entry expires.
+	_ = s.deleteAPITokenFromCache(ctx, dbToken.AccessTokenHash)
+	if dbToken.PreviousAccessTokenHash.Valid {
+		_ = s.deleteAPITokenFromCache(ctx, dbToken.PreviousAccessTokenHash.String)
+	}
+
+	return s.DBToken2PBToken(ctx, dbToken)
+}
+
+// validateTokenActivation checks a token in the from state against the token
+// policy before it's activated. The tokens in another state are left to the
+// state update, which refuses them.
+func (s *service) validateTokenActivation(ctx context.Context, ownerPermlink, id string, from datamodel.TokenState) error {
+	dbToken, err := s.repository.GetToken(ctx, ownerPermlink, id)
+	if err != nil {
+		return fmt.Errorf("tokens/%s: %w", id, err)
+	}
+	if dbToken.State != from {
+		return nil
+	}
+
+	// The tokens activated concurrently may exceed the limit of active
+	// tokens, the worker flags them.
+	activeTokens, err := s.repository.CountActiveTokens(ctx, ownerPermlink)
+	if err != nil {
+		return err
+	}
+	return s.tokenPolicy.Validate(dbToken, activeTokens)
+}
+
 func (s *service) DeleteToken(ctx context.Context, ctxUserUID uuid.UUID, id string) error {
 
 	ctx = context.WithValue(ctx, repository.UserUIDCtxKey, ctxUserUID)
@@ -466,10 +923,11 @@ func (s *service) DeleteToken(ctx context.Context, ctxUserUID uuid.UUID, id stri
 	if err != nil {
 		return fmt.Errorf("tokens/%s: %w", id, err)
 	}
-	accessToken := token.AccessToken
-
 	// TODO: should be more robust
-	_ = s.deleteAPITokenFromCache(ctx, accessToken)
+	_ = s.deleteAPITokenFromCache(ctx, token.AccessTokenHash)
+	if token.PreviousAccessTokenHash.Valid {
+		_ = s.deleteAPITokenFromCache(ctx, token.PreviousAccessTokenHash.String)
+	}
 	err = s.repository.DeleteToken(ctx, ownerPermlink, id)
 	if err != nil {
 		return fmt.Errorf("tokens/%s: %w", id, err)
@@ -477,23 +935,99 @@ func (s *service) DeleteToken(ctx context.Context, ctxUserUID uuid.UUID, id stri
 	return nil
 }
 
-func (s *service) UpdateTokenLastUseTime(ctx context.Context, accessToken string) error {
-	return s.repository.UpdateTokenLastUseTime(ctx, accessToken)
+// maxTokenUserAgentLength is the length of the user agents recorded with the
+// uses of the API tokens.
+const maxTokenUserAgentLength = 1024
+
+// UpdateTokenLastUseTime records the use of an API token, along with the
+// address and the user agent of the client when they're known. The use is
+// buffered, the worker writes it to the token.
+func (s *service) UpdateTokenLastUseTime(ctx context.Context, accessToken string, clientIP string, userAgent string) error {
+	// The activity of the login sessions is recorded on validation.
+	if isAccessToken(accessToken) {
+		return nil
+	}
+	if _, err := netip.ParseAddr(clientIP); err != nil {
+		clientIP = ""
+	}
+	if len(userAgent) > maxTokenUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxTokenUserAgentLength], "")
+	}
+	return s.repository.BufferTokenLastUse(ctx, hashSecret(accessToken), &datamodel.TokenLastUse{
+		Time:      time.Now(),
+		IP:        clientIP,
+		UserAgent: userAgent,
+	})
+}
+
+// GetAPITokenScopes returns the scopes an active API token is restricted to,
+// if any.
+func (s *service) GetAPITokenScopes(ctx context.Context, apiToken string) ([]string, error) {
+	token, err := s.lookupAPIToken(ctx, apiToken)
+	if err != nil {
+		return nil, err
+	}
+	return token.Scopes, nil
 }
 
-func (s *service) ValidateToken(ctx context.Context, accessToken string) (string, error) {
-	uid := s.getAPITokenFromCache(ctx, accessToken)
-	if uid == uuid.Nil {
-		dbToken, err := s.repository.LookupToken(ctx, accessToken)
+// lookupAPIToken returns an active API token, from the cache if possible.
+func (s *service) lookupAPIToken(ctx context.Context, accessToken string) (*cachedAPIToken, error) {
+	// The malformed tokens are rejected without a lookup.
+	if err := datamodel.CheckToken(accessToken); err != nil {
+		return nil, errorsx.ErrUnauthenticated
+	}
+
+	tokenHash := hashSecret(accessToken)
+	token := s.getAPITokenFromCache(ctx, tokenHash)
+	if token == nil {
+		dbToken, err := s.repository.LookupToken(ctx, tokenHash)
 		if err != nil {
-			return "", errorsx.ErrUnauthenticated
+			return nil, errorsx.ErrUnauthenticated
 		}
-		uid = uuid.FromStringOrNil(strings.Split(dbToken.Owner, "/")[1])
-		_ = s.setAPITokenToCache(ctx, dbToken.AccessToken, uid, dbToken.ExpireTime)
+		// The worker marks the expired tokens periodically, the expiration
+		// time is checked until then. The previous secret of a rotated
+		// token expires at the end of the grace period.
+		expireTime := dbToken.ExpireTime
+		if dbToken.AccessTokenHash != tokenHash {
+			expireTime = dbToken.PreviousExpireTime.Time
+		}
+		if dbToken.State != datamodel.StateActive || !expireTime.After(time.Now()) {
+			return nil, errorsx.ErrUnauthenticated
+		}
+		token = &cachedAPIToken{
+			UserUID:      uuid.FromStringOrNil(strings.Split(dbToken.Owner, "/")[1]),
+			Scopes:       dbToken.Scopes,
+			AllowedCIDRs: dbToken.AllowedCIDRs,
+		}
+		_ = s.setAPITokenToCache(ctx, tokenHash, token, expireTime)
+
+	}
+	if token.UserUID == uuid.Nil {
+		return nil, errorsx.ErrUnauthenticated
+	}
+	return token, nil
+}
+
+// ValidateToken validates an API token or the access token of a login
+// session and returns the UID of its owner, along with the scopes the token is
+// restricted to, if any.
+func (s *service) ValidateToken(ctx context.Context, accessToken string, clientIP string) (string, []string, error) {
+	if isAccessToken(accessToken) {
+		claims, err := s.validateAccessToken(ctx, accessToken)
+		if err != nil {
+			return "", nil, err
+		}
+		return claims.Subject, nil, nil
+	}
 
+	token, err := s.lookupAPIToken(ctx, accessToken)
+	if err != nil {
+		return "", nil, err
 	}
-	if uid == uuid.Nil {
-		return "", errorsx.ErrUnauthenticated
+	// The tokens restricted to source CIDRs are refused when the client
+	// address isn't forwarded.
+	if len(token.AllowedCIDRs) > 0 && !datamodel.TokenCIDRsContain(token.AllowedCIDRs, clientIP) {
+		return "", nil, fmt.Errorf("%w: the API token isn't allowed from this address", errorsx.ErrUnauthenticated)
 	}
-	return uid.String(), nil
+	return token.UserUID.String(), token.Scopes, nil
 }
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/password"
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+)
+
+// passwordRepository keeps the password of a single user in memory.
+type passwordRepository struct {
+	repository.Repository
+
+	owner          *datamodel.Owner
+	current        string
+	history        []string
+	changeRequired bool
+}
+
+func (r *passwordRepository) GetUserByUID(context.Context, uuid.UUID) (*datamodel.Owner, error) {
+	return r.owner, nil
+}
+
+func (r *passwordRepository) GetUserPasswordChangeRequired(context.Context, uuid.UUID) (bool, error) {
+	return r.changeRequired, nil
+}
+
+func (r *passwordRepository) GetUserPasswordHash(context.Context, uuid.UUID) (string, time.Time, error) {
+	return r.current, time.Time{}, nil
+}
+
+func (r *passwordRepository) ListPasswordHistory(_ context.Context, _ uuid.UUID, limit int) ([]string, error) {
+	return r.history[:min(limit, len(r.history))], nil
+}
+
+func (r *passwordRepository) ChangeUserPasswordHash(_ context.Context, _ uuid.UUID, newPassword string, _ time.Time, historySize int) error {
+	r.history = append([]string{r.current}, r.history...)
+	r.history = r.history[:min(historySize, len(r.history))]
+	r.current = newPassword
+	return nil
+}
+
+func TestUpdateUserPassword_History(t *testing.T) {
+	original := config.Config.Server.Password
+	t.Cleanup(func() { config.Config.Server.Password = original })
+	config.Config.Server.Password.Algorithm = password.AlgorithmBcrypt
+	config.Config.Server.Password.Bcrypt.Cost = bcrypt.MinCost
+	config.Config.Server.Password.HistorySize = 3
+
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	hasher, err := password.NewHasher(config.Config.Server.Password)
+	require.NoError(t, err)
+	policy, err := password.NewPolicy(config.PasswordConfig{})
+	require.NoError(t, err)
+
+	repo := &passwordRepository{owner: &datamodel.Owner{
+		Base:  datamodel.Base{UID: uid},
+		ID:    "admin",
+		Email: "admin@instill-ai.com",
+	}}
+	repo.current, err = hasher.Hash("first")
+	require.NoError(t, err)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{repository: repo, redisClient: redisClient, passwordHasher: hasher, passwordPolicy: policy}
+
+	changePassword := func(newPassword string) error {
+		redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetUserPasswordHash, uid)).SetVal(1)
+		redisMock.ExpectDel(fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid)).SetVal(1)
+		return s.UpdateUserPassword(ctx, uid, newPassword)
+	}
+
+	require.NoError(t, changePassword("second"))
+	require.NoError(t, changePassword("third"))
+
+	// The current password and the two before it can't be reused.
+	for _, reused := range []string{"first", "second", "third"} {
+		err := s.UpdateUserPassword(ctx, uid, reused)
+
+		var policyErr *violation.Error
+		require.True(t, errors.As(err, &policyErr), reused)
+		assert.Equal(t, password.RuleReused, policyErr.Violations[0].Rule)
+	}
+
+	// Once out of the history, a password can be used again.
+	require.NoError(t, changePassword("fourth"))
+	assert.NoError(t, changePassword("first"))
+	assert.Len(t, repo.history, 2)
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestIsPasswordChangeRequired(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	key := fmt.Sprintf("%s:%s", CacheTargetPasswordChangeRequired, uid)
+
+	redisClient, redisMock := redismock.NewClientMock()
+	s := &service{repository: &passwordRepository{changeRequired: true}, redisClient: redisClient}
+
+	// The flag is read from the database on a cache miss, then cached.
+	redisMock.ExpectGet(key).RedisNil()
+	redisMock.ExpectSet(key, "true", 5*time.Minute).SetVal("OK")
+	required, err := s.IsPasswordChangeRequired(ctx, uid)
+	require.NoError(t, err)
+	assert.True(t, required)
+
+	redisMock.ExpectGet(key).SetVal("false")
+	required, err = s.IsPasswordChangeRequired(ctx, uid)
+	require.NoError(t, err)
+	assert.False(t, required)
+
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
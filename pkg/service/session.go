@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/instill-ai/mgmt-backend/internal/resource"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// Session is a login session of a user. It starts on login, is extended by
+// the refresh tokens and ends on logout or revocation.
+type Session struct {
+	UID              uuid.UUID
+	UserAgent        string
+	IPAddress        string
+	CreateTime       time.Time
+	LastActivityTime time.Time
+}
+
+// sessionActivityInterval is how often the activity of a session is recorded
+// by each replica. The validations in between don't write to the cache.
+const sessionActivityInterval = time.Minute
+
+// maxThrottledSessions bounds the sessions whose last recorded activity is
+// remembered.
+const maxThrottledSessions = 100000
+
+// activityThrottle remembers when the activity of each session was last
+// recorded.
+type activityThrottle struct {
+	mu       sync.Mutex
+	recorded map[string]time.Time
+}
+
+// allow returns whether the activity of a session must be recorded now.
+func (t *activityThrottle) allow(sid string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.recorded[sid]; ok && now.Sub(last) < sessionActivityInterval {
+		return false
+	}
+
+	if t.recorded == nil || len(t.recorded) >= maxThrottledSessions {
+		for sid, last := range t.recorded {
+			if now.Sub(last) >= sessionActivityInterval {
+				delete(t.recorded, sid)
+			}
+		}
+		if len(t.recorded) >= maxThrottledSessions {
+			clear(t.recorded)
+		}
+		if t.recorded == nil {
+			t.recorded = map[string]time.Time{}
+		}
+	}
+
+	t.recorded[sid] = now
+	return true
+}
+
+// ListSessions lists the active login sessions of a user, most recently active
+// first.
+func (s *service) ListSessions(ctx context.Context, userUID uuid.UUID) ([]*Session, error) {
+	families, err := s.repository.ListActiveRefreshTokenFamilies(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	sids := make([]string, len(families))
+	for i, family := range families {
+		sids[i] = family.UID.String()
+	}
+	activity := s.getSessionActivityFromCache(ctx, sids)
+
+	sessions := make([]*Session, 0, len(families))
+	for _, family := range families {
+		session := &Session{
+			UID:              family.UID,
+			UserAgent:        family.UserAgent,
+			IPAddress:        family.IPAddress,
+			CreateTime:       family.CreateTime,
+			LastActivityTime: family.LastActivityTime,
+		}
+		if t, ok := activity[family.UID.String()]; ok && t.After(session.LastActivityTime) {
+			session.LastActivityTime = t
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a login session of a user. Its access tokens are rejected
+// right away and its refresh token can't be used anymore.
+func (s *service) RevokeSession(ctx context.Context, userUID, sessionUID uuid.UUID) error {
+	family, err := s.repository.GetRefreshTokenFamily(ctx, sessionUID)
+	if err != nil {
+		return err
+	}
+	if family.OwnerUID != userUID {
+		return errorsx.ErrNotFound
+	}
+
+	return s.revokeSession(ctx, sessionUID)
+}
+
+// RevokeSessions ends all the login sessions of a user.
+func (s *service) RevokeSessions(ctx context.Context, userUID uuid.UUID) error {
+	revoked, err := s.repository.RevokeRefreshTokenFamilies(ctx, userUID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sessionUID := range revoked {
+		errs = append(errs, s.setRevokedSessionToCache(ctx, sessionUID.String()))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *service) revokeSession(ctx context.Context, sessionUID uuid.UUID) error {
+	if err := s.repository.RevokeRefreshTokenFamily(ctx, sessionUID); err != nil {
+		return err
+	}
+	return s.setRevokedSessionToCache(ctx, sessionUID.String())
+}
+
+// requestClient returns the user agent and the IP address of the client that
+// sent the request, as forwarded by the gateway.
+func requestClient(ctx context.Context) (userAgent, ipAddress string) {
+	return resource.GetRequestUserAgent(ctx), resource.GetRequestClientIP(ctx)
+}
+
+// isAccessToken tells the JWT access tokens issued on login apart from the
+// API tokens.
+func isAccessToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,469 @@
+package signingkey
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+)
+
+// Supported signing algorithms.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Algorithms lists the supported signing algorithms.
+var Algorithms = []string{AlgorithmRS256, AlgorithmEdDSA}
+
+const rsaKeySize = 2048
+
+// cacheTTL is how long the keys are kept in memory before being reloaded from
+// the database. A replica may keep signing with a rotated key for this long.
+const cacheTTL = time.Minute
+
+// minReloadInterval spaces out the reloads triggered by unknown key IDs, so
+// tokens with forged `kid` headers can't flood the database.
+const minReloadInterval = 5 * time.Second
+
+// Key is a key pair signing and verifying JWTs. The key ID is set as the `kid`
+// header of the tokens it signs.
+type Key struct {
+	ID         string
+	Algorithm  string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	CreateTime time.Time
+	// ExpireTime is zero for the keys that still sign tokens. Once a key is
+	// rotated, it only verifies tokens until it expires.
+	ExpireTime time.Time
+}
+
+// Repository is the storage of the signing keys.
+type Repository interface {
+	CreateSigningKey(ctx context.Context, key *datamodel.SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]*datamodel.SigningKey, error)
+	ExpireSigningKeys(ctx context.Context, exceptKID string, expireTime time.Time) error
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+// Manager handles the lifecycle of the keys signing the access tokens.
+type Manager interface {
+	// SigningKey returns the key new tokens must be signed with. A key is
+	// created if none exists.
+	SigningKey(ctx context.Context) (*Key, error)
+	// VerificationKey returns the key identified by a `kid` header, as long as
+	// it hasn't expired.
+	VerificationKey(ctx context.Context, kid string) (*Key, error)
+	// JWKS returns the public keys that verify the tokens.
+	JWKS(ctx context.Context) (*JWKS, error)
+	// RotateSigningKeys creates a new signing key if the current one is older
+	// than maxAge. The previous keys keep verifying tokens for the lifetime of
+	// the tokens they signed and are deleted once expired. It returns whether
+	// a rotation happened.
+	RotateSigningKeys(ctx context.Context, maxAge time.Duration) (bool, error)
+}
+
+type manager struct {
+	repository    Repository
+	cipher        encryption.Cipher
+	algorithm     string
+	tokenLifetime time.Duration
+
+	mu       sync.RWMutex
+	keys     []*Key
+	loadTime time.Time
+
+	// reloadMu serializes the reloads, so concurrent requests share one.
+	reloadMu sync.Mutex
+}
+
+// NewManager returns a signing key manager. The private keys are encrypted
+// with c in the database. New keys use the given algorithm and rotated keys
+// are kept for tokenLifetime, so the tokens they signed can still be verified
+// until they expire.
+func NewManager(r Repository, c encryption.Cipher, algorithm string, tokenLifetime time.Duration) (Manager, error) {
+	if _, err := signingMethod(algorithm); err != nil {
+		return nil, err
+	}
+
+	return &manager{
+		repository:    r,
+		cipher:        c,
+		algorithm:     algorithm,
+		tokenLifetime: tokenLifetime,
+	}, nil
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// GenerateKey creates a new key pair for the given algorithm.
+func GenerateKey(algorithm string) (*Key, error) {
+	method, err := signingMethod(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:         kid.String(),
+		Algorithm:  algorithm,
+		Method:     method,
+		CreateTime: time.Now(),
+	}
+
+	switch algorithm {
+	case AlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("generating RSA key: %w", err)
+		}
+		key.PrivateKey, key.PublicKey = privateKey, &privateKey.PublicKey
+	case AlgorithmEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generating Ed25519 key: %w", err)
+		}
+		key.PrivateKey, key.PublicKey = privateKey, publicKey
+	}
+
+	return key, nil
+}
+
+// key2DBKey encodes a key pair in PEM format, the private key is encrypted.
+func key2DBKey(key *Key, c encryption.Cipher) (*datamodel.SigningKey, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("encoding private key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("encoding public key: %w", err)
+	}
+
+	privateKey, err := c.Encrypt(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting private key: %w", err)
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return &datamodel.SigningKey{
+		Base:       datamodel.Base{UID: uid},
+		KID:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: privateKey,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// dbKey2Key decodes a key pair stored in PEM format. The private keys stored
+// before they were encrypted are read as is.
+func dbKey2Key(dbKey *datamodel.SigningKey, c encryption.Cipher) (*Key, error) {
+	method, err := signingMethod(dbKey.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	privatePEM := []byte(dbKey.PrivateKey)
+	if encryption.IsEncrypted(dbKey.PrivateKey) {
+		if privatePEM, err = c.Decrypt(dbKey.PrivateKey); err != nil {
+			return nil, fmt.Errorf("decrypting private key %s: %w", dbKey.KID, err)
+		}
+	}
+
+	privateBlock, _ := pem.Decode(privatePEM)
+	if privateBlock == nil {
+		return nil, fmt.Errorf("decoding private key %s: invalid PEM", dbKey.KID)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("decoding private key %s: %w", dbKey.KID, err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("decoding private key %s: unsupported key type", dbKey.KID)
+	}
+
+	publicBlock, _ := pem.Decode([]byte(dbKey.PublicKey))
+	if publicBlock == nil {
+		return nil, fmt.Errorf("decoding public key %s: invalid PEM", dbKey.KID)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key %s: %w", dbKey.KID, err)
+	}
+
+	key := &Key{
+		ID:         dbKey.KID,
+		Algorithm:  dbKey.Algorithm,
+		Method:     method,
+		PrivateKey: signer,
+		PublicKey:  publicKey,
+		CreateTime: dbKey.CreateTime,
+	}
+	if dbKey.ExpireTime.Valid {
+		key.ExpireTime = dbKey.ExpireTime.Time
+	}
+	return key, nil
+}
+
+// cached returns the in-memory keys if they were loaded less than maxAge ago.
+func (m *manager) cached(maxAge time.Duration) ([]*Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.keys, time.Since(m.loadTime) < maxAge
+}
+
+// load returns the keys, newest first, reloading them from the database when
+// the in-memory copy is older than maxAge. A zero maxAge forces the reload.
+func (m *manager) load(ctx context.Context, maxAge time.Duration) ([]*Key, error) {
+	if keys, ok := m.cached(maxAge); ok {
+		return keys, nil
+	}
+
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// The keys might have been reloaded while waiting for the lock.
+	if keys, ok := m.cached(maxAge); ok {
+		return keys, nil
+	}
+
+	dbKeys, err := m.repository.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(dbKeys))
+	for _, dbKey := range dbKeys {
+		key, err := dbKey2Key(dbKey, m.cipher)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	m.mu.Lock()
+	m.keys, m.loadTime = keys, time.Now()
+	m.mu.Unlock()
+
+	return keys, nil
+}
+
+func currentKey(keys []*Key) *Key {
+	for _, key := range keys {
+		if key.ExpireTime.IsZero() {
+			return key
+		}
+	}
+	return nil
+}
+
+func (m *manager) createKey(ctx context.Context) (*Key, error) {
+	key, err := GenerateKey(m.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	dbKey, err := key2DBKey(key, m.cipher)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.repository.CreateSigningKey(ctx, dbKey); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (m *manager) SigningKey(ctx context.Context) (*Key, error) {
+	keys, err := m.load(ctx, cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if key := currentKey(keys); key != nil {
+		return key, nil
+	}
+
+	// Another replica might have created the first key in the meantime.
+	keys, err = m.load(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	if key := currentKey(keys); key != nil {
+		return key, nil
+	}
+
+	key, err := m.createKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.load(ctx, 0); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (m *manager) VerificationKey(ctx context.Context, kid string) (*Key, error) {
+	find := func(keys []*Key) *Key {
+		for _, key := range keys {
+			if key.ID != kid {
+				continue
+			}
+			if !key.ExpireTime.IsZero() && key.ExpireTime.Before(time.Now()) {
+				return nil
+			}
+			return key
+		}
+		return nil
+	}
+
+	keys, err := m.load(ctx, cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if key := find(keys); key != nil {
+		return key, nil
+	}
+
+	// The key might have been created by another replica since the last load.
+	// The reload is rate limited, as the key ID comes from the caller.
+	keys, err = m.load(ctx, minReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	if key := find(keys); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+func (m *manager) RotateSigningKeys(ctx context.Context, maxAge time.Duration) (bool, error) {
+	if err := m.repository.DeleteExpiredSigningKeys(ctx); err != nil {
+		return false, err
+	}
+
+	keys, err := m.load(ctx, 0)
+	if err != nil {
+		return false, err
+	}
+
+	if key := currentKey(keys); key != nil && time.Since(key.CreateTime) < maxAge {
+		return false, nil
+	}
+
+	key, err := m.createKey(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// The replicas may keep signing with the previous keys until they reload
+	// them, so these must verify tokens for a bit longer than their lifetime.
+	expireTime := time.Now().Add(m.tokenLifetime + cacheTTL)
+	if err := m.repository.ExpireSigningKeys(ctx, key.ID, expireTime); err != nil {
+		return false, err
+	}
+
+	if _, err := m.load(ctx, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is the public part of a signing key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWK returns the public key in JSON Web Key format.
+func (k *Key) JWK() (JWK, error) {
+	jwk := JWK{
+		KeyID:     k.ID,
+		Algorithm: k.Algorithm,
+		Use:       "sig",
+	}
+
+	switch publicKey := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", k.PublicKey)
+	}
+
+	return jwk, nil
+}
+
+func (m *manager) JWKS(ctx context.Context) (*JWKS, error) {
+	keys, err := m.load(ctx, cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if !key.ExpireTime.IsZero() && key.ExpireTime.Before(time.Now()) {
+			continue
+		}
+		jwk, err := key.JWK()
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
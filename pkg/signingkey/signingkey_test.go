@@ -0,0 +1,245 @@
+package signingkey
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/encryption"
+)
+
+// memRepository keeps the signing keys in memory.
+type memRepository struct {
+	mu    sync.Mutex
+	keys  []*datamodel.SigningKey
+	lists int
+}
+
+func (r *memRepository) CreateSigningKey(_ context.Context, key *datamodel.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.CreateTime = time.Now()
+	r.keys = append([]*datamodel.SigningKey{key}, r.keys...)
+	return nil
+}
+
+func (r *memRepository) ListSigningKeys(context.Context) ([]*datamodel.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lists++
+	keys := []*datamodel.SigningKey{}
+	for _, key := range r.keys {
+		if key.ExpireTime.Valid && key.ExpireTime.Time.Before(time.Now()) {
+			continue
+		}
+		k := *key
+		keys = append(keys, &k)
+	}
+	return keys, nil
+}
+
+func (r *memRepository) ExpireSigningKeys(_ context.Context, exceptKID string, expireTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if key.KID != exceptKID && !key.ExpireTime.Valid {
+			key.ExpireTime = sql.NullTime{Time: expireTime, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r *memRepository) DeleteExpiredSigningKeys(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := r.keys[:0]
+	for _, key := range r.keys {
+		if !key.ExpireTime.Valid || key.ExpireTime.Time.After(time.Now()) {
+			keys = append(keys, key)
+		}
+	}
+	r.keys = keys
+	return nil
+}
+
+func testCipher(t *testing.T) encryption.Cipher {
+	t.Helper()
+
+	c, err := encryption.NewCipher("test-encryption-key")
+	require.NoError(t, err)
+	return c
+}
+
+func TestNewManager_UnsupportedAlgorithm(t *testing.T) {
+	_, err := NewManager(&memRepository{}, testCipher(t), "HS256", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestManager_SigningKey(t *testing.T) {
+	ctx := context.Background()
+
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			repo := &memRepository{}
+			m, err := NewManager(repo, testCipher(t), algorithm, time.Hour)
+			require.NoError(t, err)
+
+			key, err := m.SigningKey(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, key.Algorithm)
+			require.Len(t, repo.keys, 1)
+
+			// The key is reused and survives a round trip through the storage.
+			again, err := m.SigningKey(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, again.ID)
+
+			token := jwt.NewWithClaims(key.Method, jwt.MapClaims{"sub": "test"})
+			signed, err := token.SignedString(key.PrivateKey)
+			require.NoError(t, err)
+
+			other, err := NewManager(repo, testCipher(t), algorithm, time.Hour)
+			require.NoError(t, err)
+			verificationKey, err := other.VerificationKey(ctx, key.ID)
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return verificationKey.PublicKey, nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestManager_RotateSigningKeys(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &memRepository{}
+	m, err := NewManager(repo, testCipher(t), AlgorithmRS256, time.Hour)
+	require.NoError(t, err)
+
+	rotated, err := m.RotateSigningKeys(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, rotated, "a key is created when none exists")
+
+	first, err := m.SigningKey(ctx)
+	require.NoError(t, err)
+
+	rotated, err = m.RotateSigningKeys(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.False(t, rotated, "the current key is recent enough")
+
+	rotated, err = m.RotateSigningKeys(ctx, 0)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	second, err := m.SigningKey(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	// The previous key still verifies the tokens it signed.
+	previous, err := m.VerificationKey(ctx, first.ID)
+	require.NoError(t, err)
+	assert.False(t, previous.ExpireTime.IsZero())
+
+	jwks, err := m.JWKS(ctx)
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, second.ID, jwks.Keys[0].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.NotEmpty(t, jwks.Keys[0].N)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+
+	// Once expired, the previous key is dropped.
+	repo.keys[1].ExpireTime.Time = time.Now().Add(-time.Second)
+	_, err = m.RotateSigningKeys(ctx, 24*time.Hour)
+	require.NoError(t, err)
+
+	_, err = m.VerificationKey(ctx, first.ID)
+	assert.Error(t, err)
+	assert.Len(t, repo.keys, 1)
+}
+
+func TestManager_EncryptedPrivateKey(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &memRepository{}
+	m, err := NewManager(repo, testCipher(t), AlgorithmEdDSA, time.Hour)
+	require.NoError(t, err)
+
+	key, err := m.SigningKey(ctx)
+	require.NoError(t, err)
+	require.Len(t, repo.keys, 1)
+	assert.True(t, encryption.IsEncrypted(repo.keys[0].PrivateKey))
+	assert.NotContains(t, repo.keys[0].PrivateKey, "PRIVATE KEY")
+
+	// The keys stored in plaintext before the encryption are still read.
+	legacy, err := GenerateKey(AlgorithmEdDSA)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(legacy.PrivateKey)
+	require.NoError(t, err)
+	dbKey, err := key2DBKey(legacy, testCipher(t))
+	require.NoError(t, err)
+	dbKey.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	require.NoError(t, repo.CreateSigningKey(ctx, dbKey))
+
+	decoded, err := dbKey2Key(dbKey, testCipher(t))
+	require.NoError(t, err)
+	assert.Equal(t, legacy.PrivateKey, decoded.PrivateKey)
+
+	// A different key can't decrypt the stored keys.
+	other, err := encryption.NewCipher("another-encryption-key")
+	require.NoError(t, err)
+	encrypted := *repo.keys[1]
+	assert.Equal(t, key.ID, encrypted.KID)
+	_, err = dbKey2Key(&encrypted, other)
+	assert.ErrorIs(t, err, encryption.ErrDecrypt)
+}
+
+func TestManager_VerificationKey_UnknownKID(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &memRepository{}
+	m, err := NewManager(repo, testCipher(t), AlgorithmEdDSA, time.Hour)
+	require.NoError(t, err)
+
+	key, err := m.SigningKey(ctx)
+	require.NoError(t, err)
+	lists := repo.lists
+
+	// Unknown key IDs don't reload the keys more than once per interval.
+	for range 10 {
+		_, err = m.VerificationKey(ctx, "unknown")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, lists, repo.lists)
+
+	_, err = m.VerificationKey(ctx, key.ID)
+	assert.NoError(t, err)
+}
+
+func TestKey_JWK_Ed25519(t *testing.T) {
+	key, err := GenerateKey(AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	jwk, err := key.JWK()
+	require.NoError(t, err)
+	assert.Equal(t, "OKP", jwk.KeyType)
+	assert.Equal(t, "Ed25519", jwk.Curve)
+	assert.Equal(t, AlgorithmEdDSA, jwk.Algorithm)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.Len(t, jwk.X, 43)
+}
@@ -0,0 +1,103 @@
+package tokenpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+)
+
+// API token policy rules, reported as the reason of the violations and
+// recorded on the tokens flagged by the worker.
+const (
+	RuleMaxTTL          = "MAX_TTL"
+	RuleNonExpiring     = "NON_EXPIRING"
+	RuleMaxActiveTokens = "MAX_ACTIVE_TOKENS"
+	RuleNamePattern     = "NAME_PATTERN"
+)
+
+// Policy restricts the API tokens of the users.
+type Policy interface {
+	// Validate checks a new token against the policy, its owner having
+	// activeTokens other active tokens. A *violation.Error is returned when
+	// some rules aren't satisfied.
+	Validate(token *datamodel.Token, activeTokens int64) error
+	// Violations returns the rules a token doesn't satisfy, its owner having
+	// had activeTokens other active tokens when it was created.
+	Violations(token *datamodel.Token, activeTokens int64) []violation.Violation
+}
+
+type policy struct {
+	maxTTL            time.Duration
+	forbidNonExpiring bool
+	maxActivePerOwner int
+	namePattern       *regexp.Regexp
+}
+
+// NewPolicy returns an API token policy for the given configuration.
+func NewPolicy(cfg config.APITokenPolicyConfig) (Policy, error) {
+	if cfg.MaxTTL < 0 || cfg.MaxActivePerOwner < 0 {
+		return nil, fmt.Errorf("the token policy limits can't be negative")
+	}
+
+	p := &policy{
+		maxTTL:            cfg.MaxTTL,
+		forbidNonExpiring: cfg.ForbidNonExpiring,
+		maxActivePerOwner: cfg.MaxActivePerOwner,
+	}
+
+	if cfg.NamePattern != "" {
+		namePattern, err := regexp.Compile(cfg.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling token name pattern: %w", err)
+		}
+		p.namePattern = namePattern
+	}
+
+	return p, nil
+}
+
+func (p *policy) Validate(token *datamodel.Token, activeTokens int64) error {
+	if violations := p.Violations(token, activeTokens); len(violations) > 0 {
+		return &violation.Error{Subject: "API token", Violations: violations}
+	}
+	return nil
+}
+
+func (p *policy) Violations(token *datamodel.Token, activeTokens int64) []violation.Violation {
+	var violations []violation.Violation
+
+	if p.forbidNonExpiring && token.NeverExpires() {
+		violations = append(violations, violation.Violation{
+			Rule:        RuleNonExpiring,
+			Field:       "expiration",
+			Description: "the token must expire",
+		})
+	}
+	if p.maxTTL > 0 && token.ExpireTime.Sub(token.CreateTime) > p.maxTTL {
+		violations = append(violations, violation.Violation{
+			Rule:        RuleMaxTTL,
+			Field:       "expiration",
+			Description: fmt.Sprintf("the token must expire within %s", p.maxTTL),
+		})
+	}
+	if p.maxActivePerOwner > 0 && activeTokens >= int64(p.maxActivePerOwner) {
+		violations = append(violations, violation.Violation{
+			Rule:        RuleMaxActiveTokens,
+			Field:       "token",
+			Description: fmt.Sprintf("a user can't have more than %d active tokens", p.maxActivePerOwner),
+		})
+	}
+	if p.namePattern != nil && !p.namePattern.MatchString(token.ID) {
+		violations = append(violations, violation.Violation{
+			Rule:        RuleNamePattern,
+			Field:       "id",
+			Description: fmt.Sprintf("the token ID must match %s", p.namePattern),
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,104 @@
+package tokenpolicy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+	"github.com/instill-ai/mgmt-backend/pkg/violation"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+func violatedRules(violations []violation.Violation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPolicy_Violations(t *testing.T) {
+	p, err := NewPolicy(config.APITokenPolicyConfig{
+		MaxTTL:            90 * 24 * time.Hour,
+		ForbidNonExpiring: true,
+		MaxActivePerOwner: 3,
+		NamePattern:       "^(ci|cd)-[a-z]+$",
+	})
+	require.NoError(t, err)
+
+	createTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	token := func(id string, ttl time.Duration) *datamodel.Token {
+		return &datamodel.Token{
+			Base:       datamodel.Base{CreateTime: createTime},
+			ID:         id,
+			ExpireTime: createTime.Add(ttl),
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		token        *datamodel.Token
+		activeTokens int64
+		want         []string
+	}{
+		{name: "ok", token: token("ci-build", 30*24*time.Hour), activeTokens: 2, want: []string{}},
+		{name: "max TTL", token: token("ci-build", 90*24*time.Hour+time.Second), want: []string{RuleMaxTTL}},
+		{name: "name", token: token("build", time.Hour), want: []string{RuleNamePattern}},
+		{name: "active tokens", token: token("cd-deploy", time.Hour), activeTokens: 3, want: []string{RuleMaxActiveTokens}},
+		{
+			name:  "non-expiring",
+			token: &datamodel.Token{Base: datamodel.Base{CreateTime: createTime}, ID: "ci-build", ExpireTime: datamodel.NonExpiringTokenExpireTime},
+			want:  []string{RuleNonExpiring, RuleMaxTTL},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, violatedRules(p.Violations(tc.token, tc.activeTokens)))
+		})
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	p, err := NewPolicy(config.APITokenPolicyConfig{NamePattern: "^ci-"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	token := &datamodel.Token{Base: datamodel.Base{CreateTime: now}, ID: "ci-build", ExpireTime: now.Add(time.Hour)}
+	assert.NoError(t, p.Validate(token, 100))
+
+	token.ID = "build"
+	err = p.Validate(token, 0)
+	assert.True(t, errors.Is(err, errorsx.ErrInvalidArgument))
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.GetFieldViolations(), 1)
+	assert.Equal(t, "id", badRequest.GetFieldViolations()[0].GetField())
+	assert.Equal(t, RuleNamePattern, badRequest.GetFieldViolations()[0].GetReason())
+
+	// The zero configuration doesn't restrict the tokens.
+	p, err = NewPolicy(config.APITokenPolicyConfig{})
+	require.NoError(t, err)
+	token.ExpireTime = datamodel.NonExpiringTokenExpireTime
+	assert.NoError(t, p.Validate(token, 1000))
+}
+
+func TestNewPolicy_InvalidConfig(t *testing.T) {
+	_, err := NewPolicy(config.APITokenPolicyConfig{NamePattern: "ci-("})
+	assert.Error(t, err)
+	_, err = NewPolicy(config.APITokenPolicyConfig{MaxActivePerOwner: -1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+// Package violation reports the policy rules that a request doesn't satisfy,
+// e.g. the password and the API token policies.
+package violation
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+// Violation is a policy rule that a request doesn't satisfy.
+type Violation struct {
+	Rule string
+	// Field is the request field reported in the BadRequest detail.
+	Field       string
+	Description string
+}
+
+// Error lists the policy rules that a request doesn't satisfy. It wraps
+// errorsx.ErrInvalidArgument and is returned to the clients as a gRPC status
+// with a BadRequest detail per violation.
+type Error struct {
+	// Subject is what the policy applies to, e.g. `password`.
+	Subject    string
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, v.Description)
+	}
+	return fmt.Sprintf("%s doesn't satisfy the policy: %s", e.Subject, strings.Join(descriptions, "; "))
+}
+
+func (e *Error) Unwrap() error {
+	return errorsx.ErrInvalidArgument
+}
+
+// GRPCStatus implements the interface used by the gRPC status package to
+// convert the error.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, e.Error())
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+			Reason:      v.Rule,
+		})
+	}
+
+	if withDetails, err := st.WithDetails(badRequest); err == nil {
+		return withDetails
+	}
+	return st
+}
@@ -0,0 +1,33 @@
+package violation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	errorsx "github.com/instill-ai/x/errors"
+)
+
+func TestError(t *testing.T) {
+	err := &Error{Subject: "password", Violations: []Violation{
+		{Rule: "MIN_LENGTH", Field: "new_password", Description: "must be at least 8 characters long"},
+		{Rule: "DIGIT", Field: "new_password", Description: "must contain a digit"},
+	}}
+	assert.EqualError(t, err, "password doesn't satisfy the policy: must be at least 8 characters long; must contain a digit")
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 2)
+	assert.Equal(t, "new_password", badRequest.FieldViolations[1].Field)
+	assert.Equal(t, "DIGIT", badRequest.FieldViolations[1].Reason)
+}
@@ -1,3 +1,40 @@
 package worker
 
+import (
+	"context"
+
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/instill-ai/mgmt-backend/pkg/repository"
+	"github.com/instill-ai/mgmt-backend/pkg/signingkey"
+	"github.com/instill-ai/mgmt-backend/pkg/tokenpolicy"
+)
+
+// TaskQueue is the Temporal task queue of the mgmt-backend worker.
 const TaskQueue = "mgmt-backend"
+
+// Worker interface
+type Worker interface {
+	RotateSigningKeysWorkflow(ctx workflow.Context) error
+	RotateSigningKeysActivity(ctx context.Context) error
+	SweepAPITokensWorkflow(ctx workflow.Context) error
+	SweepAPITokensActivity(ctx context.Context) error
+	FlushTokenLastUsesWorkflow(ctx workflow.Context) error
+	FlushTokenLastUsesActivity(ctx context.Context) error
+}
+
+// worker represents resources required to run Temporal workflow and activity
+type worker struct {
+	signingKeyManager signingkey.Manager
+	repository        repository.Repository
+	tokenPolicy       tokenpolicy.Policy
+}
+
+// NewWorker initiates a temporal worker for workflow and activity definition
+func NewWorker(k signingkey.Manager, r repository.Repository, tp tokenpolicy.Policy) Worker {
+	return &worker{
+		signingKeyManager: k,
+		repository:        r,
+		tokenPolicy:       tp,
+	}
+}
@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"go.uber.org/zap"
+
+	"github.com/instill-ai/mgmt-backend/config"
+	"github.com/instill-ai/mgmt-backend/pkg/datamodel"
+
+	errorsx "github.com/instill-ai/x/errors"
+	logx "github.com/instill-ai/x/log"
+)
+
+// RotateSigningKeysWorkflowID is the ID of the cron workflow rotating the JWT
+// signing keys. A fixed ID ensures only one schedule runs.
+const RotateSigningKeysWorkflowID = "rotate-signing-keys"
+
+// RotateSigningKeysCronSchedule is how often the signing key age is checked.
+const RotateSigningKeysCronSchedule = "0 * * * *"
+
+// RotateSigningKeysWorkflow rotates the JWT signing keys once they're older
+// than the configured rotation period.
+func (w *worker) RotateSigningKeysWorkflow(ctx workflow.Context) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+
+	return workflow.ExecuteActivity(ctx, w.RotateSigningKeysActivity).Get(ctx, nil)
+}
+
+// RotateSigningKeysActivity creates a new signing key if the current one has
+// reached the rotation period and deletes the expired ones.
+func (w *worker) RotateSigningKeysActivity(ctx context.Context) error {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	rotated, err := w.signingKeyManager.RotateSigningKeys(ctx, config.Config.Server.JWT.RotationPeriod)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		logger.Info("JWT signing key rotated")
+	}
+
+	return nil
+}
+
+// SweepAPITokensWorkflowID is the ID of the cron workflow sweeping the API
+// tokens.
+const SweepAPITokensWorkflowID = "sweep-api-tokens"
+
+// SweepAPITokensCronSchedule is how often the API tokens are swept. The
+// expired tokens are refused in the meantime by their expiration time.
+const SweepAPITokensCronSchedule = "30 * * * *"
+
+// SweepAPITokensWorkflow marks the API tokens past their expiration as
+// expired, revokes the previous secrets of the rotated tokens, flags the
+// tokens that don't satisfy the token policy and purges the tokens that
+// expired long ago.
+func (w *worker) SweepAPITokensWorkflow(ctx workflow.Context) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+
+	return workflow.ExecuteActivity(ctx, w.SweepAPITokensActivity).Get(ctx, nil)
+}
+
+// SweepAPITokensActivity marks the expired API tokens, clears the previous
+// secrets past their grace period, flags the policy violations and deletes
+// the tokens that expired longer than the retention period ago.
+func (w *worker) SweepAPITokensActivity(ctx context.Context) error {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	expired, err := w.repository.ExpireTokens(ctx)
+	if err != nil {
+		return err
+	}
+	revoked, err := w.repository.RevokePreviousTokens(ctx)
+	if err != nil {
+		return err
+	}
+	flagged, err := w.flagTokenPolicyViolations(ctx)
+	if err != nil {
+		return err
+	}
+	deleted, err := w.repository.DeleteExpiredTokens(ctx, time.Now().Add(-config.Config.Server.APIToken.Retention))
+	if err != nil {
+		return err
+	}
+	if expired > 0 || revoked > 0 || flagged > 0 || deleted > 0 {
+		logger.Info("API tokens swept",
+			zap.Int64("expired", expired),
+			zap.Int64("revokedPrevious", revoked),
+			zap.Int64("policyViolations", flagged),
+			zap.Int64("deleted", deleted))
+	}
+
+	return nil
+}
+
+// flagTokenPolicyViolations records the rules of the token policy the active
+// tokens don't satisfy, as the policy may have changed since their creation.
+// The tokens of an owner beyond the limit of active tokens are the most
+// recent ones. It returns how many tokens were newly flagged.
+func (w *worker) flagTokenPolicyViolations(ctx context.Context) (int64, error) {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	tokens, err := w.repository.ListAllValidTokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+	slices.SortFunc(tokens, func(a, b datamodel.Token) int {
+		return cmp.Or(strings.Compare(a.Owner, b.Owner), a.CreateTime.Compare(b.CreateTime))
+	})
+
+	var flagged, activeTokens int64
+	for i := range tokens {
+		token := &tokens[i]
+		if i > 0 && tokens[i-1].Owner == token.Owner {
+			activeTokens++
+		} else {
+			activeTokens = 0
+		}
+
+		rules := []string{}
+		for _, v := range w.tokenPolicy.Violations(token, activeTokens) {
+			rules = append(rules, v.Rule)
+		}
+		if slices.Equal(rules, token.PolicyViolations) {
+			continue
+		}
+		// The token may have been deleted in the meantime.
+		if err := w.repository.UpdateTokenPolicyViolations(ctx, token.UID, rules); err != nil && !errors.Is(err, errorsx.ErrNoDataUpdated) {
+			return flagged, err
+		}
+		if len(rules) > 0 {
+			flagged++
+			logger.Warn("API token doesn't satisfy the token policy",
+				zap.String("owner", token.Owner),
+				zap.String("id", token.ID),
+				zap.Strings("rules", rules))
+		}
+	}
+
+	return flagged, nil
+}
+
+// FlushTokenLastUsesWorkflowID is the ID of the cron workflow writing the
+// buffered uses of the API tokens.
+const FlushTokenLastUsesWorkflowID = "flush-token-last-uses"
+
+// FlushTokenLastUsesCronSchedule is how often the buffered uses are written,
+// they're merged into the tokens that are read in the meantime.
+const FlushTokenLastUsesCronSchedule = "* * * * *"
+
+// FlushTokenLastUsesWorkflow writes the last uses of the API tokens buffered
+// in Redis to the database.
+func (w *worker) FlushTokenLastUsesWorkflow(ctx workflow.Context) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+
+	return workflow.ExecuteActivity(ctx, w.FlushTokenLastUsesActivity).Get(ctx, nil)
+}
+
+// FlushTokenLastUsesActivity writes the buffered uses to the API tokens in
+// batches.
+func (w *worker) FlushTokenLastUsesActivity(ctx context.Context) error {
+	logger, _ := logx.GetZapLogger(ctx)
+
+	updated, err := w.repository.FlushTokenLastUses(ctx)
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		logger.Info("API token last uses flushed", zap.Int64("updated", updated))
+	}
+
+	return nil
+}